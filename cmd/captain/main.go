@@ -1,8 +1,10 @@
 package main
 
 import (
+	"errors"
 	"os"
 
+	"github.com/flanksource/captain/pkg/ai/pricing"
 	"github.com/flanksource/captain/pkg/cli"
 	"github.com/flanksource/clicky"
 	"github.com/spf13/cobra"
@@ -27,15 +29,61 @@ func main() {
 	clicky.BindAllFlags(rootCmd.PersistentFlags(), "format")
 	clicky.AddNamedCommand("history", rootCmd, cli.HistoryOptions{}, cli.RunHistory)
 	clicky.AddNamedCommand("info", rootCmd, cli.InfoOptions{}, cli.RunInfo)
-	clicky.AddNamedCommand("cost", rootCmd, cli.CostOptions{}, cli.RunCost)
+	var budgetErr *cli.BudgetExceededError
+	clicky.AddNamedCommand("cost", rootCmd, cli.CostOptions{}, func(opts cli.CostOptions) (any, error) {
+		// a breached budget still prints the report, then sets the exit status
+		result, err := cli.RunCost(opts)
+		if errors.As(err, &budgetErr) {
+			return result, nil
+		}
+		return result, err
+	})
+
+	hookCmd := &cobra.Command{Use: "hook", Short: "Claude Code hook handlers"}
+	rootCmd.AddCommand(hookCmd)
+	// hooks speak JSON over stdout and signal blocking through the exit status,
+	// so the handler writes its own output instead of clicky's formatters
+	var hookOpts cli.PreToolUseOptions
+	preToolUseCmd := &cobra.Command{
+		Use:   "pre-tool-use",
+		Short: "Decide whether Claude Code may run a Bash, Edit or Write tool call",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			os.Exit(cli.RunPreToolUseHook(hookOpts, os.Stdin, os.Stdout, os.Stderr))
+		},
+	}
+	preToolUseCmd.Flags().StringVar(&hookOpts.Unsafe, "unsafe", "deny", "Decision for commands or paths with safety violations (deny, ask)")
+	preToolUseCmd.Flags().StringVar(&hookOpts.Safe, "safe", "allow", "Decision for commands without violations (allow, ask, or none to defer to Claude Code)")
+	preToolUseCmd.Flags().StringVar(&hookOpts.ParseError, "parse-error", "ask", "Decision for bash commands that cannot be parsed (deny, ask)")
+	hookCmd.AddCommand(preToolUseCmd)
 
 	aiCmd := &cobra.Command{Use: "ai", Short: "AI provider commands"}
 	rootCmd.AddCommand(aiCmd)
 	clicky.AddNamedCommand("prompt", aiCmd, cli.AIPromptOptions{}, cli.RunAIPrompt)
 	clicky.AddNamedCommand("models", aiCmd, cli.AIModelsOptions{}, cli.RunAIModels)
 	clicky.AddNamedCommand("test", aiCmd, cli.AITestOptions{}, cli.RunAITest)
+	clicky.AddNamedCommand("spend", aiCmd, cli.AISpendOptions{}, cli.RunAISpend)
+
+	cacheCmd := &cobra.Command{Use: "cache", Short: "Inspect and manage the AI response cache"}
+	aiCmd.AddCommand(cacheCmd)
+	clicky.AddNamedCommand("list", cacheCmd, cli.AICacheListOptions{}, cli.RunAICacheList)
+	clicky.AddNamedCommand("stats", cacheCmd, cli.AICacheStatsOptions{}, cli.RunAICacheStats)
+	clicky.AddNamedCommand("purge", cacheCmd, cli.AICachePurgeOptions{}, cli.RunAICachePurge)
+
+	pricingCmd := &cobra.Command{
+		Use:   "pricing",
+		Short: "Inspect and refresh model pricing",
+		Long:  "Inspect and refresh model pricing. Set " + pricing.OfflineEnv + "=1 to price from the embedded snapshot and ~/.config/captain/pricing.yaml without fetching OpenRouter.",
+	}
+	aiCmd.AddCommand(pricingCmd)
+	clicky.AddNamedCommand("show", pricingCmd, cli.AIPricingShowOptions{}, cli.RunAIPricingShow)
+	clicky.AddNamedCommand("refresh", pricingCmd, cli.AIPricingRefreshOptions{}, cli.RunAIPricingRefresh)
+	clicky.AddNamedCommand("diff", pricingCmd, cli.AIPricingDiffOptions{}, cli.RunAIPricingDiff)
 
 	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)
 	}
+	if budgetErr != nil {
+		os.Exit(budgetErr.ExitCode)
+	}
 }
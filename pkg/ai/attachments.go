@@ -0,0 +1,90 @@
+package ai
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Attachment is a file sent with a message: an image, a PDF or a plain-text
+// document. Providers translate it into their native content blocks.
+type Attachment struct {
+	Name     string // file name, used as the document title where supported
+	MIMEType string
+	Data     []byte
+}
+
+// imageTypes are the image formats accepted by both Anthropic and Gemini.
+var imageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+func (a Attachment) IsImage() bool { return imageTypes[a.MIMEType] }
+func (a Attachment) IsPDF() bool   { return a.MIMEType == "application/pdf" }
+func (a Attachment) IsText() bool  { return strings.HasPrefix(a.MIMEType, "text/") }
+
+// NewAttachment detects the MIME type of data from the file extension of name.
+// Unknown extensions and textual formats such as JSON or YAML fall back to
+// content sniffing, so they are sent as text.
+func NewAttachment(name string, data []byte) (Attachment, error) {
+	byExtension := mime.TypeByExtension(strings.ToLower(filepath.Ext(name)))
+	if a, err := NewAttachmentWithType(name, baseMIMEType(byExtension), data); err == nil {
+		return a, nil
+	}
+	return NewAttachmentWithType(name, baseMIMEType(http.DetectContentType(data)), data)
+}
+
+// NewAttachmentWithType builds an attachment with an explicit MIME type, e.g.
+// for screenshots that arrive as base64 data rather than files.
+func NewAttachmentWithType(name, mimeType string, data []byte) (Attachment, error) {
+	a := Attachment{Name: name, MIMEType: strings.TrimSpace(strings.ToLower(mimeType)), Data: data}
+	if !a.IsImage() && !a.IsPDF() && !a.IsText() {
+		return Attachment{}, fmt.Errorf("%w: %s (%s)", ErrUnsupportedAttachment, name, a.MIMEType)
+	}
+	return a, nil
+}
+
+func baseMIMEType(mimeType string) string {
+	base, _, _ := strings.Cut(mimeType, ";")
+	return base
+}
+
+// LoadAttachment reads the file at path as an attachment.
+func LoadAttachment(path string) (Attachment, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("failed to read attachment: %w", err)
+	}
+	return NewAttachment(filepath.Base(path), data)
+}
+
+// AttachmentMessage returns a user turn with the attachments followed by text.
+func AttachmentMessage(text string, attachments ...Attachment) Message {
+	msg := Message{Role: RoleUser}
+	for _, a := range attachments {
+		msg.Content = append(msg.Content, ContentBlock{Kind: ContentAttachment, Attachment: &a})
+	}
+	if text != "" {
+		msg.Content = append(msg.Content, ContentBlock{Kind: ContentText, Text: text})
+	}
+	return msg
+}
+
+// HasAttachments reports whether any message of the request carries an
+// attachment.
+func (r Request) HasAttachments() bool {
+	for _, msg := range r.AllMessages() {
+		for _, block := range msg.Content {
+			if block.Kind == ContentAttachment {
+				return true
+			}
+		}
+	}
+	return false
+}
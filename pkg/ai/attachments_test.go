@@ -0,0 +1,76 @@
+package ai
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAttachment(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	tests := []struct {
+		name     string
+		data     []byte
+		wantType string
+		wantErr  bool
+	}{
+		{name: "chart.png", data: png, wantType: "image/png"},
+		{name: "CHART.PNG", data: png, wantType: "image/png"},
+		{name: "report.pdf", data: []byte("%PDF-1.7"), wantType: "application/pdf"},
+		{name: "data.json", data: []byte(`{"a":1}`), wantType: "text/plain"},
+		{name: "config.yaml", data: []byte("key: value"), wantType: "text/plain"},
+		{name: "screenshot", data: png, wantType: "image/png"},
+		{name: "archive.zip", data: []byte("PK\x03\x04"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := NewAttachment(tt.name, tt.data)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrUnsupportedAttachment)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantType, a.MIMEType)
+			assert.Equal(t, tt.name, a.Name)
+		})
+	}
+}
+
+func TestNewAttachmentWithType(t *testing.T) {
+	a, err := NewAttachmentWithType("shot", " Image/JPEG ", []byte{0xff, 0xd8})
+	require.NoError(t, err)
+	assert.True(t, a.IsImage())
+
+	_, err = NewAttachmentWithType("movie", "video/mp4", nil)
+	assert.ErrorIs(t, err, ErrUnsupportedAttachment)
+}
+
+func TestLoadAttachment(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	require.NoError(t, os.WriteFile(path, []byte("hello"), 0o600))
+
+	a, err := LoadAttachment(path)
+	require.NoError(t, err)
+	assert.Equal(t, Attachment{Name: "notes.txt", MIMEType: "text/plain", Data: []byte("hello")}, a)
+
+	_, err = LoadAttachment(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+}
+
+func TestRequestAttachments(t *testing.T) {
+	a := Attachment{Name: "notes.txt", MIMEType: "text/plain", Data: []byte("hello")}
+	assert.False(t, Request{Prompt: "hi"}.HasAttachments())
+
+	req := Request{Prompt: "Summarize", Attachments: []Attachment{a}}
+	assert.True(t, req.HasAttachments())
+	assert.Equal(t, []Message{{Role: RoleUser, Content: []ContentBlock{
+		{Kind: ContentAttachment, Attachment: &a},
+		{Kind: ContentText, Text: "Summarize"},
+	}}}, req.AllMessages(), "attachments come before the prompt")
+
+	history := Request{Messages: []Message{AttachmentMessage("", a), AssistantMessage("ok")}}
+	assert.True(t, history.HasAttachments())
+}
@@ -0,0 +1,183 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBatchConcurrency  = 4
+	DefaultBatchPollInterval = 30 * time.Second
+)
+
+// BatchResult is the outcome of one request of a batch; either Response or
+// Err is set.
+type BatchResult struct {
+	Response *Response
+	Err      error
+}
+
+// BatchSummary describes a finished batch to BatchObservers.
+type BatchSummary struct {
+	ID       string // provider batch ID, empty for local batches
+	Backend  Backend
+	Model    string
+	Native   bool // processed by the provider batch API, at the batch service tier rate
+	Requests int
+	Failed   int
+	Usage    Usage
+	Duration time.Duration
+}
+
+// BatchProvider is implemented by providers with an asynchronous batch API,
+// such as Anthropic Message Batches. SubmitBatch blocks until the batch has
+// ended and returns one result per request, in order.
+type BatchProvider interface {
+	Provider
+	SubmitBatch(ctx context.Context, reqs []Request, pollInterval time.Duration) (string, []BatchResult, error)
+}
+
+// BatchObserver is implemented by middleware that accounts for whole batches.
+// ExecuteBatch notifies every observer in the provider chain once.
+type BatchObserver interface {
+	ObserveBatch(summary BatchSummary, results []BatchResult)
+}
+
+// Wrapper is implemented by middleware so ExecuteBatch can reach the
+// providers beneath it.
+type Wrapper interface {
+	Unwrap() Provider
+}
+
+type batchOptions struct {
+	concurrency  int
+	native       bool
+	pollInterval time.Duration
+}
+
+type BatchOption func(*batchOptions)
+
+// WithBatchConcurrency sets how many requests run at once on the local worker
+// pool.
+func WithBatchConcurrency(n int) BatchOption {
+	return func(o *batchOptions) {
+		if n > 0 {
+			o.concurrency = n
+		}
+	}
+}
+
+// WithNativeBatch submits the batch through the provider batch API when the
+// backend has one, polling for completion every pollInterval (0 uses
+// DefaultBatchPollInterval). Native batches bypass the middleware between p
+// and the backend, so their responses are not cached, retried or repaired;
+// only BatchObservers see them.
+func WithNativeBatch(pollInterval time.Duration) BatchOption {
+	return func(o *batchOptions) {
+		o.native = true
+		if pollInterval > 0 {
+			o.pollInterval = pollInterval
+		}
+	}
+}
+
+// ExecuteBatch runs every request and returns the results in the order of
+// reqs. A failed request does not stop the others; its error is returned in
+// its BatchResult.
+func ExecuteBatch(ctx context.Context, p Provider, reqs []Request, opts ...BatchOption) []BatchResult {
+	o := batchOptions{concurrency: DefaultBatchConcurrency, pollInterval: DefaultBatchPollInterval}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	start := time.Now()
+	summary := BatchSummary{Backend: p.GetBackend(), Model: p.GetModel(), Requests: len(reqs)}
+
+	var results []BatchResult
+	if bp := findBatchProvider(p); o.native && bp != nil && len(reqs) > 0 {
+		id, native, err := bp.SubmitBatch(ctx, reqs, o.pollInterval)
+		if err != nil {
+			native = make([]BatchResult, len(reqs))
+			for i := range native {
+				native[i].Err = fmt.Errorf("batch %s failed: %w", id, err)
+			}
+		}
+		results = native
+		summary.ID = id
+		summary.Native = true
+	} else {
+		results = executeLocally(ctx, p, reqs, o.concurrency)
+	}
+
+	for _, r := range results {
+		switch {
+		case r.Err != nil:
+			summary.Failed++
+		case r.Response != nil:
+			summary.Usage = summary.Usage.Add(r.Response.Usage)
+		}
+	}
+	summary.Duration = time.Since(start)
+
+	for _, observer := range batchObservers(p) {
+		observer.ObserveBatch(summary, results)
+	}
+	return results
+}
+
+func executeLocally(ctx context.Context, p Provider, reqs []Request, concurrency int) []BatchResult {
+	results := make([]BatchResult, len(reqs))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for range min(concurrency, len(reqs)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if err := ctx.Err(); err != nil {
+					results[i].Err = fmt.Errorf("%w: %v", ErrTimeout, err)
+					continue
+				}
+				results[i].Response, results[i].Err = p.Execute(ctx, reqs[i])
+			}
+		}()
+	}
+	for i := range reqs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+func findBatchProvider(p Provider) BatchProvider {
+	for p != nil {
+		if bp, ok := p.(BatchProvider); ok {
+			return bp
+		}
+		w, ok := p.(Wrapper)
+		if !ok {
+			return nil
+		}
+		p = w.Unwrap()
+	}
+	return nil
+}
+
+func batchObservers(p Provider) []BatchObserver {
+	var observers []BatchObserver
+	for p != nil {
+		if o, ok := p.(BatchObserver); ok {
+			observers = append(observers, o)
+		}
+		w, ok := p.(Wrapper)
+		if !ok {
+			break
+		}
+		p = w.Unwrap()
+	}
+	return observers
+}
@@ -3,6 +3,7 @@ package ai
 import (
 	"fmt"
 	"os"
+	"strings"
 )
 
 type ProviderFactory func(cfg Config) Provider
@@ -24,7 +25,7 @@ func NewProvider(cfg Config) (Provider, error) {
 	}
 
 	if cfg.Model == "" {
-		return nil, fmt.Errorf("model cannot be empty; specify a model or backend (available: anthropic, gemini, codex-cli, claude-cli, gemini-cli)")
+		return nil, fmt.Errorf("model cannot be empty; specify a model or backend (available: anthropic, gemini, openai, ollama, codex-cli, claude-cli, gemini-cli)")
 	}
 
 	if backend == "" {
@@ -41,7 +42,14 @@ func NewProvider(cfg Config) (Provider, error) {
 		return nil, fmt.Errorf("no provider registered for backend: %s", backend)
 	}
 
-	if cfg.APIKey == "" {
+	// grok models are served by xAI's OpenAI-compatible endpoint, which must
+	// never be sent the OpenAI key
+	if backend == BackendOpenAI && cfg.APIURL == "" && strings.HasPrefix(strings.ToLower(cfg.Model), "grok-") {
+		cfg.APIURL = XAIBaseURL
+		if cfg.APIKey == "" {
+			cfg.APIKey = os.Getenv("XAI_API_KEY")
+		}
+	} else if cfg.APIKey == "" {
 		cfg.APIKey = GetAPIKeyFromEnv(backend)
 	}
 
@@ -52,6 +60,8 @@ func GetAPIKeyFromEnv(backend Backend) string {
 	envVars := map[Backend][]string{
 		BackendAnthropic: {"ANTHROPIC_API_KEY"},
 		BackendGemini:    {"GEMINI_API_KEY", "GOOGLE_API_KEY"},
+		BackendOpenAI:    {"OPENAI_API_KEY"},
+		BackendOllama:    {},
 		BackendGeminiCLI: {},
 		BackendClaudeCLI: {},
 		BackendCodexCLI:  {},
@@ -0,0 +1,56 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Conversation keeps the turns of a multi-turn exchange so follow-up prompts
+// can be sent to any Provider with the full history.
+type Conversation struct {
+	SystemPrompt string
+	MaxTokens    int
+	Temperature  float64
+	Messages     []Message
+}
+
+func NewConversation(systemPrompt string) *Conversation {
+	return &Conversation{SystemPrompt: systemPrompt}
+}
+
+// Send executes prompt against p with the conversation history and, on
+// success, records both the prompt and the assistant reply, with its thinking
+// blocks and tool calls so they are replayed on later turns. A failed call
+// leaves the history unchanged so the prompt can be retried.
+func (c *Conversation) Send(ctx context.Context, p Provider, prompt string) (*Response, error) {
+	resp, err := p.Execute(ctx, c.Request(prompt))
+	if err != nil {
+		return resp, err
+	}
+
+	reply := resp.Message()
+	if resp.Text == "" && resp.StructuredData != nil {
+		data, err := json.Marshal(resp.StructuredData)
+		if err != nil {
+			return resp, fmt.Errorf("failed to record structured reply: %w", err)
+		}
+		reply.Content = append(reply.Content, ContentBlock{Kind: ContentText, Text: string(data)})
+	}
+
+	c.Messages = append(c.Messages, UserMessage(prompt), reply)
+	return resp, nil
+}
+
+// Request builds the request Send would execute for prompt.
+func (c *Conversation) Request(prompt string) Request {
+	history := make([]Message, len(c.Messages))
+	copy(history, c.Messages)
+	return Request{
+		SystemPrompt: c.SystemPrompt,
+		Messages:     history,
+		Prompt:       prompt,
+		MaxTokens:    c.MaxTokens,
+		Temperature:  c.Temperature,
+	}
+}
@@ -0,0 +1,87 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scriptedProvider answers each Execute with the next of replies, or of errs
+// where that is set, and keeps the requests it received.
+type scriptedProvider struct {
+	replies  []*Response
+	errs     []error
+	requests []Request
+}
+
+func (p *scriptedProvider) GetModel() string    { return "scripted" }
+func (p *scriptedProvider) GetBackend() Backend { return BackendAnthropic }
+
+func (p *scriptedProvider) Execute(ctx context.Context, req Request) (*Response, error) {
+	p.requests = append(p.requests, req)
+	i := len(p.requests) - 1
+	if i < len(p.errs) && p.errs[i] != nil {
+		return nil, p.errs[i]
+	}
+	if i >= len(p.replies) {
+		return nil, errors.New("no scripted reply left")
+	}
+	return p.replies[i], nil
+}
+
+func TestConversationSend(t *testing.T) {
+	thinking := Thinking{Text: "France's capital", Signature: "sig"}
+	p := &scriptedProvider{replies: []*Response{
+		{Text: "Paris", ThinkingBlocks: []Thinking{thinking}},
+		{Text: "About 2 million"},
+	}}
+	conv := NewConversation("be brief")
+	conv.MaxTokens = 100
+
+	_, err := conv.Send(context.Background(), p, "Capital of France?")
+	require.NoError(t, err)
+	_, err = conv.Send(context.Background(), p, "Population?")
+	require.NoError(t, err)
+
+	second := p.requests[1]
+	assert.Equal(t, "be brief", second.SystemPrompt)
+	assert.Equal(t, 100, second.MaxTokens)
+	assert.Equal(t, "Population?", second.Prompt)
+	require.Len(t, second.Messages, 2)
+	assert.Equal(t, "Capital of France?", second.Messages[0].Text())
+	assert.Equal(t, Message{Role: RoleAssistant, Content: []ContentBlock{
+		{Kind: ContentThinking, Thinking: &thinking},
+		{Kind: ContentText, Text: "Paris"},
+	}}, second.Messages[1], "thinking blocks are replayed")
+	assert.Len(t, conv.Messages, 4)
+}
+
+func TestConversationSendStructured(t *testing.T) {
+	type Capital struct {
+		City string `json:"city"`
+	}
+	p := &scriptedProvider{replies: []*Response{{StructuredData: &Capital{City: "Paris"}}}}
+	conv := NewConversation("")
+
+	_, err := conv.Send(context.Background(), p, "Capital of France?")
+	require.NoError(t, err)
+	require.Len(t, conv.Messages, 2)
+	assert.Equal(t, `{"city":"Paris"}`, conv.Messages[1].Text())
+}
+
+func TestConversationSendFailureKeepsHistory(t *testing.T) {
+	p := &scriptedProvider{errs: []error{ErrTimeout}, replies: []*Response{nil, {Text: "Paris"}}}
+	conv := NewConversation("")
+
+	_, err := conv.Send(context.Background(), p, "Capital of France?")
+	require.ErrorIs(t, err, ErrTimeout)
+	assert.Empty(t, conv.Messages)
+
+	_, err = conv.Send(context.Background(), p, "Capital of France?")
+	require.NoError(t, err)
+	assert.Empty(t, p.requests[1].Messages, "the failed prompt is not recorded")
+	assert.Len(t, conv.Messages, 2)
+}
@@ -1,13 +1,206 @@
 package ai
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
 
 var (
-	ErrBudgetExceeded    = errors.New("budget exceeded")
-	ErrCLINotFound       = errors.New("CLI tool not found")
+	ErrBudgetExceeded     = errors.New("budget exceeded")
+	ErrCLINotFound        = errors.New("CLI tool not found")
 	ErrCLIExecutionFailed = errors.New("CLI execution failed")
-	ErrTimeout           = errors.New("operation timed out")
-	ErrSchemaValidation  = errors.New("schema validation failed")
-	ErrModelNotFound     = errors.New("model not found in pricing registry")
-	ErrNoAPIKey          = errors.New("API key not found")
+	ErrTimeout            = errors.New("operation timed out")
+	ErrSchemaValidation   = errors.New("schema validation failed")
+	ErrModelNotFound      = errors.New("model not found in pricing registry")
+	ErrNoAPIKey           = errors.New("API key not found")
+	ErrToolsNotSupported  = errors.New("tool calling not supported by backend")
+	ErrToolLoopLimit      = errors.New("tool loop exceeded maximum turns")
+
+	ErrAttachmentsNotSupported = errors.New("attachments not supported by backend")
+	ErrUnsupportedAttachment   = errors.New("unsupported attachment type")
+	ErrReasoningNotSupported   = errors.New("thinking budget or reasoning effort not supported by model")
+)
+
+// SchemaViolation is one failed schema constraint. Pointer is the RFC 6901
+// JSON pointer of the offending value, "" for the document root.
+type SchemaViolation struct {
+	Pointer string
+	Message string
+}
+
+func (v SchemaViolation) String() string {
+	if v.Pointer == "" {
+		return "(root): " + v.Message
+	}
+	return v.Pointer + ": " + v.Message
+}
+
+// SchemaValidationError lists every violation found in a structured response.
+// Output is the model's reply, kept so it can be shown back to the model in a
+// repair turn. Usage is what the rejected reply consumed, so it can still be
+// billed.
+type SchemaValidationError struct {
+	Output     string
+	Violations []SchemaViolation
+	Usage      Usage
+}
+
+func (e *SchemaValidationError) Error() string {
+	violations := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		violations[i] = v.String()
+	}
+	return fmt.Sprintf("%s: %s", ErrSchemaValidation, strings.Join(violations, "; "))
+}
+
+func (e *SchemaValidationError) Unwrap() error { return ErrSchemaValidation }
+
+// AsSchemaValidationError returns the SchemaValidationError in err's chain, if
+// any.
+func AsSchemaValidationError(err error) (*SchemaValidationError, bool) {
+	var serr *SchemaValidationError
+	if errors.As(err, &serr) {
+		return serr, true
+	}
+	return nil, false
+}
+
+type ErrorCategory string
+
+const (
+	CategoryUnknown        ErrorCategory = "unknown"
+	CategoryRateLimit      ErrorCategory = "rate_limit"
+	CategoryAuth           ErrorCategory = "auth"
+	CategoryOverloaded     ErrorCategory = "overloaded"
+	CategoryContextLength  ErrorCategory = "context_length"
+	CategoryInvalidRequest ErrorCategory = "invalid_request"
+	CategoryQuota          ErrorCategory = "quota"
 )
+
+// ProviderError is a classified failure reported by a backend. Err keeps the
+// underlying SDK or sentinel error so errors.Is/As still match it.
+type ProviderError struct {
+	Backend    Backend
+	StatusCode int           // HTTP status, 0 for CLI backends
+	RetryAfter time.Duration // server requested delay, 0 = not specified
+	Category   ErrorCategory
+	Message    string
+	Err        error
+}
+
+func (e *ProviderError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s error", e.Backend, e.Category)
+	if e.StatusCode > 0 {
+		fmt.Fprintf(&sb, " (%d)", e.StatusCode)
+	}
+	if e.Message != "" {
+		sb.WriteString(": " + e.Message)
+	} else if e.Err != nil {
+		sb.WriteString(": " + e.Err.Error())
+	}
+	return sb.String()
+}
+
+func (e *ProviderError) Unwrap() error { return e.Err }
+
+// Retryable reports whether repeating the request can succeed. Auth, quota,
+// context-length and invalid requests fail the same way every time.
+func (e *ProviderError) Retryable() bool {
+	switch e.Category {
+	case CategoryRateLimit, CategoryOverloaded:
+		return true
+	case CategoryUnknown:
+		return e.StatusCode >= 500
+	}
+	return false
+}
+
+// AsProviderError returns the ProviderError in err's chain, if any.
+func AsProviderError(err error) (*ProviderError, bool) {
+	var perr *ProviderError
+	if errors.As(err, &perr) {
+		return perr, true
+	}
+	return nil, false
+}
+
+// errorTypes maps the structured error types and codes backends report to a
+// category: Anthropic error types, OpenAI error types and codes, and Google
+// RPC statuses. Generic types such as invalid_request_error are left to the
+// HTTP status.
+var errorTypes = map[string]ErrorCategory{
+	"rate_limit_error":        CategoryRateLimit,
+	"rate_limit_exceeded":     CategoryRateLimit,
+	"resource_exhausted":      CategoryRateLimit,
+	"overloaded_error":        CategoryOverloaded,
+	"unavailable":             CategoryOverloaded,
+	"authentication_error":    CategoryAuth,
+	"permission_error":        CategoryAuth,
+	"invalid_api_key":         CategoryAuth,
+	"unauthenticated":         CategoryAuth,
+	"permission_denied":       CategoryAuth,
+	"billing_error":           CategoryQuota,
+	"insufficient_quota":      CategoryQuota,
+	"request_too_large":       CategoryContextLength,
+	"context_length_exceeded": CategoryContextLength,
+}
+
+// ClassifyError derives an ErrorCategory from the structured error type or
+// code the backend reported (errType, which may hold several separated by
+// spaces), then from the HTTP status. The message is only searched when
+// neither decides, which is the case for CLI backends that report no status.
+func ClassifyError(statusCode int, errType, message string) ErrorCategory {
+	for _, t := range strings.Fields(strings.ToLower(errType)) {
+		if category, ok := errorTypes[t]; ok {
+			return category
+		}
+	}
+
+	switch {
+	case statusCode == 401 || statusCode == 403:
+		return CategoryAuth
+	case statusCode == 402:
+		return CategoryQuota
+	case statusCode == 413:
+		return CategoryContextLength
+	case statusCode == 429:
+		return CategoryRateLimit
+	case statusCode == 503 || statusCode == 529:
+		return CategoryOverloaded
+	case statusCode >= 400 && statusCode < 500:
+		return CategoryInvalidRequest
+	case statusCode > 0:
+		return CategoryUnknown
+	}
+
+	m := strings.ToLower(message)
+	switch {
+	case containsAny(m, "prompt is too long", "context length", "context window", "context_length",
+		"maximum context", "too many tokens", "input token count", "exceeds the maximum number of tokens"):
+		return CategoryContextLength
+	case containsAny(m, "credit balance", "insufficient_quota", "billing", "quota exceeded", "exceeded your current quota",
+		"daily quota", "usage limit") &&
+		!containsAny(m, "per minute", "per_minute", "perminute"):
+		return CategoryQuota
+	case containsAny(m, "rate limit", "rate_limit", "too many requests", "resource_exhausted", "resource exhausted"):
+		return CategoryRateLimit
+	case containsAny(m, "overloaded", "unavailable", "capacity"):
+		return CategoryOverloaded
+	case containsAny(m, "authentication", "invalid api key", "invalid x-api-key", "api key not valid",
+		"unauthorized", "permission denied", "permission_error", "not logged in", "please log in", "/login"):
+		return CategoryAuth
+	}
+	return CategoryUnknown
+}
+
+func containsAny(s string, substrs ...string) bool {
+	for _, sub := range substrs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
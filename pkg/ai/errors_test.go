@@ -0,0 +1,34 @@
+package ai
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		errType string
+		message string
+		want    ErrorCategory
+	}{
+		{name: "type before status", status: 429, errType: "insufficient_quota insufficient_quota", want: CategoryQuota},
+		{name: "code among the types", status: 400, errType: "invalid_request_error context_length_exceeded", want: CategoryContextLength},
+		{name: "google rpc status", status: 429, errType: "RESOURCE_EXHAUSTED", message: "Quota exceeded", want: CategoryRateLimit},
+		{name: "status before message", status: 400, message: "prompt is too long", want: CategoryInvalidRequest},
+		{name: "server error ignores message", status: 500, message: "rate limit", want: CategoryUnknown},
+		{name: "overloaded status", status: 529, want: CategoryOverloaded},
+		{name: "message without status", message: "Prompt is too long", want: CategoryContextLength},
+		{name: "per-minute quota is a rate limit", message: "Rate limit reached: quota exceeded for 10 requests per minute", want: CategoryRateLimit},
+		{name: "daily quota", message: "daily quota exceeded", want: CategoryQuota},
+		{name: "cli login", message: "Not logged in · Please run /login", want: CategoryAuth},
+		{name: "nothing to go on", message: "something broke", want: CategoryUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ClassifyError(tt.status, tt.errType, tt.message))
+		})
+	}
+}
@@ -1,6 +1,10 @@
 package history
 
-import "time"
+import (
+	"time"
+
+	"github.com/flanksource/captain/pkg/ai/pricing"
+)
 
 type CodexEvent struct {
 	Timestamp string       `json:"timestamp"`
@@ -48,6 +52,9 @@ type CodexPayload struct {
 	Text    string `json:"text,omitempty"`
 	Message string `json:"message,omitempty"`
 
+	// turn_context
+	Model string `json:"model,omitempty"`
+
 	// event_msg: token_count
 	Info *CodexTokenInfo `json:"info,omitempty"`
 
@@ -71,8 +78,20 @@ type CodexTokenInfo struct {
 }
 
 type CodexTokenUsage struct {
-	InputTokens       int `json:"input_tokens"`
-	CachedInputTokens int `json:"cached_input_tokens"`
-	OutputTokens      int `json:"output_tokens"`
-	TotalTokens       int `json:"total_tokens"`
+	InputTokens           int `json:"input_tokens"`
+	CachedInputTokens     int `json:"cached_input_tokens"`
+	OutputTokens          int `json:"output_tokens"`
+	ReasoningOutputTokens int `json:"reasoning_output_tokens"`
+	TotalTokens           int `json:"total_tokens"`
+}
+
+// PricingUsage splits cached input and reasoning output out of codex's
+// totals, which include them, so they are not counted twice.
+func (u CodexTokenUsage) PricingUsage() pricing.Usage {
+	return pricing.Usage{
+		InputTokens:     u.InputTokens - u.CachedInputTokens,
+		OutputTokens:    u.OutputTokens - u.ReasoningOutputTokens,
+		ReasoningTokens: u.ReasoningOutputTokens,
+		CacheReadTokens: u.CachedInputTokens,
+	}
 }
@@ -0,0 +1,87 @@
+package history
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// GeminiSession is a chat recorded by the Gemini CLI under
+// ~/.gemini/tmp/<project hash>/chats.
+type GeminiSession struct {
+	SessionID   string          `json:"sessionId"`
+	ProjectHash string          `json:"projectHash"`
+	StartTime   string          `json:"startTime"`
+	LastUpdated string          `json:"lastUpdated"`
+	Messages    []GeminiMessage `json:"messages"`
+}
+
+type GeminiMessage struct {
+	ID        string        `json:"id"`
+	Timestamp string        `json:"timestamp"`
+	Type      string        `json:"type"` // user, gemini, info or error
+	Model     string        `json:"model,omitempty"`
+	Tokens    *GeminiTokens `json:"tokens,omitempty"`
+}
+
+func (m GeminiMessage) Time() *time.Time {
+	if m.Timestamp == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, m.Timestamp)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// GeminiTokens is the usage of one model response. Input includes Cached;
+// Thoughts and Tool are counted separately from Output and Input.
+type GeminiTokens struct {
+	Input    int `json:"input"`
+	Output   int `json:"output"`
+	Cached   int `json:"cached"`
+	Thoughts int `json:"thoughts"`
+	Tool     int `json:"tool"`
+	Total    int `json:"total"`
+}
+
+func GetGeminiHome() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".gemini")
+}
+
+// GeminiProjectHash returns the hash the Gemini CLI files the chats of a
+// project directory under.
+func GeminiProjectHash(dir string) string {
+	sum := sha256.Sum256([]byte(dir))
+	return hex.EncodeToString(sum[:])
+}
+
+// FindGeminiSessionFiles returns the recorded Gemini CLI chats, only those of
+// projectHash unless it is empty.
+func FindGeminiSessionFiles(projectHash string) ([]string, error) {
+	dir := projectHash
+	if dir == "" {
+		dir = "*"
+	}
+	return filepath.Glob(filepath.Join(GetGeminiHome(), "tmp", dir, "chats", "session-*.json"))
+}
+
+func ReadGeminiSession(path string) (*GeminiSession, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var session GeminiSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
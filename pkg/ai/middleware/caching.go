@@ -3,10 +3,12 @@ package middleware
 import (
 	"context"
 	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"time"
 
 	"github.com/flanksource/captain/pkg/ai"
+	"github.com/flanksource/captain/pkg/ai/provider"
 	"github.com/flanksource/commons/logger"
 )
 
@@ -21,24 +23,42 @@ type cachingProvider struct {
 	ttl      time.Duration
 }
 
-func (c *cachingProvider) GetModel() string      { return c.provider.GetModel() }
+// cachedResponse is the stored form of an ai.Response. StructuredData is kept
+// as raw JSON and decoded into the caller's StructuredOutput on a hit.
+type cachedResponse struct {
+	Text           string          `json:"text,omitempty"`
+	Thinking       string          `json:"thinking,omitempty"`
+	Structured     json.RawMessage `json:"structured,omitempty"`
+	ToolCalls      []ai.ToolCall   `json:"toolCalls,omitempty"`
+	ThinkingBlocks []ai.Thinking   `json:"thinkingBlocks,omitempty"`
+	Model          string          `json:"model"`
+	Backend        ai.Backend      `json:"backend"`
+	Usage          ai.Usage        `json:"usage"`
+	Duration       time.Duration   `json:"duration"`
+}
+
+func (c *cachingProvider) GetModel() string       { return c.provider.GetModel() }
 func (c *cachingProvider) GetBackend() ai.Backend { return c.provider.GetBackend() }
+func (c *cachingProvider) Unwrap() ai.Provider    { return c.provider }
 
 func (c *cachingProvider) Execute(ctx context.Context, req ai.Request) (*ai.Response, error) {
 	if ShouldBypassCache(ctx) {
 		return c.provider.Execute(ctx, req)
 	}
 
-	key := cacheKey(req.Prompt, c.provider.GetModel())
+	key, err := Fingerprint(c.provider.GetBackend(), c.provider.GetModel(), req)
+	if err != nil {
+		logger.Warnf("[%s/%s] cache disabled for request: %v", c.provider.GetBackend(), c.provider.GetModel(), err)
+		return c.provider.Execute(ctx, req)
+	}
 
-	if cached, ok := c.cache.Get(key); ok {
-		logger.Infof("[%s/%s] cache hit", c.provider.GetBackend(), c.provider.GetModel())
-		return &ai.Response{
-			Text:     cached,
-			Model:    c.provider.GetModel(),
-			Backend:  c.provider.GetBackend(),
-			CacheHit: true,
-		}, nil
+	if value, ok := c.cache.Get(key); ok {
+		resp, err := decodeCachedResponse(value, req)
+		if err == nil {
+			logger.Infof("[%s/%s] cache hit", c.provider.GetBackend(), c.provider.GetModel())
+			return resp, nil
+		}
+		logger.Warnf("[%s/%s] ignoring unreadable cache entry: %v", c.provider.GetBackend(), c.provider.GetModel(), err)
 	}
 
 	logger.Debugf("[%s/%s] cache miss", c.provider.GetBackend(), c.provider.GetModel())
@@ -48,16 +68,124 @@ func (c *cachingProvider) Execute(ctx context.Context, req ai.Request) (*ai.Resp
 		return resp, err
 	}
 
-	if resp.Text != "" {
-		c.cache.Set(key, resp.Text, c.ttl)
+	value, err := encodeCachedResponse(resp)
+	if err != nil {
+		logger.Warnf("[%s/%s] response not cached: %v", c.provider.GetBackend(), c.provider.GetModel(), err)
+	} else if value != "" {
+		c.cache.Set(key, value, c.ttl)
 	}
 
 	return resp, nil
 }
 
-func cacheKey(prompt, model string) string {
-	h := sha256.Sum256([]byte(fmt.Sprintf("%s|%s", prompt, model)))
-	return fmt.Sprintf("%x", h)
+// Fingerprint returns a stable hash of everything that can change a model's
+// answer: backend, model, system prompt, the full conversation, sampling
+// parameters, tool declarations and the structured output schema.
+// Request.Metadata is ignored.
+func Fingerprint(backend ai.Backend, model string, req ai.Request) (string, error) {
+	type toolKey struct {
+		Name        string `json:"name"`
+		Description string `json:"description,omitempty"`
+		InputSchema any    `json:"inputSchema,omitempty"`
+	}
+	key := struct {
+		Backend     ai.Backend         `json:"backend"`
+		Model       string             `json:"model"`
+		System      string             `json:"system,omitempty"`
+		Messages    []ai.Message       `json:"messages"`
+		MaxTokens   int                `json:"maxTokens,omitempty"`
+		Temperature float64            `json:"temperature,omitempty"`
+		Thinking    int                `json:"thinking,omitempty"`
+		Effort      ai.ReasoningEffort `json:"effort,omitempty"`
+		Schema      any                `json:"schema,omitempty"`
+		Tools       []toolKey          `json:"tools,omitempty"`
+	}{
+		Backend:     backend,
+		Model:       model,
+		System:      req.SystemPrompt,
+		Messages:    req.AllMessages(),
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+		Thinking:    req.ThinkingBudget,
+		Effort:      req.ReasoningEffort,
+	}
+
+	if req.StructuredOutput != nil {
+		schema, err := provider.GenerateJSONSchema(req.StructuredOutput)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate schema: %w", err)
+		}
+		key.Schema = schema
+	}
+	for _, tool := range req.Tools {
+		key.Tools = append(key.Tools, toolKey{Name: tool.Name, Description: tool.Description, InputSchema: tool.InputSchema})
+	}
+
+	data, err := json.Marshal(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to fingerprint request: %w", err)
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data)), nil
+}
+
+// encodeCachedResponse serialises resp, returning "" for empty responses that
+// are not worth caching.
+func encodeCachedResponse(resp *ai.Response) (string, error) {
+	entry := cachedResponse{
+		Text:           resp.Text,
+		Thinking:       resp.Thinking,
+		ToolCalls:      resp.ToolCalls,
+		ThinkingBlocks: resp.ThinkingBlocks,
+		Model:          resp.Model,
+		Backend:        resp.Backend,
+		Usage:          resp.Usage,
+		Duration:       resp.Duration,
+	}
+	if resp.StructuredData != nil {
+		data, err := json.Marshal(resp.StructuredData)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal structured data: %w", err)
+		}
+		entry.Structured = data
+	}
+	if entry.Text == "" && entry.Structured == nil && len(entry.ToolCalls) == 0 {
+		return "", nil
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func decodeCachedResponse(value string, req ai.Request) (*ai.Response, error) {
+	var entry cachedResponse
+	if err := json.Unmarshal([]byte(value), &entry); err != nil {
+		return nil, err
+	}
+
+	resp := &ai.Response{
+		Text:           entry.Text,
+		Thinking:       entry.Thinking,
+		ToolCalls:      entry.ToolCalls,
+		ThinkingBlocks: entry.ThinkingBlocks,
+		Model:          entry.Model,
+		Backend:        entry.Backend,
+		Usage:          entry.Usage,
+		Duration:       entry.Duration,
+		CacheHit:       true,
+	}
+	if entry.Structured != nil {
+		if req.StructuredOutput == nil {
+			return nil, fmt.Errorf("cached structured response for a text request")
+		}
+		if err := json.Unmarshal(entry.Structured, req.StructuredOutput); err != nil {
+			return nil, fmt.Errorf("%w: %v", ai.ErrSchemaValidation, err)
+		}
+		resp.StructuredData = req.StructuredOutput
+	}
+	return resp, nil
 }
 
 func WithCache(cache Cache, ttl time.Duration) Option {
@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/flanksource/captain/pkg/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type countingProvider struct {
+	calls int
+}
+
+func (c *countingProvider) GetModel() string       { return "test-model" }
+func (c *countingProvider) GetBackend() ai.Backend { return ai.BackendAnthropic }
+
+func (c *countingProvider) Execute(_ context.Context, req ai.Request) (*ai.Response, error) {
+	c.calls++
+	resp := &ai.Response{Model: "test-model", Backend: ai.BackendAnthropic, Usage: ai.Usage{InputTokens: 10, OutputTokens: 5}}
+	if req.StructuredOutput != nil {
+		if err := json.Unmarshal([]byte(`{"answer":"`+req.SystemPrompt+`"}`), req.StructuredOutput); err != nil {
+			return nil, err
+		}
+		resp.StructuredData = req.StructuredOutput
+		return resp, nil
+	}
+	resp.Text = "reply to " + req.SystemPrompt
+	return resp, nil
+}
+
+func TestCachingMiddlewareFingerprint(t *testing.T) {
+	cache, err := NewSQLiteCache(filepath.Join(t.TempDir(), "cache.db"), 0)
+	require.NoError(t, err)
+	defer func() { _ = cache.Close() }()
+
+	inner := &countingProvider{}
+	p, err := Wrap(inner, WithCache(cache, time.Hour))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	first, err := p.Execute(ctx, ai.Request{SystemPrompt: "a", Prompt: "hi"})
+	require.NoError(t, err)
+	assert.False(t, first.CacheHit)
+
+	other, err := p.Execute(ctx, ai.Request{SystemPrompt: "b", Prompt: "hi"})
+	require.NoError(t, err)
+	assert.False(t, other.CacheHit)
+	assert.Equal(t, "reply to b", other.Text)
+
+	hit, err := p.Execute(ctx, ai.Request{SystemPrompt: "a", Prompt: "hi"})
+	require.NoError(t, err)
+	assert.True(t, hit.CacheHit)
+	assert.Equal(t, "reply to a", hit.Text)
+	assert.Equal(t, 10, hit.Usage.InputTokens)
+	assert.Equal(t, 2, inner.calls)
+
+	_, err = p.Execute(ctx, ai.Request{SystemPrompt: "a", Prompt: "hi", Temperature: 0.5})
+	require.NoError(t, err)
+	assert.Equal(t, 3, inner.calls)
+
+	type answer struct {
+		Answer string `json:"answer"`
+	}
+	_, _, err = ai.ExecuteTyped[answer](ctx, p, ai.Request{SystemPrompt: "typed", Prompt: "hi"})
+	require.NoError(t, err)
+	typed, resp, err := ai.ExecuteTyped[answer](ctx, p, ai.Request{SystemPrompt: "typed", Prompt: "hi"})
+	require.NoError(t, err)
+	assert.True(t, resp.CacheHit)
+	assert.Equal(t, "typed", typed.Answer)
+	assert.Equal(t, 4, inner.calls)
+}
@@ -3,9 +3,11 @@ package middleware
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/flanksource/captain/pkg/ai"
 	"github.com/flanksource/captain/pkg/ai/pricing"
+	"github.com/flanksource/captain/pkg/ai/provider"
 	"github.com/flanksource/captain/pkg/ai/session"
 	"github.com/flanksource/commons/logger"
 )
@@ -16,43 +18,85 @@ type costProvider struct {
 	budgetUSD float64
 }
 
-func (c *costProvider) GetModel() string      { return c.provider.GetModel() }
+func (c *costProvider) GetModel() string       { return c.provider.GetModel() }
 func (c *costProvider) GetBackend() ai.Backend { return c.provider.GetBackend() }
+func (c *costProvider) Unwrap() ai.Provider    { return c.provider }
 
 func (c *costProvider) Execute(ctx context.Context, req ai.Request) (*ai.Response, error) {
 	if c.budgetUSD > 0 && c.session.TotalCost() >= c.budgetUSD {
 		return nil, fmt.Errorf("%w: spent $%.4f of $%.4f budget",
 			ai.ErrBudgetExceeded, c.session.TotalCost(), c.budgetUSD)
 	}
+	if err := c.session.CheckBudgets(time.Now()); err != nil {
+		return nil, err
+	}
 
 	resp, err := c.provider.Execute(ctx, req)
 	if err != nil {
+		// replies rejected by schema validation were still billed
+		if serr, ok := ai.AsSchemaValidationError(err); ok && serr.Usage.TotalTokens() > 0 {
+			rejected := &ai.Response{Backend: c.GetBackend(), Model: c.GetModel(), Usage: serr.Usage}
+			if cost, ok := responseCost(rejected); ok {
+				c.session.AddCost(cost)
+			}
+		}
 		return resp, err
 	}
-
-	model := "anthropic/" + resp.Model
-	if resp.Backend == ai.BackendGemini || resp.Backend == ai.BackendGeminiCLI {
-		model = "google/" + resp.Model
+	if resp.CacheHit {
+		// cached responses carry the original usage but are not billed again
+		return resp, nil
 	}
 
-	result, calcErr := pricing.CalculateCost(model,
-		resp.Usage.InputTokens, resp.Usage.OutputTokens,
-		resp.Usage.ReasoningTokens, resp.Usage.CacheReadTokens, resp.Usage.CacheWriteTokens)
+	if cost, ok := responseCost(resp); ok {
+		c.session.AddCost(cost)
+	}
+	return resp, nil
+}
 
-	if calcErr != nil {
-		logger.Debugf("Cost calculation failed for %s: %v", resp.Model, calcErr)
-	} else {
-		c.session.AddCost(ai.Cost{
-			Model:        resp.Model,
-			InputTokens:  result.InputTokens,
-			OutputTokens: result.OutputTokens,
-			TotalTokens:  resp.Usage.TotalTokens(),
-			InputCost:    result.TotalCost * float64(result.InputTokens) / float64(max(result.InputTokens+result.OutputTokens, 1)),
-			OutputCost:   result.TotalCost * float64(result.OutputTokens) / float64(max(result.InputTokens+result.OutputTokens, 1)),
-		})
+// ObserveBatch records the cost of a finished batch in the session. Requests
+// of a local batch were already recorded by Execute; native batch requests
+// never passed through it, so they are recorded here at the batch service
+// tier rate.
+func (c *costProvider) ObserveBatch(summary ai.BatchSummary, results []ai.BatchResult) {
+	batch := session.Batch{
+		ID:       summary.ID,
+		Backend:  summary.Backend,
+		Model:    summary.Model,
+		Native:   summary.Native,
+		Requests: summary.Requests,
+		Failed:   summary.Failed,
+		Duration: summary.Duration,
 	}
+	for _, r := range results {
+		if r.Err != nil || r.Response == nil || r.Response.CacheHit {
+			continue
+		}
+		resp := *r.Response
+		if summary.Native {
+			resp.Usage.ServiceTier = pricing.ServiceTierBatch
+		}
+		cost, ok := responseCost(&resp)
+		if !ok {
+			continue
+		}
+		if summary.Native {
+			c.session.AddCost(cost)
+		}
+		batch.Cost = batch.Cost.Add(cost)
+	}
+	batch.Cost.Model = summary.Model
+	c.session.AddBatch(batch)
+}
 
-	return resp, nil
+// responseCost prices the usage of resp line by line, reporting false when
+// the model has no known pricing.
+func responseCost(resp *ai.Response) (ai.Cost, bool) {
+	cost, err := provider.CalculateCost(resp.Backend, resp.Model, resp.Usage)
+	if err != nil {
+		logger.Debugf("Cost calculation failed for %s: %v", resp.Model, err)
+		return ai.Cost{}, false
+	}
+	return cost, true
 }
 
 func WithCostTracking(sess *session.Session, budgetUSD float64) Option {
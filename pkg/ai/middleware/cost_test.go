@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/flanksource/captain/pkg/ai"
+	"github.com/flanksource/captain/pkg/ai/pricing"
+	"github.com/flanksource/captain/pkg/ai/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	// price with the embedded snapshot only, so results do not follow live prices
+	pricing.SetSources(&pricing.SnapshotSource{})
+	os.Exit(m.Run())
+}
+
+// registerTestPricing prices claude-sonnet-4-6 at $2/$4 per million tokens.
+func registerTestPricing() {
+	pricing.EnsureLoaded()
+	pricing.MergeModels(map[string]*pricing.ModelInfo{
+		"anthropic/claude-sonnet-4.6": {ModelID: "anthropic/claude-sonnet-4.6", InputPrice: 2, OutputPrice: 4},
+	})
+}
+
+func TestExecuteBatchLocal(t *testing.T) {
+	registerTestPricing()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Messages []struct {
+				Content []struct {
+					Text string `json:"text"`
+				} `json:"content"`
+			} `json:"messages"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		prompt := body.Messages[0].Content[0].Text
+
+		w.Header().Set("Content-Type", "application/json")
+		if prompt == "fail" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprint(w, `{"type":"error","error":{"type":"invalid_request_error","message":"bad prompt"}}`)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"id":"m","type":"message","role":"assistant","model":"claude-sonnet-4-6",
+			"content":[{"type":"text","text":"echo %s"}],"usage":{"input_tokens":1000000,"output_tokens":0}}`, prompt)
+	}))
+	defer server.Close()
+
+	sess := session.New("s1", "captain")
+	p, err := NewProvider(ai.Config{
+		Model: "claude-sonnet-4-6", APIKey: "key", APIURL: server.URL, NoCache: true, SchemaRepairs: -1,
+	}, WithCostTracking(sess, 0))
+	require.NoError(t, err)
+
+	prompts := []string{"a", "b", "fail", "c", "d"}
+	reqs := make([]ai.Request, len(prompts))
+	for i, prompt := range prompts {
+		reqs[i] = ai.Request{Prompt: prompt}
+	}
+
+	results := ai.ExecuteBatch(context.Background(), p, reqs, ai.WithBatchConcurrency(3))
+	require.Len(t, results, len(prompts))
+	for i, prompt := range prompts {
+		if prompt == "fail" {
+			perr, ok := ai.AsProviderError(results[i].Err)
+			require.True(t, ok)
+			assert.Equal(t, ai.CategoryInvalidRequest, perr.Category)
+			continue
+		}
+		require.NoError(t, results[i].Err)
+		assert.Equal(t, "echo "+prompt, results[i].Response.Text)
+	}
+
+	assert.Len(t, sess.GetCosts(), 4)
+	batches := sess.GetBatches()
+	require.Len(t, batches, 1)
+	assert.False(t, batches[0].Native)
+	assert.Equal(t, 5, batches[0].Requests)
+	assert.Equal(t, 1, batches[0].Failed)
+	assert.InDelta(t, 8.0, batches[0].Cost.Total(), 1e-9)
+	assert.InDelta(t, 8.0, sess.TotalCost(), 1e-9)
+}
+
+func TestExecuteBatchNativeAnthropic(t *testing.T) {
+	registerTestPricing()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/messages/batches":
+			_, _ = fmt.Fprint(w, `{"id":"msgbatch_1","type":"message_batch","processing_status":"in_progress"}`)
+		case "/v1/messages/batches/msgbatch_1":
+			_, _ = fmt.Fprint(w, `{"id":"msgbatch_1","type":"message_batch","processing_status":"ended"}`)
+		case "/v1/messages/batches/msgbatch_1/results":
+			for _, id := range []string{"1", "0"} {
+				_, _ = fmt.Fprintf(w, `{"custom_id":%q,"result":{"type":"succeeded","message":{"id":"m","type":"message","role":"assistant","model":"claude-sonnet-4-6","content":[{"type":"text","text":"reply %s"}],"usage":{"input_tokens":1000000,"output_tokens":0}}}}`+"\n", id, id)
+			}
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	sess := session.New("s1", "captain")
+	p, err := NewProvider(ai.Config{
+		Model: "claude-sonnet-4-6", APIKey: "key", APIURL: server.URL, NoCache: true,
+	}, WithCostTracking(sess, 0))
+	require.NoError(t, err)
+
+	results := ai.ExecuteBatch(context.Background(), p,
+		[]ai.Request{{Prompt: "first"}, {Prompt: "second"}}, ai.WithNativeBatch(time.Millisecond))
+	require.Len(t, results, 2)
+	require.NoError(t, results[0].Err)
+	assert.Equal(t, "reply 0", results[0].Response.Text)
+	assert.Equal(t, "reply 1", results[1].Response.Text)
+
+	batches := sess.GetBatches()
+	require.Len(t, batches, 1)
+	assert.True(t, batches[0].Native)
+	assert.Equal(t, "msgbatch_1", batches[0].ID)
+	// two requests of 1M input tokens at $2/M, billed at the batch rate
+	assert.InDelta(t, 2.0, batches[0].Cost.Total(), 1e-9)
+	assert.InDelta(t, 2.0, sess.TotalCost(), 1e-9)
+	assert.Len(t, sess.GetCosts(), 2)
+}
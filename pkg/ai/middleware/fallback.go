@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/flanksource/captain/pkg/ai"
+	"github.com/flanksource/captain/pkg/ai/session"
+	"github.com/flanksource/commons/logger"
+)
+
+type fallbackProvider struct {
+	providers []ai.Provider
+}
+
+// GetModel and GetBackend report the primary provider.
+func (f *fallbackProvider) GetModel() string       { return f.providers[0].GetModel() }
+func (f *fallbackProvider) GetBackend() ai.Backend { return f.providers[0].GetBackend() }
+func (f *fallbackProvider) Unwrap() ai.Provider    { return f.providers[0] }
+
+// Close releases the databases opened for each provider of the chain.
+func (f *fallbackProvider) Close() error {
+	var errs []error
+	for _, p := range f.providers {
+		errs = append(errs, Close(p))
+	}
+	return errors.Join(errs...)
+}
+
+func (f *fallbackProvider) Execute(ctx context.Context, req ai.Request) (*ai.Response, error) {
+	var attempts []ai.Attempt
+	var errs []error
+
+	for i, p := range f.providers {
+		resp, err := p.Execute(ctx, req)
+		if err == nil {
+			if resp.Backend == "" {
+				resp.Backend = p.GetBackend()
+			}
+			if resp.Model == "" {
+				resp.Model = p.GetModel()
+			}
+			resp.Attempts = append(attempts, resp.Attempts...)
+			return resp, nil
+		}
+
+		attempts = append(attempts, ai.Attempt{Backend: p.GetBackend(), Model: p.GetModel(), Error: err.Error()})
+		errs = append(errs, fmt.Errorf("%s/%s: %w", p.GetBackend(), p.GetModel(), err))
+
+		if ctx.Err() != nil || !shouldFailover(err) || i == len(f.providers)-1 {
+			break
+		}
+		next := f.providers[i+1]
+		logger.Warnf("[%s/%s] failed, falling back to %s/%s: %v",
+			p.GetBackend(), p.GetModel(), next.GetBackend(), next.GetModel(), err)
+	}
+
+	if len(errs) == 1 {
+		return nil, errs[0]
+	}
+	return nil, errors.Join(errs...)
+}
+
+// shouldFailover reports whether another backend or model may succeed where
+// this one failed: missing CLIs or keys, unsupported features, timeouts and
+// every classified provider failure except a malformed request.
+func shouldFailover(err error) bool {
+	if perr, ok := ai.AsProviderError(err); ok {
+		return perr.Category != ai.CategoryInvalidRequest
+	}
+	return errors.Is(err, ai.ErrCLINotFound) ||
+		errors.Is(err, ai.ErrNoAPIKey) ||
+		errors.Is(err, ai.ErrToolsNotSupported) ||
+		errors.Is(err, ai.ErrAttachmentsNotSupported) ||
+		errors.Is(err, ai.ErrReasoningNotSupported) ||
+		errors.Is(err, ai.ErrTimeout) ||
+		errors.Is(err, ai.ErrCLIExecutionFailed)
+}
+
+// WithFallback tries each of fallbacks in order when the wrapped provider
+// fails with an error another backend could avoid. Each config's concurrency,
+// schema repair and cache TTL settings apply, but the fallbacks share the
+// response cache and spend session of the wrapped provider instead of opening
+// their own. Response.Backend and Response.Model identify the provider that
+// answered and Response.Attempts lists the failures before it.
+func WithFallback(fallbacks ...ai.Config) Option {
+	return func(p ai.Provider) (ai.Provider, error) {
+		cache, sess, budgetUSD := sharedMiddleware(p)
+		providers := []ai.Provider{p}
+		for _, cfg := range fallbacks {
+			fp, err := ai.NewProvider(cfg)
+			if err == nil {
+				fp, err = Wrap(fp, configOptions(cfg, cache, sess, budgetUSD)...)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("fallback %s: %w", cfg.Model, err)
+			}
+			providers = append(providers, fp)
+		}
+		return &fallbackProvider{providers: providers}, nil
+	}
+}
+
+// sharedMiddleware returns the response cache and the cost tracking session
+// and budget found in p's middleware chain, if any.
+func sharedMiddleware(p ai.Provider) (cache Cache, sess *session.Session, budgetUSD float64) {
+	for p != nil {
+		switch v := p.(type) {
+		case *cachingProvider:
+			if cache == nil {
+				cache = v.cache
+			}
+		case *costProvider:
+			if sess == nil {
+				sess, budgetUSD = v.session, v.budgetUSD
+			}
+		}
+		w, ok := p.(ai.Wrapper)
+		if !ok {
+			break
+		}
+		p = w.Unwrap()
+	}
+	return cache, sess, budgetUSD
+}
+
+// NewFallbackProvider builds a provider from an ordered list of configs, the
+// first being the primary, e.g. claude-sonnet-4-6 then gemini-2.5-flash then
+// claude-code-sonnet. options wrap the whole chain.
+func NewFallbackProvider(configs []ai.Config, options ...Option) (ai.Provider, error) {
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("at least one provider config is required")
+	}
+	primary, err := NewProvider(configs[0])
+	if err != nil {
+		return nil, err
+	}
+	return Wrap(primary, append([]Option{WithFallback(configs[1:]...)}, options...)...)
+}
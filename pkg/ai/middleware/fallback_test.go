@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flanksource/captain/pkg/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFallbackProvider(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"id":"m","type":"message","role":"assistant","model":"claude-sonnet-4-6",
+			"content":[{"type":"text","text":"hello"}],"usage":{"input_tokens":3,"output_tokens":1}}`)
+	}))
+	defer server.Close()
+
+	p, err := NewFallbackProvider([]ai.Config{
+		{Model: "claude-code-sonnet"},
+		{Model: "claude-sonnet-4-6", APIKey: "key", APIURL: server.URL},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, ai.BackendClaudeCLI, p.GetBackend())
+
+	resp, err := p.Execute(context.Background(), ai.Request{Prompt: "hi"})
+	require.NoError(t, err)
+	assert.Equal(t, "hello", resp.Text)
+	assert.Equal(t, ai.BackendAnthropic, resp.Backend)
+	require.Len(t, resp.Attempts, 1)
+	assert.Equal(t, ai.BackendClaudeCLI, resp.Attempts[0].Backend)
+	assert.Contains(t, resp.Attempts[0].Error, ai.ErrCLINotFound.Error())
+}
+
+func TestFallbackStopsOnInvalidRequest(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprint(w, `{"type":"error","error":{"type":"invalid_request_error","message":"messages: field required"}}`)
+	}))
+	defer server.Close()
+
+	p, err := NewFallbackProvider([]ai.Config{
+		{Model: "claude-sonnet-4-6", APIKey: "key", APIURL: server.URL},
+		{Model: "claude-haiku-4-5", APIKey: "key", APIURL: server.URL},
+	})
+	require.NoError(t, err)
+
+	_, err = p.Execute(context.Background(), ai.Request{Prompt: "hi"})
+	perr, ok := ai.AsProviderError(err)
+	require.True(t, ok)
+	assert.Equal(t, ai.CategoryInvalidRequest, perr.Category)
+	assert.Equal(t, 1, calls)
+}
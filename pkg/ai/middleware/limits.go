@@ -0,0 +1,338 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/flanksource/captain/pkg/ai"
+	"github.com/flanksource/commons/logger"
+)
+
+// QueueReporter is implemented by the limiting middleware so callers can log
+// how many requests are waiting for capacity.
+type QueueReporter interface {
+	QueueDepth() int
+}
+
+// limiterKey scopes limiters to a backend/model pair so that every provider
+// for the same model shares one limit.
+func limiterKey(p ai.Provider) string {
+	return fmt.Sprintf("%s/%s", p.GetBackend(), p.GetModel())
+}
+
+// semaphore admits up to size holders at once. Its size can change while it
+// is in use: holders beyond a smaller size finish normally and no one new is
+// admitted until enough of them have released.
+type semaphore struct {
+	mu      sync.Mutex
+	size    int
+	used    int
+	freed   chan struct{} // closed when a slot may have become available
+	waiting atomic.Int32
+}
+
+func newSemaphore(size int) *semaphore {
+	return &semaphore{size: size, freed: make(chan struct{})}
+}
+
+// tryAcquire takes a slot if one is free, otherwise it returns the channel
+// that is closed on the next release or resize.
+func (s *semaphore) tryAcquire() (bool, <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.used < s.size {
+		s.used++
+		return true, nil
+	}
+	return false, s.freed
+}
+
+func (s *semaphore) acquire(ctx context.Context) error {
+	ok, freed := s.tryAcquire()
+	if ok {
+		return nil
+	}
+
+	s.waiting.Add(1)
+	defer s.waiting.Add(-1)
+	for {
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return fmt.Errorf("%w: waiting for concurrency slot: %v", ai.ErrTimeout, ctx.Err())
+		}
+		if ok, freed = s.tryAcquire(); ok {
+			return nil
+		}
+	}
+}
+
+func (s *semaphore) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.used--
+	s.wake()
+}
+
+func (s *semaphore) resize(size int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.size = size
+	s.wake()
+}
+
+// wake lets every waiter retry; s.mu must be held.
+func (s *semaphore) wake() {
+	close(s.freed)
+	s.freed = make(chan struct{})
+}
+
+var (
+	semaphoresMu sync.Mutex
+	semaphores   = map[string]*semaphore{}
+)
+
+// sharedSemaphore returns the semaphore for key, resizing it to size when it
+// already exists with another size.
+func sharedSemaphore(key string, size int) *semaphore {
+	semaphoresMu.Lock()
+	defer semaphoresMu.Unlock()
+	if s, ok := semaphores[key]; ok {
+		if s.size != size {
+			logger.Debugf("[%s] concurrency limit changed from %d to %d", key, s.size, size)
+			s.resize(size)
+		}
+		return s
+	}
+	s := newSemaphore(size)
+	semaphores[key] = s
+	return s
+}
+
+type concurrencyProvider struct {
+	provider ai.Provider
+	sem      *semaphore
+}
+
+func (c *concurrencyProvider) GetModel() string       { return c.provider.GetModel() }
+func (c *concurrencyProvider) GetBackend() ai.Backend { return c.provider.GetBackend() }
+func (c *concurrencyProvider) Unwrap() ai.Provider    { return c.provider }
+func (c *concurrencyProvider) QueueDepth() int        { return int(c.sem.waiting.Load()) }
+
+func (c *concurrencyProvider) Execute(ctx context.Context, req ai.Request) (*ai.Response, error) {
+	if depth := c.QueueDepth(); depth > 0 {
+		logger.Debugf("[%s] waiting for concurrency slot (%d queued)", limiterKey(c.provider), depth)
+	}
+	if err := c.sem.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer c.sem.release()
+	return c.provider.Execute(ctx, req)
+}
+
+// WithConcurrency limits the number of in-flight requests per backend/model to
+// limit. The limit is shared by every provider wrapped for the same backend and
+// model; wrapping one with a different limit changes it for all of them.
+// limit <= 0 disables it.
+func WithConcurrency(limit int) Option {
+	return func(p ai.Provider) (ai.Provider, error) {
+		if limit <= 0 {
+			return p, nil
+		}
+		return &concurrencyProvider{provider: p, sem: sharedSemaphore(limiterKey(p), limit)}, nil
+	}
+}
+
+type RateLimitConfig struct {
+	RequestsPerMinute int // 0 = unlimited
+	TokensPerMinute   int // 0 = unlimited
+}
+
+// bucket is a token bucket refilled continuously at capacity per minute.
+// Its level may go negative when actual usage exceeds the reservation.
+type bucket struct {
+	capacity float64
+	level    float64
+	updated  time.Time
+}
+
+func newBucket(perMinute int) *bucket {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &bucket{capacity: float64(perMinute), level: float64(perMinute), updated: time.Now()}
+}
+
+// resizeBucket changes the capacity of b to perMinute, keeping its level, or
+// creates or drops it when the limit is switched on or off.
+func resizeBucket(b *bucket, perMinute int, now time.Time) *bucket {
+	if b == nil || perMinute <= 0 {
+		return newBucket(perMinute)
+	}
+	b.refill(now)
+	b.capacity = float64(perMinute)
+	b.level = math.Min(b.level, b.capacity)
+	return b
+}
+
+func (b *bucket) refill(now time.Time) {
+	b.level = math.Min(b.capacity, b.level+now.Sub(b.updated).Minutes()*b.capacity)
+	b.updated = now
+}
+
+// wait returns how long until the bucket holds n, or 0 if it already does.
+func (b *bucket) wait(n float64) time.Duration {
+	if b == nil || b.level >= n {
+		return 0
+	}
+	return time.Duration((n - b.level) / b.capacity * float64(time.Minute))
+}
+
+type rateLimiter struct {
+	config   RateLimitConfig
+	mu       sync.Mutex
+	requests *bucket
+	tokens   *bucket
+	waiting  atomic.Int32
+}
+
+// reserve blocks until one request and the estimated tokens are available,
+// deducts them and returns the tokens reserved. Estimates larger than the
+// bucket are capped so oversized requests can still proceed.
+func (r *rateLimiter) reserve(ctx context.Context, estimate int) (int, error) {
+	for {
+		r.mu.Lock()
+		now := time.Now()
+		need := float64(estimate)
+		if r.tokens != nil {
+			r.tokens.refill(now)
+			need = math.Min(need, r.tokens.capacity)
+		}
+		if r.requests != nil {
+			r.requests.refill(now)
+		}
+		delay := max(r.requests.wait(1), r.tokens.wait(need))
+		if delay == 0 {
+			if r.requests != nil {
+				r.requests.level--
+			}
+			if r.tokens != nil {
+				r.tokens.level -= need
+			}
+			r.mu.Unlock()
+			return int(need), nil
+		}
+		r.mu.Unlock()
+
+		r.waiting.Add(1)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			r.waiting.Add(-1)
+			return 0, fmt.Errorf("%w: waiting for rate limit: %v", ai.ErrTimeout, ctx.Err())
+		case <-timer.C:
+			r.waiting.Add(-1)
+		}
+	}
+}
+
+// settle charges the difference between actual and reserved tokens.
+func (r *rateLimiter) settle(reserved, actual int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.tokens == nil {
+		return
+	}
+	r.tokens.level -= float64(actual - reserved)
+}
+
+var (
+	rateLimitersMu sync.Mutex
+	rateLimiters   = map[string]*rateLimiter{}
+)
+
+// resize applies config to the limiter, keeping what was already consumed.
+func (r *rateLimiter) resize(config RateLimitConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	r.requests = resizeBucket(r.requests, config.RequestsPerMinute, now)
+	r.tokens = resizeBucket(r.tokens, config.TokensPerMinute, now)
+	r.config = config
+}
+
+// sharedRateLimiter returns the rate limiter for key, applying config when it
+// already exists with other limits.
+func sharedRateLimiter(key string, config RateLimitConfig) *rateLimiter {
+	rateLimitersMu.Lock()
+	defer rateLimitersMu.Unlock()
+	if r, ok := rateLimiters[key]; ok {
+		if r.config != config {
+			logger.Debugf("[%s] rate limit changed from %d to %d requests and %d to %d tokens per minute", key,
+				r.config.RequestsPerMinute, config.RequestsPerMinute, r.config.TokensPerMinute, config.TokensPerMinute)
+			r.resize(config)
+		}
+		return r
+	}
+	r := &rateLimiter{config: config, requests: newBucket(config.RequestsPerMinute), tokens: newBucket(config.TokensPerMinute)}
+	rateLimiters[key] = r
+	return r
+}
+
+type rateLimitProvider struct {
+	provider ai.Provider
+	limiter  *rateLimiter
+}
+
+func (r *rateLimitProvider) GetModel() string       { return r.provider.GetModel() }
+func (r *rateLimitProvider) GetBackend() ai.Backend { return r.provider.GetBackend() }
+func (r *rateLimitProvider) Unwrap() ai.Provider    { return r.provider }
+func (r *rateLimitProvider) QueueDepth() int        { return int(r.limiter.waiting.Load()) }
+
+func (r *rateLimitProvider) Execute(ctx context.Context, req ai.Request) (*ai.Response, error) {
+	if depth := r.QueueDepth(); depth > 0 {
+		logger.Debugf("[%s] waiting for rate limit (%d queued)", limiterKey(r.provider), depth)
+	}
+
+	reserved, err := r.limiter.reserve(ctx, estimateTokens(req))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.provider.Execute(ctx, req)
+	if resp != nil {
+		r.limiter.settle(reserved, resp.Usage.TotalTokens())
+	}
+	return resp, err
+}
+
+// estimateTokens approximates the input size of req at four characters per
+// token; the reservation is corrected from the reported usage afterwards.
+func estimateTokens(req ai.Request) int {
+	chars := len(req.SystemPrompt)
+	for _, msg := range req.AllMessages() {
+		chars += len(msg.Text())
+	}
+	return chars/4 + 1
+}
+
+// WithRateLimit limits requests and tokens per minute per backend/model. Token
+// usage is estimated before each request and corrected once the response
+// reports actual usage. The limiter is shared by every provider wrapped for
+// the same backend and model; wrapping one with different limits changes them
+// for all of them.
+func WithRateLimit(config RateLimitConfig) Option {
+	return func(p ai.Provider) (ai.Provider, error) {
+		if config.RequestsPerMinute <= 0 && config.TokensPerMinute <= 0 {
+			return p, nil
+		}
+		config.RequestsPerMinute = max(config.RequestsPerMinute, 0)
+		config.TokensPerMinute = max(config.TokensPerMinute, 0)
+		return &rateLimitProvider{provider: p, limiter: sharedRateLimiter(limiterKey(p), config)}, nil
+	}
+}
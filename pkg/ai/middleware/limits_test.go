@@ -0,0 +1,181 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/flanksource/captain/pkg/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingProvider holds each request until release is closed, tracking the
+// most requests it saw in flight at once.
+type blockingProvider struct {
+	model    string
+	usage    ai.Usage
+	release  chan struct{}
+	inFlight atomic.Int32
+	peak     atomic.Int32
+}
+
+func (b *blockingProvider) GetModel() string       { return b.model }
+func (b *blockingProvider) GetBackend() ai.Backend { return ai.BackendAnthropic }
+
+func (b *blockingProvider) Execute(ctx context.Context, req ai.Request) (*ai.Response, error) {
+	n := b.inFlight.Add(1)
+	defer b.inFlight.Add(-1)
+	for {
+		peak := b.peak.Load()
+		if n <= peak || b.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	if b.release != nil {
+		<-b.release
+	}
+	return &ai.Response{Text: "ok", Model: b.model, Usage: b.usage}, nil
+}
+
+// resetLimiters gives the test empty limiter registries, so limits set by
+// other tests do not apply.
+func resetLimiters(t *testing.T) {
+	reset := func() {
+		semaphoresMu.Lock()
+		semaphores = map[string]*semaphore{}
+		semaphoresMu.Unlock()
+		rateLimitersMu.Lock()
+		rateLimiters = map[string]*rateLimiter{}
+		rateLimitersMu.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	resetLimiters(t)
+	inner := &blockingProvider{model: "m", release: make(chan struct{})}
+	p, err := Wrap(inner, WithConcurrency(2))
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := p.Execute(context.Background(), ai.Request{Prompt: "hi"})
+			assert.NoError(t, err)
+		}()
+	}
+	require.Eventually(t, func() bool { return p.(QueueReporter).QueueDepth() == 3 }, time.Second, time.Millisecond)
+	close(inner.release)
+	wg.Wait()
+	assert.Equal(t, int32(2), inner.peak.Load())
+
+	// providers of the same model share the limit, and the latest one sets it
+	inner = &blockingProvider{model: "m", release: make(chan struct{})}
+	resized, err := Wrap(inner, WithConcurrency(3))
+	require.NoError(t, err)
+	assert.Same(t, p.(*concurrencyProvider).sem, resized.(*concurrencyProvider).sem)
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := resized.Execute(context.Background(), ai.Request{Prompt: "hi"})
+			assert.NoError(t, err)
+		}()
+	}
+	require.Eventually(t, func() bool { return p.(QueueReporter).QueueDepth() == 2 }, time.Second, time.Millisecond)
+	close(inner.release)
+	wg.Wait()
+	assert.Equal(t, int32(3), inner.peak.Load())
+}
+
+func TestConcurrencyLimitShrinks(t *testing.T) {
+	resetLimiters(t)
+	inner := &blockingProvider{model: "m", release: make(chan struct{})}
+	p, err := Wrap(inner, WithConcurrency(2))
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = p.Execute(context.Background(), ai.Request{Prompt: "hi"})
+		}()
+	}
+	require.Eventually(t, func() bool { return inner.inFlight.Load() == 2 }, time.Second, time.Millisecond)
+
+	// the running requests finish, new ones wait until only one is in flight
+	_, err = Wrap(&blockingProvider{model: "m"}, WithConcurrency(1))
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = p.Execute(ctx, ai.Request{Prompt: "hi"})
+	assert.ErrorIs(t, err, ai.ErrTimeout)
+
+	close(inner.release)
+	wg.Wait()
+	_, err = p.Execute(context.Background(), ai.Request{Prompt: "hi"})
+	assert.NoError(t, err)
+}
+
+func TestConcurrencyLimitTimeout(t *testing.T) {
+	resetLimiters(t)
+	inner := &blockingProvider{model: "m", release: make(chan struct{})}
+	defer close(inner.release)
+	p, err := Wrap(inner, WithConcurrency(1))
+	require.NoError(t, err)
+
+	go func() { _, _ = p.Execute(context.Background(), ai.Request{Prompt: "hi"}) }()
+	require.Eventually(t, func() bool { return inner.inFlight.Load() == 1 }, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = p.Execute(ctx, ai.Request{Prompt: "hi"})
+	assert.ErrorIs(t, err, ai.ErrTimeout)
+}
+
+func TestRateLimit(t *testing.T) {
+	resetLimiters(t)
+	p, err := Wrap(&blockingProvider{model: "m"}, WithRateLimit(RateLimitConfig{RequestsPerMinute: 1}))
+	require.NoError(t, err)
+
+	_, err = p.Execute(context.Background(), ai.Request{Prompt: "hi"})
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = p.Execute(ctx, ai.Request{Prompt: "hi"})
+	assert.ErrorIs(t, err, ai.ErrTimeout, "the second request waits a minute for the bucket to refill")
+
+	// the latest limits apply to every provider of the model, keeping the
+	// request already made
+	resized, err := Wrap(&blockingProvider{model: "m"}, WithRateLimit(RateLimitConfig{RequestsPerMinute: 2}))
+	require.NoError(t, err)
+	limiter := p.(*rateLimitProvider).limiter
+	assert.Same(t, limiter, resized.(*rateLimitProvider).limiter)
+	assert.Equal(t, 2.0, limiter.requests.capacity)
+	assert.Less(t, limiter.requests.level, 1.0)
+}
+
+func TestTokenRateLimitSettlesActualUsage(t *testing.T) {
+	// 6000 tokens per minute refill at 100 per second
+	resetLimiters(t)
+	inner := &blockingProvider{model: "m", usage: ai.Usage{InputTokens: 6000}}
+	p, err := Wrap(inner, WithRateLimit(RateLimitConfig{TokensPerMinute: 6000}))
+	require.NoError(t, err)
+
+	_, err = p.Execute(context.Background(), ai.Request{Prompt: "hi"})
+	require.NoError(t, err)
+
+	// the first response used the whole minute's tokens, so the next request
+	// waits for its estimate to refill
+	start := time.Now()
+	_, err = p.Execute(context.Background(), ai.Request{Prompt: "hi"})
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 5*time.Millisecond)
+}
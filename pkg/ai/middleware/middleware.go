@@ -2,8 +2,13 @@ package middleware
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 
 	"github.com/flanksource/captain/pkg/ai"
+	"github.com/flanksource/captain/pkg/ai/session"
+	"github.com/flanksource/commons/logger"
 )
 
 type Option func(ai.Provider) (ai.Provider, error)
@@ -19,6 +24,154 @@ func Wrap(provider ai.Provider, options ...Option) (ai.Provider, error) {
 	return provider, nil
 }
 
+// NewProvider creates the provider for cfg, wraps it with the middleware the
+// config enables (the MaxConcurrent limit, schema repair turns, the persistent
+// cache at CacheDBPath unless NoCache is set, then cost tracking when a ledger
+// or budget is set) and then applies options. Cache hits do not take a
+// concurrency slot and are not billed, and only repaired responses are cached.
+// A cache or ledger that cannot be opened is skipped with a warning. Release
+// the databases it opened with Close.
+func NewProvider(cfg ai.Config, options ...Option) (ai.Provider, error) {
+	provider, err := ai.NewProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var closers []io.Closer
+	var cache Cache
+	var sess *session.Session
+	if cfg.CacheDBPath != "" && !cfg.NoCache {
+		sqlite, err := NewSQLiteCache(cfg.CacheDBPath, cfg.CacheMaxSize)
+		if err != nil {
+			logger.Warnf("Response cache disabled: %v", err)
+		} else {
+			closers = append(closers, sqlite)
+			cache = sqlite
+		}
+	}
+	if cfg.LedgerPath != "" || cfg.BudgetUSD > 0 || len(session.BudgetsFromConfig(cfg)) > 0 {
+		sess, err = configSession(cfg)
+		if err != nil {
+			_ = closeAll(closers)
+			return nil, err
+		}
+		if sess.Ledger != nil {
+			closers = append(closers, sess.Ledger)
+		}
+	}
+
+	configured := configOptions(cfg, cache, sess, cfg.BudgetUSD)
+	if len(closers) > 0 {
+		configured = append(configured, withClosers(closers...))
+	}
+
+	p, err := Wrap(provider, append(configured, options...)...)
+	if err != nil {
+		_ = closeAll(closers)
+		return nil, err
+	}
+	return p, nil
+}
+
+// configOptions returns the middleware cfg enables, in the order NewProvider
+// applies it, caching in cache and tracking cost in sess when they are set.
+func configOptions(cfg ai.Config, cache Cache, sess *session.Session, budgetUSD float64) []Option {
+	var configured []Option
+	if cfg.MaxConcurrent > 0 {
+		configured = append(configured, WithConcurrency(cfg.MaxConcurrent))
+	}
+	switch {
+	case cfg.SchemaRepairs == 0:
+		configured = append(configured, WithSchemaRepair(DefaultSchemaRepairs))
+	case cfg.SchemaRepairs > 0:
+		configured = append(configured, WithSchemaRepair(cfg.SchemaRepairs))
+	}
+	if cache != nil && !cfg.NoCache {
+		configured = append(configured, WithCache(cache, cfg.CacheTTL))
+	}
+	if sess != nil {
+		configured = append(configured, WithCostTracking(sess, budgetUSD))
+	}
+	return configured
+}
+
+// closingProvider releases the databases NewProvider opened for the
+// providers beneath it.
+type closingProvider struct {
+	provider ai.Provider
+	closers  []io.Closer
+}
+
+func (c *closingProvider) GetModel() string       { return c.provider.GetModel() }
+func (c *closingProvider) GetBackend() ai.Backend { return c.provider.GetBackend() }
+func (c *closingProvider) Unwrap() ai.Provider    { return c.provider }
+func (c *closingProvider) Close() error           { return closeAll(c.closers) }
+
+func (c *closingProvider) Execute(ctx context.Context, req ai.Request) (*ai.Response, error) {
+	return c.provider.Execute(ctx, req)
+}
+
+func withClosers(closers ...io.Closer) Option {
+	return func(p ai.Provider) (ai.Provider, error) {
+		return &closingProvider{provider: p, closers: closers}, nil
+	}
+}
+
+func closeAll(closers []io.Closer) error {
+	var errs []error
+	for _, c := range closers {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Close releases the cache and ledger databases NewProvider opened for p,
+// including those of the providers it falls back to. Providers that opened
+// nothing are left alone.
+func Close(p ai.Provider) error {
+	var errs []error
+	for p != nil {
+		switch v := p.(type) {
+		case *fallbackProvider:
+			// the fallback closes every member, the primary included
+			return errors.Join(append(errs, v.Close())...)
+		case *closingProvider:
+			errs = append(errs, v.Close())
+		}
+		w, ok := p.(ai.Wrapper)
+		if !ok {
+			break
+		}
+		p = w.Unwrap()
+	}
+	return errors.Join(errs...)
+}
+
+// configSession creates the session for cfg's cost tracking, recording spend
+// in the ledger at LedgerPath. A ledger that cannot be opened is skipped with
+// a warning, unless the budgets need it.
+func configSession(cfg ai.Config) (*session.Session, error) {
+	sess := session.New(cfg.SessionID, cfg.ProjectName)
+	sess.Budgets = session.BudgetsFromConfig(cfg)
+	if cfg.LedgerPath == "" {
+		if len(sess.Budgets) > 0 {
+			return nil, fmt.Errorf("daily, weekly and monthly budgets require a LedgerPath")
+		}
+		return sess, nil
+	}
+
+	ledger, err := session.OpenLedger(cfg.LedgerPath)
+	switch {
+	case err == nil:
+		sess.Ledger = ledger
+	case len(sess.Budgets) > 0:
+		return nil, err
+	default:
+		logger.Warnf("Spend ledger disabled: %v", err)
+	}
+	return sess, nil
+}
+
 type contextKey string
 
 const (
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/flanksource/captain/pkg/ai"
+	"github.com/flanksource/captain/pkg/ai/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewProviderWithoutDatabases(t *testing.T) {
+	// neither database can be created beneath a file
+	blocker := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(blocker, nil, 0o644))
+	cfg := ai.Config{Model: "claude-sonnet-4-6", APIKey: "key",
+		CacheDBPath: filepath.Join(blocker, "cache.db"), LedgerPath: filepath.Join(blocker, "spend.db")}
+
+	p, err := NewProvider(cfg)
+	require.NoError(t, err)
+	tracked := false
+	for w, ok := p.(ai.Wrapper); ok; w, ok = p.(ai.Wrapper) {
+		_, cached := p.(*cachingProvider)
+		require.False(t, cached, "unopenable cache is skipped")
+		if cp, ok := p.(*costProvider); ok {
+			tracked = true
+			require.Nil(t, cp.session.Ledger, "unopenable ledger is skipped")
+		}
+		p = w.Unwrap()
+	}
+	require.True(t, tracked, "costs are still tracked in memory")
+
+	// window budgets cannot be enforced without the ledger
+	cfg.DailyBudgetUSD = 1
+	_, err = NewProvider(cfg)
+	require.ErrorContains(t, err, "failed to create ledger directory")
+}
+
+func TestCloseReleasesDatabases(t *testing.T) {
+	dir := t.TempDir()
+	primary := ai.Config{Model: "claude-sonnet-4-6", APIKey: "key", CacheDBPath: filepath.Join(dir, "primary.db"), LedgerPath: filepath.Join(dir, "spend?#1.db")}
+	fallback := ai.Config{Model: "claude-haiku-4-5", APIKey: "key", CacheDBPath: filepath.Join(dir, "fallback.db")}
+	p, err := NewFallbackProvider([]ai.Config{primary, fallback}, WithLogging())
+	require.NoError(t, err)
+
+	var caches []*SQLiteCache
+	var sessions []*session.Session
+	var collect func(ai.Provider)
+	collect = func(p ai.Provider) {
+		for p != nil {
+			switch v := p.(type) {
+			case *fallbackProvider:
+				for _, fp := range v.providers {
+					collect(fp)
+				}
+				return
+			case *cachingProvider:
+				caches = append(caches, v.cache.(*SQLiteCache))
+			case *costProvider:
+				sessions = append(sessions, v.session)
+			}
+			w, ok := p.(ai.Wrapper)
+			if !ok {
+				return
+			}
+			p = w.Unwrap()
+		}
+	}
+	collect(p)
+
+	// the fallback is cached and billed in the databases of the primary
+	require.Len(t, caches, 2)
+	assert.Same(t, caches[0], caches[1])
+	assert.NoFileExists(t, fallback.CacheDBPath)
+	require.Len(t, sessions, 2)
+	assert.Same(t, sessions[0], sessions[1])
+
+	require.NoError(t, Close(p))
+	_, err = caches[0].Stats()
+	assert.ErrorContains(t, err, "database is closed")
+	_, err = sessions[0].Ledger.Spent("", time.Time{})
+	assert.ErrorContains(t, err, "database is closed")
+}
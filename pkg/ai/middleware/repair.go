@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/flanksource/captain/pkg/ai"
+	"github.com/flanksource/commons/logger"
+)
+
+// DefaultSchemaRepairs is how many repair turns NewProvider allows when
+// Config.SchemaRepairs is 0.
+const DefaultSchemaRepairs = 2
+
+type repairProvider struct {
+	provider   ai.Provider
+	maxRepairs int
+}
+
+func (r *repairProvider) GetModel() string       { return r.provider.GetModel() }
+func (r *repairProvider) GetBackend() ai.Backend { return r.provider.GetBackend() }
+func (r *repairProvider) Unwrap() ai.Provider    { return r.provider }
+
+func (r *repairProvider) Execute(ctx context.Context, req ai.Request) (*ai.Response, error) {
+	resp, err := r.provider.Execute(ctx, req)
+	if req.StructuredOutput == nil {
+		return resp, err
+	}
+
+	// the rejected replies are billed with the final one
+	var spent ai.Usage
+	for attempt := 1; attempt <= r.maxRepairs; attempt++ {
+		serr, ok := ai.AsSchemaValidationError(err)
+		if !ok || ctx.Err() != nil {
+			break
+		}
+		logger.Infof("[%s/%s] structured output failed validation, requesting a repair (%d/%d): %v",
+			r.provider.GetBackend(), r.provider.GetModel(), attempt, r.maxRepairs, err)
+
+		spent = spent.Add(serr.Usage)
+		req = repairRequest(req, serr)
+		resp, err = r.provider.Execute(ctx, req)
+	}
+	if serr, ok := ai.AsSchemaValidationError(err); ok {
+		serr.Usage = spent.Add(serr.Usage)
+	} else if resp != nil {
+		resp.Usage = spent.Add(resp.Usage)
+	}
+	return resp, err
+}
+
+// repairRequest continues the conversation with the invalid reply and a user
+// turn listing each violation by JSON pointer.
+func repairRequest(req ai.Request, serr *ai.SchemaValidationError) ai.Request {
+	var sb strings.Builder
+	sb.WriteString("Your reply does not match the required JSON schema:\n")
+	for _, v := range serr.Violations {
+		fmt.Fprintf(&sb, "- %s\n", v)
+	}
+	sb.WriteString("\nReply again with only the corrected JSON document.")
+
+	output := serr.Output
+	if strings.TrimSpace(output) == "" {
+		output = "(empty reply)"
+	}
+	req.Messages = append(req.AllMessages(), ai.AssistantMessage(output), ai.UserMessage(sb.String()))
+	req.Prompt = ""
+	req.Attachments = nil
+	return req
+}
+
+// WithSchemaRepair retries structured requests whose reply fails schema
+// validation, sending the model its reply and the violations up to maxRepairs
+// times. If every repair fails, the error lists the violations of the last
+// reply. The usage of rejected replies is added to that of the final response
+// or error.
+func WithSchemaRepair(maxRepairs int) Option {
+	return func(p ai.Provider) (ai.Provider, error) {
+		return &repairProvider{provider: p, maxRepairs: maxRepairs}, nil
+	}
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flanksource/captain/pkg/ai"
+	"github.com/flanksource/captain/pkg/ai/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaRepair(t *testing.T) {
+	replies := []string{`{"city":"Paris"}`, `{"city":"Paris","country":"France"}`}
+	var lastMessages []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Messages []map[string]any `json:"messages"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		lastMessages = body.Messages
+		reply, _ := json.Marshal(replies[0])
+		replies = replies[1:]
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"id":"m","type":"message","role":"assistant","model":"claude-sonnet-4-6",
+			"content":[{"type":"text","text":%s}],"usage":{"input_tokens":30,"output_tokens":8}}`, reply)
+	}))
+	defer server.Close()
+
+	type Capital struct {
+		City    string `json:"city"`
+		Country string `json:"country"`
+	}
+	p, err := NewProvider(ai.Config{Model: "claude-sonnet-4-6", APIKey: "key", APIURL: server.URL, NoCache: true})
+	require.NoError(t, err)
+
+	capital, resp, err := ai.ExecuteTyped[Capital](context.Background(), p, ai.Request{Prompt: "Capital of France?"})
+	require.NoError(t, err)
+	assert.Equal(t, Capital{City: "Paris", Country: "France"}, *capital)
+	assert.Equal(t, ai.Usage{InputTokens: 60, OutputTokens: 16}, resp.Usage, "the rejected reply is included")
+
+	require.Len(t, lastMessages, 3)
+	assert.Equal(t, "assistant", lastMessages[1]["role"])
+	repair, _ := json.Marshal(lastMessages[2]["content"])
+	assert.Contains(t, string(repair), "/country: required property is missing")
+}
+
+func TestSchemaRepairGivesUp(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"id":"m","type":"message","role":"assistant","model":"claude-sonnet-4-6",
+			"content":[{"type":"text","text":"{\"count\":\"many\"}"}],"usage":{"input_tokens":30,"output_tokens":8}}`)
+	}))
+	defer server.Close()
+
+	type Tally struct {
+		Count int    `json:"count"`
+		Unit  string `json:"unit"`
+	}
+	registerTestPricing()
+	sess := session.New("s1", "captain")
+	p, err := NewProvider(ai.Config{Model: "claude-sonnet-4-6", APIKey: "key", APIURL: server.URL, NoCache: true, SchemaRepairs: 1},
+		WithCostTracking(sess, 0))
+	require.NoError(t, err)
+
+	_, _, err = ai.ExecuteTyped[Tally](context.Background(), p, ai.Request{Prompt: "How many?"})
+	require.ErrorIs(t, err, ai.ErrSchemaValidation)
+	assert.Contains(t, err.Error(), "/count: expected integer, got string; /unit: required property is missing")
+	assert.Equal(t, 2, calls)
+
+	serr, ok := ai.AsSchemaValidationError(err)
+	require.True(t, ok)
+	assert.Equal(t, ai.Usage{InputTokens: 60, OutputTokens: 16}, serr.Usage)
+	// 60 input tokens at $2/M and 16 output tokens at $4/M
+	assert.InDelta(t, 0.000184, sess.TotalCost(), 1e-9, "failed replies are billed")
+}
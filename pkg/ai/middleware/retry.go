@@ -2,8 +2,9 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"math/rand/v2"
-	"strings"
+	"net"
 	"time"
 
 	"github.com/flanksource/captain/pkg/ai"
@@ -29,8 +30,9 @@ type retryProvider struct {
 	config   RetryConfig
 }
 
-func (r *retryProvider) GetModel() string      { return r.provider.GetModel() }
+func (r *retryProvider) GetModel() string       { return r.provider.GetModel() }
 func (r *retryProvider) GetBackend() ai.Backend { return r.provider.GetBackend() }
+func (r *retryProvider) Unwrap() ai.Provider    { return r.provider }
 
 func (r *retryProvider) Execute(ctx context.Context, req ai.Request) (*ai.Response, error) {
 	var lastErr error
@@ -43,19 +45,18 @@ func (r *retryProvider) Execute(ctx context.Context, req ai.Request) (*ai.Respon
 
 		lastErr = err
 
-		if !isRetryable(err) {
+		if !isRetryable(ctx, err) {
 			return resp, err
 		}
 		if attempt >= r.config.MaxRetries {
 			break
 		}
 
-		delay := r.config.BaseDelay * time.Duration(1<<uint(attempt))
-		if delay > r.config.MaxDelay {
-			delay = r.config.MaxDelay
+		delay, ok := retryDelay(r.config, attempt, err)
+		if !ok {
+			logger.Infof("[%s] not retrying, the provider asked to wait %v: %v", r.provider.GetModel(), delay, err)
+			return resp, err
 		}
-		jitter := time.Duration(rand.Int64N(int64(delay) / 4))
-		delay += jitter
 
 		logger.Infof("[%s] retrying after %v (attempt %d/%d): %v",
 			r.provider.GetModel(), delay, attempt+1, r.config.MaxRetries, err)
@@ -70,13 +71,43 @@ func (r *retryProvider) Execute(ctx context.Context, req ai.Request) (*ai.Respon
 	return nil, lastErr
 }
 
-func isRetryable(err error) bool {
-	msg := err.Error()
-	return strings.Contains(msg, "rate limit") ||
-		strings.Contains(msg, "429") ||
-		strings.Contains(msg, "503") ||
-		strings.Contains(msg, "overloaded") ||
-		strings.Contains(msg, "timeout")
+// isRetryable retries classified rate-limit, overload and 5xx failures,
+// timeouts and network errors. Auth, quota, context-length and invalid
+// requests are never retried, and nothing is once ctx is done.
+func isRetryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if perr, ok := ai.AsProviderError(err); ok {
+		return perr.Retryable()
+	}
+	if errors.Is(err, ai.ErrTimeout) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// retryDelay is exponential backoff with jitter, capped at MaxDelay, but
+// never shorter than a Retry-After the provider asked for. It reports false
+// when that Retry-After exceeds MaxDelay, as waiting it out would stall the
+// caller for longer than it allowed.
+func retryDelay(config RetryConfig, attempt int, err error) (time.Duration, bool) {
+	delay := config.BaseDelay * time.Duration(1<<uint(attempt))
+	if delay > config.MaxDelay {
+		delay = config.MaxDelay
+	}
+	if delay > 0 {
+		delay += time.Duration(rand.Int64N(int64(delay)/4 + 1))
+	}
+
+	if perr, ok := ai.AsProviderError(err); ok && perr.RetryAfter > delay {
+		if perr.RetryAfter > config.MaxDelay {
+			return perr.RetryAfter, false
+		}
+		delay = perr.RetryAfter
+	}
+	return delay, true
 }
 
 func WithRetry(config RetryConfig) Option {
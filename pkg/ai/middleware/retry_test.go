@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/flanksource/captain/pkg/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingProvider fails with errs in turn, then succeeds.
+type failingProvider struct {
+	errs  []error
+	calls int
+}
+
+func (f *failingProvider) GetModel() string       { return "test-retry" }
+func (f *failingProvider) GetBackend() ai.Backend { return ai.BackendAnthropic }
+
+func (f *failingProvider) Execute(ctx context.Context, req ai.Request) (*ai.Response, error) {
+	f.calls++
+	if f.calls <= len(f.errs) {
+		return nil, f.errs[f.calls-1]
+	}
+	return &ai.Response{Text: "ok"}, nil
+}
+
+func TestRetry(t *testing.T) {
+	config := RetryConfig{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: 50 * time.Millisecond}
+	rateLimited := func(after time.Duration) error {
+		return &ai.ProviderError{Backend: ai.BackendAnthropic, StatusCode: 429, Category: ai.CategoryRateLimit, RetryAfter: after}
+	}
+
+	tests := []struct {
+		name    string
+		errs    []error
+		ctx     func() context.Context
+		calls   int
+		wantErr string
+	}{
+		{name: "rate limit honours retry-after", errs: []error{rateLimited(10 * time.Millisecond)}, calls: 2},
+		{name: "timeout", errs: []error{ai.ErrTimeout, ai.ErrTimeout}, calls: 3},
+		{name: "invalid request", errs: []error{&ai.ProviderError{Category: ai.CategoryInvalidRequest}}, calls: 1, wantErr: "invalid_request"},
+		{name: "retry-after beyond max delay", errs: []error{rateLimited(time.Minute)}, calls: 1, wantErr: "rate_limit"},
+		{
+			name:  "cancelled caller",
+			errs:  []error{ai.ErrTimeout},
+			calls: 1, wantErr: ai.ErrTimeout.Error(),
+			ctx: func() context.Context {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := &failingProvider{errs: tt.errs}
+			p, err := Wrap(inner, WithRetry(config))
+			require.NoError(t, err)
+			ctx := context.Background()
+			if tt.ctx != nil {
+				ctx = tt.ctx()
+			}
+
+			start := time.Now()
+			resp, err := p.Execute(ctx, ai.Request{Prompt: "hi"})
+			assert.Equal(t, tt.calls, inner.calls)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				assert.Equal(t, "ok", resp.Text)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+			assert.Less(t, time.Since(start), config.MaxDelay)
+		})
+	}
+}
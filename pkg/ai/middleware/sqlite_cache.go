@@ -0,0 +1,288 @@
+package middleware
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/flanksource/captain/pkg/ai/session"
+	"github.com/flanksource/commons/logger"
+	_ "modernc.org/sqlite"
+)
+
+const DefaultCacheMaxSize int64 = 100 << 20 // 100 MiB
+
+// DefaultCacheDBPath returns ~/.cache/captain/ai-cache.db, honouring XDG_CACHE_HOME.
+func DefaultCacheDBPath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "captain", "ai-cache.db")
+}
+
+// SQLiteCache is a persistent Cache. Entries expire after their TTL and the
+// least recently used entries are evicted once the total value size exceeds
+// maxSize. Hit and miss counters are stored in the database so they survive
+// across processes.
+type SQLiteCache struct {
+	db      *sql.DB
+	path    string
+	maxSize int64
+}
+
+type CacheEntry struct {
+	Key        string
+	Size       int64
+	Hits       int64
+	CreatedAt  time.Time
+	AccessedAt time.Time
+	ExpiresAt  time.Time // zero = never expires
+	Preview    string
+}
+
+type CacheStats struct {
+	Path    string
+	Entries int64
+	Expired int64
+	Size    int64
+	MaxSize int64
+	Hits    int64
+	Misses  int64
+}
+
+func (s CacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+const cacheSchema = `
+CREATE TABLE IF NOT EXISTS cache_entries (
+	key         TEXT PRIMARY KEY,
+	value       TEXT NOT NULL,
+	size        INTEGER NOT NULL,
+	hits        INTEGER NOT NULL DEFAULT 0,
+	created_at  INTEGER NOT NULL,
+	accessed_at INTEGER NOT NULL,
+	expires_at  INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS cache_entries_accessed ON cache_entries(accessed_at);
+CREATE TABLE IF NOT EXISTS cache_counters (
+	name  TEXT PRIMARY KEY,
+	value INTEGER NOT NULL
+);
+`
+
+// NewSQLiteCache opens (creating if needed) the cache database at path.
+// maxSize <= 0 uses DefaultCacheMaxSize.
+func NewSQLiteCache(path string, maxSize int64) (*SQLiteCache, error) {
+	if path == "" {
+		path = DefaultCacheDBPath()
+	}
+	if maxSize <= 0 {
+		maxSize = DefaultCacheMaxSize
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	db, err := sql.Open("sqlite", session.SQLiteDSN(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cache %s: %w", path, err)
+	}
+	if _, err := db.Exec(cacheSchema); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to initialise cache %s: %w", path, err)
+	}
+	return &SQLiteCache{db: db, path: path, maxSize: maxSize}, nil
+}
+
+func (c *SQLiteCache) Close() error { return c.db.Close() }
+
+func (c *SQLiteCache) Get(key string) (string, bool) {
+	now := time.Now().UnixNano()
+
+	var value string
+	var expiresAt int64
+	err := c.db.QueryRow(`SELECT value, expires_at FROM cache_entries WHERE key = ?`, key).Scan(&value, &expiresAt)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			logger.Warnf("cache lookup failed: %v", err)
+		}
+		c.count("misses")
+		return "", false
+	}
+
+	if expiresAt > 0 && expiresAt <= now {
+		if _, err := c.db.Exec(`DELETE FROM cache_entries WHERE key = ?`, key); err != nil {
+			logger.Warnf("failed to delete expired cache entry: %v", err)
+		}
+		c.count("misses")
+		return "", false
+	}
+
+	if _, err := c.db.Exec(`UPDATE cache_entries SET hits = hits + 1, accessed_at = ? WHERE key = ?`, now, key); err != nil {
+		logger.Warnf("failed to update cache entry: %v", err)
+	}
+	c.count("hits")
+	return value, true
+}
+
+// Set stores value under key. ttl <= 0 stores the entry without expiry.
+func (c *SQLiteCache) Set(key string, value string, ttl time.Duration) {
+	now := time.Now()
+	var expiresAt int64
+	if ttl > 0 {
+		expiresAt = now.Add(ttl).UnixNano()
+	}
+
+	_, err := c.db.Exec(`INSERT INTO cache_entries (key, value, size, hits, created_at, accessed_at, expires_at)
+		VALUES (?, ?, ?, 0, ?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value, size = excluded.size,
+			created_at = excluded.created_at, accessed_at = excluded.accessed_at, expires_at = excluded.expires_at`,
+		key, value, len(value), now.UnixNano(), now.UnixNano(), expiresAt)
+	if err != nil {
+		logger.Warnf("failed to write cache entry: %v", err)
+		return
+	}
+
+	if err := c.evict(); err != nil {
+		logger.Warnf("cache eviction failed: %v", err)
+	}
+}
+
+// evict removes expired entries, then the least recently used entries until
+// the total size fits within maxSize.
+func (c *SQLiteCache) evict() error {
+	if _, err := c.Purge(true); err != nil {
+		return err
+	}
+
+	var total int64
+	if err := c.db.QueryRow(`SELECT COALESCE(SUM(size), 0) FROM cache_entries`).Scan(&total); err != nil {
+		return err
+	}
+	if total <= c.maxSize {
+		return nil
+	}
+
+	rows, err := c.db.Query(`SELECT key, size FROM cache_entries ORDER BY accessed_at ASC`)
+	if err != nil {
+		return err
+	}
+	var victims []string
+	for rows.Next() && total > c.maxSize {
+		var key string
+		var size int64
+		if err := rows.Scan(&key, &size); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		victims = append(victims, key)
+		total -= size
+	}
+	_ = rows.Close()
+
+	for _, key := range victims {
+		if _, err := c.db.Exec(`DELETE FROM cache_entries WHERE key = ?`, key); err != nil {
+			return err
+		}
+	}
+	logger.Debugf("evicted %d cache entries", len(victims))
+	return nil
+}
+
+func (c *SQLiteCache) count(name string) {
+	_, err := c.db.Exec(`INSERT INTO cache_counters (name, value) VALUES (?, 1)
+		ON CONFLICT(name) DO UPDATE SET value = value + 1`, name)
+	if err != nil {
+		logger.Warnf("failed to update cache counter: %v", err)
+	}
+}
+
+// List returns up to limit entries, most recently used first. limit <= 0
+// returns every entry.
+func (c *SQLiteCache) List(limit int) ([]CacheEntry, error) {
+	query := `SELECT key, size, hits, created_at, accessed_at, expires_at, substr(value, 1, 80)
+		FROM cache_entries ORDER BY accessed_at DESC`
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	rows, err := c.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cache entries: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var entries []CacheEntry
+	for rows.Next() {
+		var e CacheEntry
+		var created, accessed, expires int64
+		if err := rows.Scan(&e.Key, &e.Size, &e.Hits, &created, &accessed, &expires, &e.Preview); err != nil {
+			return nil, fmt.Errorf("failed to read cache entry: %w", err)
+		}
+		e.CreatedAt = time.Unix(0, created)
+		e.AccessedAt = time.Unix(0, accessed)
+		if expires > 0 {
+			e.ExpiresAt = time.Unix(0, expires)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func (c *SQLiteCache) Stats() (CacheStats, error) {
+	stats := CacheStats{Path: c.path, MaxSize: c.maxSize}
+	now := time.Now().UnixNano()
+
+	err := c.db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(size), 0),
+		COALESCE(SUM(CASE WHEN expires_at > 0 AND expires_at <= ? THEN 1 ELSE 0 END), 0)
+		FROM cache_entries`, now).Scan(&stats.Entries, &stats.Size, &stats.Expired)
+	if err != nil {
+		return stats, fmt.Errorf("failed to read cache stats: %w", err)
+	}
+
+	rows, err := c.db.Query(`SELECT name, value FROM cache_counters`)
+	if err != nil {
+		return stats, fmt.Errorf("failed to read cache counters: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		var name string
+		var value int64
+		if err := rows.Scan(&name, &value); err != nil {
+			return stats, fmt.Errorf("failed to read cache counters: %w", err)
+		}
+		switch name {
+		case "hits":
+			stats.Hits = value
+		case "misses":
+			stats.Misses = value
+		}
+	}
+	return stats, rows.Err()
+}
+
+// Purge deletes expired entries, or every entry and the hit/miss counters
+// when expiredOnly is false. It returns the number of entries removed.
+func (c *SQLiteCache) Purge(expiredOnly bool) (int64, error) {
+	var result sql.Result
+	var err error
+	if expiredOnly {
+		result, err = c.db.Exec(`DELETE FROM cache_entries WHERE expires_at > 0 AND expires_at <= ?`, time.Now().UnixNano())
+	} else {
+		result, err = c.db.Exec(`DELETE FROM cache_entries`)
+		if err == nil {
+			_, err = c.db.Exec(`DELETE FROM cache_counters`)
+		}
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge cache: %w", err)
+	}
+	return result.RowsAffected()
+}
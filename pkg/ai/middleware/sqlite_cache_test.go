@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteCacheExpiryAndEviction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+	cache, err := NewSQLiteCache(path, 25)
+	require.NoError(t, err)
+	defer func() { _ = cache.Close() }()
+
+	cache.Set("a", strings.Repeat("a", 10), time.Hour)
+	cache.Set("expired", "old", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	value, ok := cache.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, strings.Repeat("a", 10), value)
+
+	_, ok = cache.Get("expired")
+	assert.False(t, ok)
+	_, ok = cache.Get("missing")
+	assert.False(t, ok)
+
+	// b and c push the total past 25 bytes, evicting the least recently used entry
+	cache.Set("b", strings.Repeat("b", 10), 0)
+	_, _ = cache.Get("a")
+	cache.Set("c", strings.Repeat("c", 10), 0)
+
+	_, ok = cache.Get("b")
+	assert.False(t, ok, "b should have been evicted")
+	_, ok = cache.Get("a")
+	assert.True(t, ok)
+
+	stats, err := cache.Stats()
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stats.Entries)
+	assert.Equal(t, int64(20), stats.Size)
+	assert.Equal(t, int64(3), stats.Hits)
+	assert.Equal(t, int64(3), stats.Misses)
+}
+
+func TestSQLiteCachePathEscaping(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "odd?name#1 %20.db")
+	cache, err := NewSQLiteCache(path, 0)
+	require.NoError(t, err)
+	defer func() { _ = cache.Close() }()
+
+	cache.Set("a", "b", time.Hour)
+	value, ok := cache.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, "b", value)
+	assert.FileExists(t, path)
+}
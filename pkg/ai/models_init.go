@@ -20,6 +20,7 @@ func RegisterDefaultModels() {
 			OutputPrice:      m.OutputPrice,
 			CacheReadsPrice:  m.CacheRead,
 			CacheWritesPrice: m.CacheWrite,
+			Source:           pricing.SourceCatalog,
 		}
 	}
 
@@ -0,0 +1,79 @@
+package pricing
+
+import (
+	"fmt"
+	"sort"
+)
+
+// PriceChange is a difference between two sets of prices. Field is empty for
+// added and removed models.
+type PriceChange struct {
+	Model string
+	Kind  string // added, removed or changed
+	Field string
+	Old   float64
+	New   float64
+}
+
+// Diff compares the prices of two snapshots, sorted by model and field.
+func Diff(old, new map[string]*ModelInfo) []PriceChange {
+	var changes []PriceChange
+	for id, o := range old {
+		n, ok := new[id]
+		if !ok {
+			changes = append(changes, PriceChange{Model: id, Kind: "removed"})
+			continue
+		}
+		changes = append(changes, diffTier(id, "", o.Prices(0), n.Prices(0))...)
+		for _, above := range tierThresholds(o, n) {
+			suffix := fmt.Sprintf(">%dk", above/1000)
+			changes = append(changes, diffTier(id, suffix, o.Prices(above+1), n.Prices(above+1))...)
+		}
+	}
+	for id := range new {
+		if _, ok := old[id]; !ok {
+			changes = append(changes, PriceChange{Model: id, Kind: "added"})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Model != changes[j].Model {
+			return changes[i].Model < changes[j].Model
+		}
+		return changes[i].Field < changes[j].Field
+	})
+	return changes
+}
+
+func diffTier(model, suffix string, o, n PriceTier) []PriceChange {
+	var changes []PriceChange
+	for _, f := range []struct {
+		name     string
+		old, new float64
+	}{
+		{"input", o.InputPrice, n.InputPrice},
+		{"output", o.OutputPrice, n.OutputPrice},
+		{"cache_read", o.CacheReadsPrice, n.CacheReadsPrice},
+		{"cache_write", o.CacheWritesPrice, n.CacheWritesPrice},
+		{"cache_write_1h", o.CacheWrites1hPrice, n.CacheWrites1hPrice},
+	} {
+		if f.old != f.new {
+			changes = append(changes, PriceChange{Model: model, Kind: "changed", Field: f.name + suffix, Old: f.old, New: f.new})
+		}
+	}
+	return changes
+}
+
+// tierThresholds returns the context tier thresholds of either model.
+func tierThresholds(o, n *ModelInfo) []int {
+	seen := map[int]bool{}
+	var thresholds []int
+	for _, tier := range append(append([]PriceTier{}, o.ContextTiers...), n.ContextTiers...) {
+		if !seen[tier.AboveTokens] {
+			seen[tier.AboveTokens] = true
+			thresholds = append(thresholds, tier.AboveTokens)
+		}
+	}
+	sort.Ints(thresholds)
+	return thresholds
+}
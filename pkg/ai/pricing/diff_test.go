@@ -0,0 +1,54 @@
+package pricing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	base := func() *ModelInfo { return &ModelInfo{InputPrice: 3, OutputPrice: 15, CacheWritesPrice: 3.75} }
+	with := func(change func(*ModelInfo)) *ModelInfo {
+		info := base()
+		change(info)
+		return info
+	}
+
+	tests := []struct {
+		name     string
+		old, new map[string]*ModelInfo
+		want     []PriceChange
+	}{
+		{name: "unchanged", old: map[string]*ModelInfo{"m": base()}, new: map[string]*ModelInfo{"m": base()}},
+		{name: "added and removed", old: map[string]*ModelInfo{"b": base()}, new: map[string]*ModelInfo{"a": base()}, want: []PriceChange{
+			{Model: "a", Kind: "added"},
+			{Model: "b", Kind: "removed"},
+		}},
+		{name: "changed price", old: map[string]*ModelInfo{"m": base()}, new: map[string]*ModelInfo{"m": with(func(m *ModelInfo) { m.InputPrice = 2 })}, want: []PriceChange{
+			{Model: "m", Kind: "changed", Field: "input", Old: 3, New: 2},
+		}},
+		{name: "cache writes move the 1 hour price they default to", old: map[string]*ModelInfo{"m": base()},
+			new: map[string]*ModelInfo{"m": with(func(m *ModelInfo) { m.CacheWritesPrice = 4 })}, want: []PriceChange{
+				{Model: "m", Kind: "changed", Field: "cache_write", Old: 3.75, New: 4},
+				{Model: "m", Kind: "changed", Field: "cache_write_1h", Old: 3.75, New: 4},
+			}},
+		{name: "context tier added", old: map[string]*ModelInfo{"m": base()},
+			new: map[string]*ModelInfo{"m": with(func(m *ModelInfo) {
+				m.ContextTiers = []PriceTier{{AboveTokens: 200_000, InputPrice: 6}}
+			})}, want: []PriceChange{
+				{Model: "m", Kind: "changed", Field: "input>200k", Old: 3, New: 6},
+			}},
+		{name: "context tier repriced", old: map[string]*ModelInfo{"m": with(func(m *ModelInfo) {
+			m.ContextTiers = []PriceTier{{AboveTokens: 200_000, OutputPrice: 22.5}}
+		})}, new: map[string]*ModelInfo{"m": with(func(m *ModelInfo) {
+			m.ContextTiers = []PriceTier{{AboveTokens: 200_000, OutputPrice: 30}}
+		})}, want: []PriceChange{
+			{Model: "m", Kind: "changed", Field: "output>200k", Old: 22.5, New: 30},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Diff(tt.old, tt.new))
+		})
+	}
+}
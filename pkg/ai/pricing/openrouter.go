@@ -1,12 +1,12 @@
 package pricing
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
-	"sync"
 	"time"
 
 	"github.com/flanksource/commons/logger"
@@ -15,12 +15,8 @@ import (
 const (
 	openRouterAPIURL    = "https://openrouter.ai/api/v1/models"
 	cacheExpiryDuration = 24 * time.Hour
-)
 
-var (
-	pricingCache     *PricingCache
-	pricingCacheErr  error
-	pricingCacheLock sync.Mutex
+	DefaultOpenRouterTimeout = 10 * time.Second
 )
 
 type OpenRouterResponse struct {
@@ -46,6 +42,8 @@ type TopProvider struct {
 	MaxCompletionTokens *int `json:"max_completion_tokens,omitempty"`
 }
 
+// PricingCache is a dated set of prices: the OpenRouter disk cache, the
+// embedded snapshot or a snapshot written by `captain ai pricing refresh`.
 type PricingCache struct {
 	Timestamp time.Time             `json:"timestamp"`
 	Models    map[string]*ModelInfo `json:"models"`
@@ -55,39 +53,52 @@ func (c *PricingCache) IsExpired() bool {
 	return time.Since(c.Timestamp) >= cacheExpiryDuration
 }
 
-func EnsureLoaded() {
-	pricingCacheLock.Lock()
-	defer pricingCacheLock.Unlock()
+// OpenRouterSource loads prices from the OpenRouter models API. Responses are
+// cached on disk for a day; when the API is unreachable a stale cache is used
+// rather than nothing.
+type OpenRouterSource struct {
+	URL     string        // empty = the public API
+	Timeout time.Duration // 0 = DefaultOpenRouterTimeout
+}
 
-	if pricingCacheErr != nil {
-		return
-	}
-	if pricingCache != nil && !pricingCache.IsExpired() {
-		return
-	}
+func (s *OpenRouterSource) Name() string { return SourceOpenRouter }
 
-	if pricingCache == nil {
-		if cache, err := loadFromDisk(); err == nil && cache != nil && !cache.IsExpired() {
-			logger.Debugf("Loaded OpenRouter pricing from cache (age: %s)", time.Since(cache.Timestamp))
-			pricingCache = cache
-			MergeModels(cache.Models)
-			return
-		}
+func (s *OpenRouterSource) Load(ctx context.Context) (map[string]*ModelInfo, error) {
+	cache, _ := loadFromDisk()
+	if cache != nil && !cache.IsExpired() {
+		logger.Debugf("Loaded OpenRouter pricing from cache (age: %s)", time.Since(cache.Timestamp))
+		return cache.Models, nil
 	}
 
-	models, err := fetchOpenRouterPricing()
+	models, err := s.Fetch(ctx)
 	if err != nil {
-		logger.Warnf("Failed to fetch OpenRouter pricing: %v", err)
-		pricingCacheErr = err
-		return
+		if cache != nil {
+			logger.Warnf("Using OpenRouter pricing cached %s ago: %v", time.Since(cache.Timestamp).Round(time.Minute), err)
+			return cache.Models, nil
+		}
+		return nil, err
 	}
-
-	pricingCache = &PricingCache{Timestamp: time.Now(), Models: models}
-	MergeModels(models)
+	return models, nil
 }
 
-func fetchOpenRouterPricing() (map[string]*ModelInfo, error) {
-	resp, err := http.Get(openRouterAPIURL)
+// Fetch queries the API, bypassing the disk cache, and saves the result to it.
+func (s *OpenRouterSource) Fetch(ctx context.Context) (map[string]*ModelInfo, error) {
+	url := s.URL
+	if url == "" {
+		url = openRouterAPIURL
+	}
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = DefaultOpenRouterTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch OpenRouter pricing: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch OpenRouter pricing: %w", err)
 	}
@@ -112,6 +123,12 @@ func fetchOpenRouterPricing() (map[string]*ModelInfo, error) {
 	return models, nil
 }
 
+// CachedOpenRouterPricing returns the OpenRouter prices cached on disk, or nil
+// when nothing has been fetched yet.
+func CachedOpenRouterPricing() (*PricingCache, error) {
+	return loadFromDisk()
+}
+
 func parseModels(models []OpenRouterModel) map[string]*ModelInfo {
 	result := make(map[string]*ModelInfo, len(models))
 	for _, m := range models {
@@ -7,6 +7,20 @@ import (
 	"sync"
 )
 
+const (
+	ServiceTierStandard = "standard"
+	ServiceTierPriority = "priority"
+	ServiceTierBatch    = "batch"
+	ServiceTierFlex     = "flex"
+)
+
+// DefaultServiceTiers are the rate multipliers of service tiers for models
+// that do not list their own. Unlisted tiers are billed at the standard rate.
+var DefaultServiceTiers = map[string]float64{
+	ServiceTierBatch: 0.5,
+	ServiceTierFlex:  0.5,
+}
+
 type ModelInfo struct {
 	ModelID          string
 	MaxTokens        int
@@ -14,7 +28,82 @@ type ModelInfo struct {
 	InputPrice       float64 // per million tokens
 	OutputPrice      float64 // per million tokens
 	CacheReadsPrice  float64 // per million tokens
-	CacheWritesPrice float64 // per million tokens
+	CacheWritesPrice float64 // per million tokens, 5 minute TTL
+	// CacheWrites1hPrice is the per million price of 1 hour TTL cache writes;
+	// 0 = CacheWritesPrice.
+	CacheWrites1hPrice float64 `json:",omitempty"`
+	// ContextTiers replace the prices of requests whose prompt exceeds a
+	// number of tokens, in ascending order.
+	ContextTiers []PriceTier `json:",omitempty"`
+	// ServiceTiers multiply every price of a request served on a tier,
+	// overriding DefaultServiceTiers.
+	ServiceTiers map[string]float64 `json:",omitempty"`
+	Source       string             `json:"-"` // highest precedence source that priced the model
+	// zeroPrices are the prices the source set to 0 on purpose, which replace
+	// those of lower precedence sources instead of keeping them.
+	zeroPrices priceField
+}
+
+// priceField is a set of ModelInfo prices.
+type priceField uint8
+
+const (
+	fieldInput priceField = 1 << iota
+	fieldOutput
+	fieldCacheReads
+	fieldCacheWrites
+	fieldCacheWrites1h
+)
+
+// PriceTier holds the per million token prices that apply to a request. Zero
+// prices keep the price of the tier below.
+type PriceTier struct {
+	AboveTokens        int // prompt tokens (input, cache reads and cache writes) the request must exceed
+	InputPrice         float64
+	OutputPrice        float64
+	CacheReadsPrice    float64
+	CacheWritesPrice   float64
+	CacheWrites1hPrice float64
+}
+
+// Prices returns the prices of a request with promptTokens of input, cache
+// read and cache write tokens. Long-context tiers price the whole request,
+// output included.
+func (m ModelInfo) Prices(promptTokens int) PriceTier {
+	p := PriceTier{
+		InputPrice:         m.InputPrice,
+		OutputPrice:        m.OutputPrice,
+		CacheReadsPrice:    m.CacheReadsPrice,
+		CacheWritesPrice:   m.CacheWritesPrice,
+		CacheWrites1hPrice: m.CacheWrites1hPrice,
+	}
+	for _, tier := range m.ContextTiers {
+		if promptTokens <= tier.AboveTokens {
+			break
+		}
+		p.AboveTokens = tier.AboveTokens
+		overlay(&p.InputPrice, tier.InputPrice)
+		overlay(&p.OutputPrice, tier.OutputPrice)
+		overlay(&p.CacheReadsPrice, tier.CacheReadsPrice)
+		overlay(&p.CacheWritesPrice, tier.CacheWritesPrice)
+		overlay(&p.CacheWrites1hPrice, tier.CacheWrites1hPrice)
+	}
+	if p.CacheWrites1hPrice == 0 {
+		p.CacheWrites1hPrice = p.CacheWritesPrice
+	}
+	return p
+}
+
+// ServiceTierMultiplier returns the share of the standard rate billed on
+// tier.
+func (m ModelInfo) ServiceTierMultiplier(tier string) float64 {
+	if v, ok := m.ServiceTiers[tier]; ok {
+		return v
+	}
+	if v, ok := DefaultServiceTiers[tier]; ok {
+		return v
+	}
+	return 1
 }
 
 var (
@@ -61,38 +150,74 @@ func ListModels(filter string) []ModelInfo {
 	return result
 }
 
+// Usage is the token usage of a single request.
+type Usage struct {
+	InputTokens        int
+	OutputTokens       int
+	ReasoningTokens    int
+	CacheReadTokens    int
+	CacheWriteTokens   int
+	CacheWrite1hTokens int    // part of CacheWriteTokens written with a 1 hour TTL
+	ServiceTier        string // empty = standard
+}
+
+func (u Usage) PromptTokens() int {
+	return u.InputTokens + u.CacheReadTokens + u.CacheWriteTokens
+}
+
+// CostResult prices each line of usage separately. Cache reads and writes of
+// models without a cache price cost nothing.
 type CostResult struct {
-	Model        string
-	InputTokens  int
-	OutputTokens int
-	TotalCost    float64
+	Model          string
+	InputTokens    int
+	OutputTokens   int
+	InputCost      float64
+	OutputCost     float64
+	ReasoningCost  float64 // reasoning tokens at the output price
+	CacheReadCost  float64
+	CacheWriteCost float64
+	TotalCost      float64
+	Tier           PriceTier // prices applied before the service tier multiplier
+	Multiplier     float64   // service tier multiplier
 }
 
-func CalculateCost(model string, inputTokens, outputTokens, reasoningTokens, cacheReadTokens, cacheWriteTokens int) (CostResult, error) {
+func CalculateCost(model string, usage Usage) (CostResult, error) {
 	info, ok := GetModelInfo(model)
 	if !ok {
 		suggestions := findSimilarModels(model, 3)
 		return CostResult{}, fmt.Errorf("model %s not found in pricing registry (%d models). Did you mean: %s",
 			model, RegistrySize(), strings.Join(suggestions, ", "))
 	}
+	return info.Cost(usage), nil
+}
 
-	cost := float64(inputTokens)*info.InputPrice/1_000_000 +
-		float64(outputTokens)*info.OutputPrice/1_000_000 +
-		float64(reasoningTokens)*info.OutputPrice/1_000_000
+// Cost prices usage at the context tier its prompt falls in and the rate of
+// its service tier.
+func (m ModelInfo) Cost(usage Usage) CostResult {
+	p := m.Prices(usage.PromptTokens())
+	mult := m.ServiceTierMultiplier(usage.ServiceTier)
+	write1h := min(usage.CacheWrite1hTokens, usage.CacheWriteTokens)
 
-	if cacheReadTokens > 0 && info.CacheReadsPrice > 0 {
-		cost += float64(cacheReadTokens) * info.CacheReadsPrice / 1_000_000
-	}
-	if cacheWriteTokens > 0 && info.CacheWritesPrice > 0 {
-		cost += float64(cacheWriteTokens) * info.CacheWritesPrice / 1_000_000
+	result := CostResult{
+		Model:         m.ModelID,
+		InputTokens:   usage.InputTokens,
+		OutputTokens:  usage.OutputTokens,
+		InputCost:     perMillion(usage.InputTokens, p.InputPrice) * mult,
+		OutputCost:    perMillion(usage.OutputTokens, p.OutputPrice) * mult,
+		ReasoningCost: perMillion(usage.ReasoningTokens, p.OutputPrice) * mult,
+		CacheReadCost: perMillion(usage.CacheReadTokens, p.CacheReadsPrice) * mult,
+		CacheWriteCost: (perMillion(usage.CacheWriteTokens-write1h, p.CacheWritesPrice) +
+			perMillion(write1h, p.CacheWrites1hPrice)) * mult,
+		Tier:       p,
+		Multiplier: mult,
 	}
+	result.TotalCost = result.InputCost + result.OutputCost + result.ReasoningCost +
+		result.CacheReadCost + result.CacheWriteCost
+	return result
+}
 
-	return CostResult{
-		Model:        model,
-		InputTokens:  inputTokens,
-		OutputTokens: outputTokens,
-		TotalCost:    cost,
-	}, nil
+func perMillion(tokens int, price float64) float64 {
+	return float64(tokens) * price / 1_000_000
 }
 
 func findSimilarModels(target string, topN int) []string {
@@ -0,0 +1,48 @@
+package pricing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelInfoCost(t *testing.T) {
+	tiered := ModelInfo{
+		ModelID: "test/tiered", InputPrice: 3, OutputPrice: 15, CacheReadsPrice: 0.3, CacheWritesPrice: 3.75, CacheWrites1hPrice: 6,
+		ContextTiers: []PriceTier{{AboveTokens: 200_000, InputPrice: 6, OutputPrice: 22.5, CacheReadsPrice: 0.6, CacheWritesPrice: 7.5}},
+		ServiceTiers: map[string]float64{ServiceTierPriority: 2},
+	}
+	flat := ModelInfo{ModelID: "test/flat", InputPrice: 1, OutputPrice: 2, CacheWritesPrice: 1.25}
+
+	tests := []struct {
+		name       string
+		info       ModelInfo
+		usage      Usage
+		total      float64
+		above      int
+		multiplier float64
+	}{
+		{name: "standard", info: tiered, usage: Usage{InputTokens: 100_000, OutputTokens: 1_000_000}, total: 0.3 + 15, multiplier: 1},
+		{name: "reasoning at the output price", info: tiered, usage: Usage{ReasoningTokens: 1_000_000}, total: 15, multiplier: 1},
+		{name: "at the context threshold", info: tiered, usage: Usage{InputTokens: 200_000}, total: 0.6, multiplier: 1},
+		{name: "above the context threshold", info: tiered, usage: Usage{InputTokens: 300_000, OutputTokens: 1_000_000}, total: 1.8 + 22.5, above: 200_000, multiplier: 1},
+		{name: "cache reads count towards the threshold", info: tiered, usage: Usage{InputTokens: 100_000, CacheReadTokens: 150_000}, total: 0.6 + 0.09, above: 200_000, multiplier: 1},
+		{name: "cache reads", info: tiered, usage: Usage{CacheReadTokens: 1_000_000}, total: 0.6, above: 200_000, multiplier: 1},
+		{name: "5 minute and 1 hour cache writes", info: tiered, usage: Usage{CacheWriteTokens: 100_000, CacheWrite1hTokens: 40_000}, total: 0.225 + 0.24, multiplier: 1},
+		{name: "1 hour writes beyond the writes", info: tiered, usage: Usage{CacheWriteTokens: 100_000, CacheWrite1hTokens: 200_000}, total: 0.6, multiplier: 1},
+		{name: "1 hour writes without a 1 hour price", info: flat, usage: Usage{CacheWriteTokens: 1_000_000, CacheWrite1hTokens: 1_000_000}, total: 1.25, multiplier: 1},
+		{name: "no cache read price", info: flat, usage: Usage{CacheReadTokens: 1_000_000}, total: 0, multiplier: 1},
+		{name: "model service tier", info: tiered, usage: Usage{InputTokens: 100_000, ServiceTier: ServiceTierPriority}, total: 0.6, multiplier: 2},
+		{name: "default service tier", info: tiered, usage: Usage{InputTokens: 100_000, OutputTokens: 1_000_000, ServiceTier: ServiceTierBatch}, total: (0.3 + 15) * 0.5, multiplier: 0.5},
+		{name: "unknown service tier", info: flat, usage: Usage{InputTokens: 1_000_000, ServiceTier: "scale"}, total: 1, multiplier: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cost := tt.info.Cost(tt.usage)
+			assert.InDelta(t, tt.total, cost.TotalCost, 1e-9)
+			assert.Equal(t, tt.above, cost.Tier.AboveTokens)
+			assert.Equal(t, tt.multiplier, cost.Multiplier)
+			assert.InDelta(t, cost.TotalCost, cost.InputCost+cost.OutputCost+cost.ReasoningCost+cost.CacheReadCost+cost.CacheWriteCost, 1e-9)
+		})
+	}
+}
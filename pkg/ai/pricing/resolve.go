@@ -0,0 +1,113 @@
+package pricing
+
+import (
+	"regexp"
+	"strings"
+)
+
+// How closely a model matched its registry entry.
+const (
+	// ConfidenceExact means the model is priced under its own name, give or
+	// take a vendor prefix or dotted version (claude-sonnet-4-5 ->
+	// anthropic/claude-sonnet-4.5).
+	ConfidenceExact = "exact"
+	// ConfidenceAlias means the model was priced as the model an alias or
+	// dated snapshot refers to (claude-sonnet-4-5-20250929, sonnet).
+	ConfidenceAlias = "alias"
+)
+
+var (
+	// dateSuffix matches snapshot dates such as -20250929 or the -latest alias.
+	dateSuffix = regexp.MustCompile(`-(\d{8}|latest)$`)
+	// dashedVersion matches single-digit versions written with a dash, which
+	// OpenRouter writes with a dot: claude-sonnet-4-5 -> claude-sonnet-4.5.
+	dashedVersion = regexp.MustCompile(`(\b|-)(\d)-(\d)(-|$)`)
+)
+
+// Match is the registry entry a model resolved to.
+type Match struct {
+	ID         string
+	Info       ModelInfo
+	Confidence string
+}
+
+type candidate struct {
+	id    string
+	exact bool
+}
+
+// Resolve finds the registry entry of model as named by an API, CLI or
+// session log. vendor is its OpenRouter prefix (anthropic, google, openai,
+// x-ai); empty derives it from the model name. OpenRouter IDs are preferred
+// over the built-in catalog IDs.
+func Resolve(vendor, model string) (Match, bool) {
+	for _, c := range candidates(vendor, model) {
+		if info, ok := GetModelInfo(c.id); ok {
+			confidence := ConfidenceAlias
+			if c.exact {
+				confidence = ConfidenceExact
+			}
+			return Match{ID: c.id, Info: info, Confidence: confidence}, true
+		}
+	}
+	return Match{}, false
+}
+
+// Candidates returns the registry IDs Resolve tries for model, in order.
+func Candidates(vendor, model string) []string {
+	var ids []string
+	for _, c := range candidates(vendor, model) {
+		ids = append(ids, c.id)
+	}
+	return ids
+}
+
+func candidates(vendor, model string) []candidate {
+	m := strings.ToLower(strings.TrimSpace(model))
+	m = strings.TrimPrefix(m, "models/")
+	if prefix, rest, ok := strings.Cut(m, "/"); ok {
+		vendor, m = prefix, rest
+	}
+	if vendor == "" {
+		vendor = ModelVendor(m)
+	}
+
+	base := dateSuffix.ReplaceAllString(m, "")
+	exact := base == m
+	dotted := dashedVersion.ReplaceAllString(base, "$1$2.$3$4")
+	names := []string{dotted, strings.TrimSuffix(dotted, ".0"), base, m}
+
+	var result []candidate
+	seen := map[string]bool{}
+	add := func(id string, exact bool) {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, candidate{id: id, exact: exact})
+		}
+	}
+	if vendor != "" {
+		for _, name := range names {
+			add(vendor+"/"+name, exact || name == m)
+		}
+	}
+	add(m, true)
+	add(base, exact)
+	return result
+}
+
+// ModelVendor returns the OpenRouter vendor of a model judged by its name, or
+// empty when the name does not tell.
+func ModelVendor(model string) string {
+	switch {
+	case strings.HasPrefix(model, "claude-"):
+		return "anthropic"
+	case strings.HasPrefix(model, "gemini-"):
+		return "google"
+	case strings.HasPrefix(model, "grok-"):
+		return "x-ai"
+	case strings.HasPrefix(model, "gpt-") || strings.HasPrefix(model, "codex") ||
+		strings.HasPrefix(model, "o1") || strings.HasPrefix(model, "o3") || strings.HasPrefix(model, "o4"):
+		return "openai"
+	}
+	return ""
+}
@@ -0,0 +1,58 @@
+package pricing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCandidates(t *testing.T) {
+	tests := []struct {
+		vendor, model string
+		want          []string
+	}{
+		{model: "claude-sonnet-4-5", want: []string{"anthropic/claude-sonnet-4.5", "anthropic/claude-sonnet-4-5", "claude-sonnet-4-5"}},
+		{model: "claude-sonnet-4-5-20250929", want: []string{
+			"anthropic/claude-sonnet-4.5", "anthropic/claude-sonnet-4-5", "anthropic/claude-sonnet-4-5-20250929",
+			"claude-sonnet-4-5-20250929", "claude-sonnet-4-5",
+		}},
+		{model: "claude-opus-4-0", want: []string{"anthropic/claude-opus-4.0", "anthropic/claude-opus-4", "anthropic/claude-opus-4-0", "claude-opus-4-0"}},
+		{model: "models/gemini-2.5-pro", want: []string{"google/gemini-2.5-pro", "gemini-2.5-pro"}},
+		{model: "openai/GPT-4o", want: []string{"openai/gpt-4o", "gpt-4o"}},
+		{model: "grok-4-latest", want: []string{"x-ai/grok-4", "x-ai/grok-4-latest", "grok-4-latest", "grok-4"}},
+		{vendor: "meta-llama", model: "llama-3-1-8b", want: []string{"meta-llama/llama-3.1-8b", "meta-llama/llama-3-1-8b", "llama-3-1-8b"}},
+		{model: "llama3", want: []string{"llama3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			assert.Equal(t, tt.want, Candidates(tt.vendor, tt.model))
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	MergeModels(map[string]*ModelInfo{
+		"acme/widget-2.1": {ModelID: "acme/widget-2.1", InputPrice: 1},
+		"gizmo-1":         {ModelID: "gizmo-1", InputPrice: 2},
+	})
+
+	tests := []struct {
+		name, vendor, model string
+		wantID, confidence  string
+	}{
+		{name: "dotted version", vendor: "acme", model: "widget-2-1", wantID: "acme/widget-2.1", confidence: ConfidenceExact},
+		{name: "dated snapshot", vendor: "acme", model: "widget-2-1-20250101", wantID: "acme/widget-2.1", confidence: ConfidenceAlias},
+		{name: "vendor prefix", model: "acme/widget-2.1", wantID: "acme/widget-2.1", confidence: ConfidenceExact},
+		{name: "catalog id", model: "gizmo-1", wantID: "gizmo-1", confidence: ConfidenceExact},
+		{name: "catalog alias", model: "gizmo-1-latest", wantID: "gizmo-1", confidence: ConfidenceAlias},
+		{name: "unknown", model: "nothing-9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, ok := Resolve(tt.vendor, tt.model)
+			assert.Equal(t, tt.wantID != "", ok)
+			assert.Equal(t, tt.wantID, match.ID)
+			assert.Equal(t, tt.confidence, match.Confidence)
+		})
+	}
+}
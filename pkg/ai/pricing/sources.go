@@ -0,0 +1,377 @@
+package pricing
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/flanksource/commons/logger"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	SourceCatalog    = "catalog"
+	SourceSnapshot   = "snapshot"
+	SourceOpenRouter = "openrouter"
+	SourceUser       = "user"
+
+	// retryInterval is how long EnsureLoaded waits before retrying sources
+	// that failed to load.
+	retryInterval = 5 * time.Minute
+)
+
+// PricingSource supplies model prices keyed by registry ID.
+type PricingSource interface {
+	Name() string
+	Load(ctx context.Context) (map[string]*ModelInfo, error)
+}
+
+//go:embed snapshot.json
+var embeddedSnapshot []byte
+
+// SnapshotSource loads a PricingCache file, or the snapshot embedded in the
+// binary when Path is empty, so prices are known offline.
+type SnapshotSource struct {
+	Path string
+}
+
+func (s *SnapshotSource) Name() string { return SourceSnapshot }
+
+func (s *SnapshotSource) Load(ctx context.Context) (map[string]*ModelInfo, error) {
+	snapshot, err := s.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return snapshot.Models, nil
+}
+
+func (s *SnapshotSource) Snapshot() (*PricingCache, error) {
+	if s.Path == "" {
+		return parseSnapshot(embeddedSnapshot, "embedded snapshot")
+	}
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pricing snapshot: %w", err)
+	}
+	return parseSnapshot(data, s.Path)
+}
+
+func parseSnapshot(data []byte, name string) (*PricingCache, error) {
+	var snapshot PricingCache
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("invalid pricing snapshot %s: %w", name, err)
+	}
+	for id, info := range snapshot.Models {
+		info.ModelID = id
+	}
+	return &snapshot, nil
+}
+
+// WriteSnapshot saves snapshot to path in the format SnapshotSource reads.
+func WriteSnapshot(path string, snapshot *PricingCache) error {
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// DefaultUserPricingPath returns ~/.config/captain/pricing.yaml, honouring
+// XDG_CONFIG_HOME.
+func DefaultUserPricingPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "captain", "pricing.yaml")
+}
+
+// userPrice is one model in the user pricing file, in USD per million tokens:
+//
+//	models:
+//	  anthropic/claude-sonnet-4.5:
+//	    input: 2.70
+//	    output: 13.50
+//	    cache_read: 0.27
+//	    tiers:
+//	      - above: 200000
+//	        input: 5.40
+//	        output: 20.25
+//	    service_tiers:
+//	      priority: 1.25
+type userPrice struct {
+	userTier      `yaml:",inline"`
+	ContextWindow int                `yaml:"context_window"`
+	MaxTokens     int                `yaml:"max_tokens"`
+	Tiers         []userTier         `yaml:"tiers"`
+	ServiceTiers  map[string]float64 `yaml:"service_tiers"`
+}
+
+// userTier prices are pointers so a price set to 0, e.g. free cache reads,
+// can be told apart from one left out.
+type userTier struct {
+	Above        int      `yaml:"above"`
+	Input        *float64 `yaml:"input"`
+	Output       *float64 `yaml:"output"`
+	CacheRead    *float64 `yaml:"cache_read"`
+	CacheWrite   *float64 `yaml:"cache_write"`
+	CacheWrite1h *float64 `yaml:"cache_write_1h"`
+}
+
+func (t userTier) priceTier() PriceTier {
+	return PriceTier{
+		AboveTokens:        t.Above,
+		InputPrice:         price(t.Input),
+		OutputPrice:        price(t.Output),
+		CacheReadsPrice:    price(t.CacheRead),
+		CacheWritesPrice:   price(t.CacheWrite),
+		CacheWrites1hPrice: price(t.CacheWrite1h),
+	}
+}
+
+// zeroPrices returns the prices of t that are set to 0.
+func (t userTier) zeroPrices() priceField {
+	var zero priceField
+	for field, p := range map[priceField]*float64{
+		fieldInput:         t.Input,
+		fieldOutput:        t.Output,
+		fieldCacheReads:    t.CacheRead,
+		fieldCacheWrites:   t.CacheWrite,
+		fieldCacheWrites1h: t.CacheWrite1h,
+	} {
+		if p != nil && *p == 0 {
+			zero |= field
+		}
+	}
+	return zero
+}
+
+func price(p *float64) float64 {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
+
+// FileSource loads negotiated or custom rates from a YAML file. A missing
+// file is not an error.
+type FileSource struct {
+	Path string // empty = DefaultUserPricingPath
+}
+
+func (s *FileSource) Name() string { return SourceUser }
+
+func (s *FileSource) Load(ctx context.Context) (map[string]*ModelInfo, error) {
+	path := s.Path
+	if path == "" {
+		path = DefaultUserPricingPath()
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pricing file: %w", err)
+	}
+
+	var file struct {
+		Models map[string]userPrice `yaml:"models"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid pricing file %s: %w", path, err)
+	}
+
+	models := make(map[string]*ModelInfo, len(file.Models))
+	for id, p := range file.Models {
+		base := p.priceTier()
+		info := &ModelInfo{
+			ModelID:            id,
+			ContextWindow:      p.ContextWindow,
+			MaxTokens:          p.MaxTokens,
+			InputPrice:         base.InputPrice,
+			OutputPrice:        base.OutputPrice,
+			CacheReadsPrice:    base.CacheReadsPrice,
+			CacheWritesPrice:   base.CacheWritesPrice,
+			CacheWrites1hPrice: base.CacheWrites1hPrice,
+			ServiceTiers:       p.ServiceTiers,
+			zeroPrices:         p.zeroPrices(),
+		}
+		for _, tier := range p.Tiers {
+			info.ContextTiers = append(info.ContextTiers, tier.priceTier())
+		}
+		sort.Slice(info.ContextTiers, func(i, j int) bool {
+			return info.ContextTiers[i].AboveTokens < info.ContextTiers[j].AboveTokens
+		})
+		models[id] = info
+	}
+	return models, nil
+}
+
+// OfflineEnv disables the OpenRouter source when set to a true value, so
+// prices come from the embedded snapshot and the user pricing file only.
+const OfflineEnv = "CAPTAIN_PRICING_OFFLINE"
+
+// DefaultSources returns the embedded snapshot, OpenRouter and the user
+// pricing file, lowest precedence first. OpenRouter is left out when
+// OfflineEnv is set.
+func DefaultSources() []PricingSource {
+	if offline, _ := strconv.ParseBool(os.Getenv(OfflineEnv)); offline {
+		return []PricingSource{&SnapshotSource{}, &FileSource{}}
+	}
+	return []PricingSource{&SnapshotSource{}, &OpenRouterSource{}, &FileSource{}}
+}
+
+var (
+	sources     = DefaultSources()
+	sourcesMu   sync.Mutex
+	loadedUntil time.Time
+	loaded      bool          // the registry holds the prices of the current sources
+	loading     chan struct{} // closed when the load in progress finishes
+	generation  int           // bumped by SetSources, so loads of replaced sources are dropped
+	sourceErrs  map[string]error
+)
+
+// SetSources replaces the pricing sources, lowest precedence first, and
+// reloads them on the next lookup. The built-in model catalog always has the
+// lowest precedence.
+func SetSources(s ...PricingSource) {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	sources = s
+	loadedUntil = time.Time{}
+	loaded = false
+	loading = nil
+	generation++
+}
+
+// EnsureLoaded loads every source into the registry, overriding the prices of
+// lower precedence sources field by field. Sources are reloaded once the
+// OpenRouter cache expires; a failed source is retried after a few minutes
+// instead of for the rest of the process. Only the first load blocks: later
+// reloads run in the background while lookups use the prices already loaded.
+func EnsureLoaded() {
+	sourcesMu.Lock()
+	if time.Now().Before(loadedUntil) {
+		sourcesMu.Unlock()
+		return
+	}
+	done := loading
+	if done == nil {
+		done = make(chan struct{})
+		loading = done
+		go load(sources, generation, done)
+	}
+	stale := loaded
+	sourcesMu.Unlock()
+
+	if !stale {
+		<-done
+	}
+}
+
+// load reads srcs without holding sourcesMu, so a slow source does not block
+// lookups, then merges them unless SetSources replaced them meanwhile.
+func load(srcs []PricingSource, gen int, done chan struct{}) {
+	defer close(done)
+
+	results := make([]map[string]*ModelInfo, len(srcs))
+	errs := map[string]error{}
+	for i, src := range srcs {
+		models, err := src.Load(context.Background())
+		if err != nil {
+			logger.Debugf("Failed to load %s pricing: %v", src.Name(), err)
+			errs[src.Name()] = err
+			continue
+		}
+		results[i] = models
+	}
+
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	if gen != generation {
+		return
+	}
+	for i, src := range srcs {
+		if results[i] != nil {
+			mergeSource(src.Name(), results[i])
+		}
+	}
+	sourceErrs = errs
+	loaded = true
+	loading = nil
+	if len(errs) > 0 {
+		loadedUntil = time.Now().Add(retryInterval)
+	} else {
+		loadedUntil = time.Now().Add(cacheExpiryDuration)
+	}
+}
+
+// SourceErrors returns the sources that failed on the last load.
+func SourceErrors() map[string]error {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	result := make(map[string]error, len(sourceErrs))
+	for name, err := range sourceErrs {
+		result[name] = err
+	}
+	return result
+}
+
+// mergeSource overlays models on the registry. Zero fields keep the price
+// of a lower precedence source, so a user file may override only some rates,
+// unless the source set the price to 0 on purpose. Context tiers are replaced
+// as a whole; service tiers are merged by name.
+func mergeSource(source string, models map[string]*ModelInfo) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	for id, info := range models {
+		merged := registry[id]
+		merged.ModelID = id
+		merged.Source = source
+		overlay(&merged.MaxTokens, info.MaxTokens)
+		overlay(&merged.ContextWindow, info.ContextWindow)
+		overlay(&merged.InputPrice, info.InputPrice)
+		overlay(&merged.OutputPrice, info.OutputPrice)
+		overlay(&merged.CacheReadsPrice, info.CacheReadsPrice)
+		overlay(&merged.CacheWritesPrice, info.CacheWritesPrice)
+		overlay(&merged.CacheWrites1hPrice, info.CacheWrites1hPrice)
+		for field, price := range map[priceField]*float64{
+			fieldInput:         &merged.InputPrice,
+			fieldOutput:        &merged.OutputPrice,
+			fieldCacheReads:    &merged.CacheReadsPrice,
+			fieldCacheWrites:   &merged.CacheWritesPrice,
+			fieldCacheWrites1h: &merged.CacheWrites1hPrice,
+		} {
+			if info.zeroPrices&field != 0 {
+				*price = 0
+			}
+		}
+		if len(info.ContextTiers) > 0 {
+			merged.ContextTiers = info.ContextTiers
+		}
+		if len(info.ServiceTiers) > 0 {
+			tiers := make(map[string]float64, len(merged.ServiceTiers)+len(info.ServiceTiers))
+			maps.Copy(tiers, merged.ServiceTiers)
+			maps.Copy(tiers, info.ServiceTiers)
+			merged.ServiceTiers = tiers
+		}
+		registry[id] = merged
+	}
+}
+
+func overlay[T int | float64](dst *T, value T) {
+	if value != 0 {
+		*dst = value
+	}
+}
@@ -0,0 +1,166 @@
+package pricing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	// price with the embedded snapshot only, so results do not follow live prices
+	SetSources(&SnapshotSource{})
+	os.Exit(m.Run())
+}
+
+// stubSource returns price as the input price of test/stub, waiting for
+// release when it is set.
+type stubSource struct {
+	price   float64
+	release chan struct{}
+}
+
+func (s *stubSource) Name() string { return "stub" }
+
+func (s *stubSource) Load(ctx context.Context) (map[string]*ModelInfo, error) {
+	if s.release != nil {
+		<-s.release
+	}
+	return map[string]*ModelInfo{"test/stub": {InputPrice: s.price}}, nil
+}
+
+func TestDefaultSourcesOffline(t *testing.T) {
+	names := func() []string {
+		var names []string
+		for _, src := range DefaultSources() {
+			names = append(names, src.Name())
+		}
+		return names
+	}
+	t.Setenv(OfflineEnv, "")
+	assert.Equal(t, []string{SourceSnapshot, SourceOpenRouter, SourceUser}, names())
+	t.Setenv(OfflineEnv, "1")
+	assert.Equal(t, []string{SourceSnapshot, SourceUser}, names())
+}
+
+func TestEnsureLoadedReloadsInBackground(t *testing.T) {
+	defer SetSources(&SnapshotSource{})
+	src := &stubSource{price: 1}
+	SetSources(src)
+	info, ok := GetModelInfo("test/stub")
+	require.True(t, ok)
+	require.Equal(t, 1.0, info.InputPrice)
+
+	// expire the prices and hold up the reload
+	src.price, src.release = 2, make(chan struct{})
+	sourcesMu.Lock()
+	loadedUntil = time.Time{}
+	sourcesMu.Unlock()
+
+	start := time.Now()
+	info, _ = GetModelInfo("test/stub")
+	assert.Less(t, time.Since(start), time.Second, "lookups do not wait for the reload")
+	assert.Equal(t, 1.0, info.InputPrice, "the loaded prices are used meanwhile")
+
+	close(src.release)
+	require.Eventually(t, func() bool {
+		info, _ := GetModelInfo("test/stub")
+		return info.InputPrice == 2
+	}, time.Second, time.Millisecond)
+}
+
+func TestMergeSource(t *testing.T) {
+	snapshot := &ModelInfo{
+		InputPrice: 3, OutputPrice: 15, CacheReadsPrice: 0.3, ContextWindow: 200_000,
+		ContextTiers: []PriceTier{{AboveTokens: 200_000, InputPrice: 6}},
+		ServiceTiers: map[string]float64{ServiceTierBatch: 0.5},
+	}
+
+	tests := []struct {
+		name   string
+		layers []map[string]*ModelInfo // snapshot, openrouter, user
+		want   ModelInfo
+	}{
+		{
+			name:   "single source",
+			layers: []map[string]*ModelInfo{{"m": snapshot}},
+			want: ModelInfo{Source: SourceSnapshot, InputPrice: 3, OutputPrice: 15, CacheReadsPrice: 0.3, ContextWindow: 200_000,
+				ContextTiers: snapshot.ContextTiers, ServiceTiers: snapshot.ServiceTiers},
+		},
+		{
+			name:   "zero fields keep the lower price",
+			layers: []map[string]*ModelInfo{{"m": snapshot}, {"m": {InputPrice: 2.5, ContextWindow: 1_000_000}}},
+			want: ModelInfo{Source: SourceOpenRouter, InputPrice: 2.5, OutputPrice: 15, CacheReadsPrice: 0.3, ContextWindow: 1_000_000,
+				ContextTiers: snapshot.ContextTiers, ServiceTiers: snapshot.ServiceTiers},
+		},
+		{
+			name: "context tiers are replaced and service tiers merged",
+			layers: []map[string]*ModelInfo{{"m": snapshot}, {"m": {OutputPrice: 10}}, {"m": {
+				ContextTiers: []PriceTier{{AboveTokens: 128_000, OutputPrice: 20}},
+				ServiceTiers: map[string]float64{ServiceTierPriority: 2},
+			}}},
+			want: ModelInfo{Source: SourceUser, InputPrice: 3, OutputPrice: 10, CacheReadsPrice: 0.3, ContextWindow: 200_000,
+				ContextTiers: []PriceTier{{AboveTokens: 128_000, OutputPrice: 20}},
+				ServiceTiers: map[string]float64{ServiceTierBatch: 0.5, ServiceTierPriority: 2}},
+		},
+		{
+			name:   "prices set to zero on purpose replace the lower price",
+			layers: []map[string]*ModelInfo{{"m": snapshot}, {}, {"m": {OutputPrice: 12, zeroPrices: fieldCacheReads}}},
+			want: ModelInfo{Source: SourceUser, InputPrice: 3, OutputPrice: 12, ContextWindow: 200_000,
+				ContextTiers: snapshot.ContextTiers, ServiceTiers: snapshot.ServiceTiers},
+		},
+		{
+			name:   "a model only the user prices",
+			layers: []map[string]*ModelInfo{{}, {}, {"m": {InputPrice: 1}}},
+			want:   ModelInfo{Source: SourceUser, InputPrice: 1},
+		},
+	}
+	names := []string{SourceSnapshot, SourceOpenRouter, SourceUser}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := "test/merge-" + t.Name()
+			for i, layer := range tt.layers {
+				models := map[string]*ModelInfo{}
+				for _, info := range layer {
+					models[id] = info
+				}
+				mergeSource(names[i], models)
+			}
+
+			registryMu.RLock()
+			got := registry[id]
+			registryMu.RUnlock()
+			tt.want.ModelID = id
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFileSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pricing.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`models:
+  anthropic/claude-sonnet-4.5:
+    input: 2.70
+    cache_read: 0
+    tiers:
+      - above: 200000
+        input: 5.40
+`), 0o600))
+
+	models, err := (&FileSource{Path: path}).Load(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &ModelInfo{
+		ModelID:      "anthropic/claude-sonnet-4.5",
+		InputPrice:   2.70,
+		ContextTiers: []PriceTier{{AboveTokens: 200_000, InputPrice: 5.40}},
+		zeroPrices:   fieldCacheReads,
+	}, models["anthropic/claude-sonnet-4.5"], "only the cache read price is zero on purpose")
+
+	models, err = (&FileSource{Path: filepath.Join(t.TempDir(), "missing.yaml")}).Load(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, models)
+}
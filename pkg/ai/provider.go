@@ -14,6 +14,14 @@ const (
 	BackendClaudeCLI Backend = "claude-cli"
 	BackendCodexCLI  Backend = "codex-cli"
 	BackendGeminiCLI Backend = "gemini-cli"
+	BackendOpenAI    Backend = "openai"
+	BackendOllama    Backend = "ollama"
+)
+
+const (
+	OpenAIBaseURL = "https://api.openai.com/v1"
+	XAIBaseURL    = "https://api.x.ai/v1"
+	OllamaBaseURL = "http://localhost:11434"
 )
 
 type Provider interface {
@@ -27,6 +35,12 @@ type StreamingProvider interface {
 	ExecuteStream(ctx context.Context, req Request) (<-chan Event, error)
 }
 
+// ModelLister is implemented by providers that can discover the models they
+// serve, such as a local Ollama server.
+type ModelLister interface {
+	ListModels(ctx context.Context) ([]ModelDef, error)
+}
+
 func InferBackend(model string) (Backend, error) {
 	m := strings.ToLower(model)
 
@@ -34,12 +48,15 @@ func InferBackend(model string) (Backend, error) {
 	if strings.HasPrefix(m, "claude-code-") {
 		return BackendClaudeCLI, nil
 	}
-	if strings.HasPrefix(m, "codex-") || strings.HasPrefix(m, "codex") {
+	if strings.HasPrefix(m, "codex") || (strings.HasPrefix(m, "gpt-") && strings.Contains(m, "-codex")) {
 		return BackendCodexCLI, nil
 	}
 	if strings.HasPrefix(m, "gemini-cli-") {
 		return BackendGeminiCLI, nil
 	}
+	if strings.HasPrefix(m, "ollama/") {
+		return BackendOllama, nil
+	}
 
 	// API backends
 	if strings.HasPrefix(m, "claude-") {
@@ -49,7 +66,7 @@ func InferBackend(model string) (Backend, error) {
 		return BackendGemini, nil
 	}
 	if strings.HasPrefix(m, "gpt-") || strings.HasPrefix(m, "o1") || strings.HasPrefix(m, "o3") || strings.HasPrefix(m, "o4") || strings.HasPrefix(m, "grok-") {
-		return BackendCodexCLI, nil
+		return BackendOpenAI, nil
 	}
 
 	// Check if the model is in the default catalog
@@ -59,5 +76,5 @@ func InferBackend(model string) (Backend, error) {
 		}
 	}
 
-	return "", fmt.Errorf("unable to infer backend from model name: %s (known backends: anthropic, gemini, codex-cli, claude-cli, gemini-cli)", model)
+	return "", fmt.Errorf("unable to infer backend from model name: %s (known backends: anthropic, gemini, openai, ollama, codex-cli, claude-cli, gemini-cli)", model)
 }
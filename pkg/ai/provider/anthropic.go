@@ -2,6 +2,7 @@ package provider
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -15,6 +16,7 @@ import (
 type Anthropic struct {
 	model      string
 	apiKey     string
+	apiURL     string
 	httpClient *http.Client
 }
 
@@ -23,23 +25,30 @@ func NewAnthropic(cfg ai.Config) *Anthropic {
 	if model == "" {
 		model = "claude-sonnet-4"
 	}
-	return &Anthropic{model: model, apiKey: cfg.APIKey, httpClient: cfg.HTTPClient}
+	return &Anthropic{model: model, apiKey: cfg.APIKey, apiURL: cfg.APIURL, httpClient: cfg.HTTPClient}
 }
 
-func (a *Anthropic) GetModel() string      { return a.model }
+func (a *Anthropic) GetModel() string       { return a.model }
 func (a *Anthropic) GetBackend() ai.Backend { return ai.BackendAnthropic }
 
-func (a *Anthropic) Execute(ctx context.Context, req ai.Request) (*ai.Response, error) {
-	start := time.Now()
-
+func (a *Anthropic) newClient() anthropic.Client {
 	var opts []option.RequestOption
 	if a.apiKey != "" {
 		opts = append(opts, option.WithAPIKey(a.apiKey))
 	}
+	if a.apiURL != "" {
+		opts = append(opts, option.WithBaseURL(a.apiURL))
+	}
 	if a.httpClient != nil {
 		opts = append(opts, option.WithHTTPClient(a.httpClient))
 	}
-	client := anthropic.NewClient(opts...)
+	return anthropic.NewClient(opts...)
+}
+
+func (a *Anthropic) buildParams(req ai.Request) (anthropic.MessageNewParams, error) {
+	if err := ai.CheckReasoning(a.model, req); err != nil {
+		return anthropic.MessageNewParams{}, err
+	}
 
 	maxTokens := int64(req.MaxTokens)
 	if maxTokens <= 0 {
@@ -49,52 +58,90 @@ func (a *Anthropic) Execute(ctx context.Context, req ai.Request) (*ai.Response,
 	params := anthropic.MessageNewParams{
 		Model:     anthropic.Model(a.model),
 		MaxTokens: maxTokens,
-		Messages: []anthropic.MessageParam{
-			anthropic.NewUserMessage(anthropic.NewTextBlock(req.Prompt)),
-		},
+		Messages:  anthropicMessages(req.AllMessages()),
 	}
 
 	if req.SystemPrompt != "" {
 		params.System = []anthropic.TextBlockParam{{Text: req.SystemPrompt}}
 	}
-	if req.Temperature > 0 {
+
+	if budget := int64(req.ThinkingTokens()); budget > 0 {
+		// the API requires at least 1024 thinking tokens, a max_tokens above the
+		// budget and the default temperature
+		budget = max(budget, 1024)
+		params.Thinking = anthropic.ThinkingConfigParamOfEnabled(budget)
+		if params.MaxTokens <= budget {
+			params.MaxTokens = budget + maxTokens
+		}
+	} else if req.Temperature > 0 {
 		params.Temperature = anthropic.Float(req.Temperature)
 	}
 
 	if req.StructuredOutput != nil {
 		schema, err := GenerateJSONSchema(req.StructuredOutput)
 		if err != nil {
-			return nil, fmt.Errorf("failed to generate schema: %w", err)
+			return params, fmt.Errorf("failed to generate schema: %w", err)
 		}
 		schemaJSON, err := SchemaToJSON(schema)
 		if err != nil {
-			return nil, fmt.Errorf("failed to marshal schema: %w", err)
+			return params, fmt.Errorf("failed to marshal schema: %w", err)
 		}
 		params.System = append(params.System, anthropic.TextBlockParam{
 			Text: fmt.Sprintf("Respond with ONLY valid JSON matching this schema:\n%s", schemaJSON),
 		})
 	}
 
+	for _, tool := range req.Tools {
+		toolParam, err := anthropicTool(tool)
+		if err != nil {
+			return params, err
+		}
+		params.Tools = append(params.Tools, anthropic.ToolUnionParam{OfTool: &toolParam})
+	}
+	return params, nil
+}
+
+func (a *Anthropic) Execute(ctx context.Context, req ai.Request) (*ai.Response, error) {
+	start := time.Now()
+	client := a.newClient()
+
+	params, err := a.buildParams(req)
+	if err != nil {
+		return nil, err
+	}
+
 	msg, err := client.Messages.New(ctx, params)
 	if err != nil {
-		if ctx.Err() != nil {
-			return nil, fmt.Errorf("%w: %v", ai.ErrTimeout, ctx.Err())
-		}
-		return nil, fmt.Errorf("anthropic API error: %w", err)
+		return nil, anthropicError(ctx, err)
 	}
 
-	var text string
+	return anthropicResponse(msg, req, start)
+}
+
+// anthropicResponse converts a reply into an ai.Response, decoding structured
+// output when the request asked for it.
+func anthropicResponse(msg *anthropic.Message, req ai.Request, start time.Time) (*ai.Response, error) {
+	var text, thinking string
+	var toolCalls []ai.ToolCall
+	var thinkingBlocks []ai.Thinking
 	for _, block := range msg.Content {
-		if block.Type == "text" {
+		switch block.Type {
+		case "text":
 			text += block.Text
+		case "thinking":
+			thinking += block.Thinking
+			thinkingBlocks = append(thinkingBlocks, ai.Thinking{Text: block.Thinking, Signature: block.Signature})
+		case "redacted_thinking":
+			thinkingBlocks = append(thinkingBlocks, ai.Thinking{Redacted: block.Data})
+		case "tool_use":
+			toolCalls = append(toolCalls, ai.ToolCall{ID: block.ID, Name: block.Name, Input: block.Input})
 		}
 	}
 
 	var structuredData any
-	if req.StructuredOutput != nil {
-		cleaned := CleanupJSONResponse(text)
-		if err := json.Unmarshal([]byte(cleaned), req.StructuredOutput); err != nil {
-			return nil, fmt.Errorf("%w: %v", ai.ErrSchemaValidation, err)
+	if req.StructuredOutput != nil && len(toolCalls) == 0 {
+		if err := DecodeStructured(text, req.StructuredOutput); err != nil {
+			return nil, withUsage(err, anthropicUsage(msg.Usage))
 		}
 		structuredData = req.StructuredOutput
 		text = ""
@@ -102,16 +149,180 @@ func (a *Anthropic) Execute(ctx context.Context, req ai.Request) (*ai.Response,
 
 	return &ai.Response{
 		Text:           text,
+		Thinking:       thinking,
 		StructuredData: structuredData,
+		ToolCalls:      toolCalls,
+		ThinkingBlocks: thinkingBlocks,
 		Model:          string(msg.Model),
 		Backend:        ai.BackendAnthropic,
-		Usage: ai.Usage{
-			InputTokens:      int(msg.Usage.InputTokens),
-			OutputTokens:     int(msg.Usage.OutputTokens),
-			CacheReadTokens:  int(msg.Usage.CacheReadInputTokens),
-			CacheWriteTokens: int(msg.Usage.CacheCreationInputTokens),
-		},
-		Duration: time.Since(start),
-		Raw:      msg,
+		Usage:          anthropicUsage(msg.Usage),
+		Duration:       time.Since(start),
+		Raw:            msg,
 	}, nil
 }
+
+// ExecuteStream streams text and thinking deltas as they arrive, followed by a
+// single EventResult carrying the accumulated usage and cost. The channel is
+// closed when the stream ends or ctx is cancelled.
+func (a *Anthropic) ExecuteStream(ctx context.Context, req ai.Request) (<-chan ai.Event, error) {
+	client := a.newClient()
+
+	params, err := a.buildParams(req)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := client.Messages.NewStreaming(ctx, params)
+	if err := stream.Err(); err != nil {
+		return nil, anthropicError(ctx, err)
+	}
+
+	events := make(chan ai.Event)
+	go func() {
+		defer close(events)
+		defer func() { _ = stream.Close() }()
+
+		var msg anthropic.Message
+		for stream.Next() {
+			event := stream.Current()
+			if err := msg.Accumulate(event); err != nil {
+				sendEvent(ctx, events, ai.Event{Kind: ai.EventError, Model: a.model, Error: err.Error()})
+				return
+			}
+
+			if event.Type != "content_block_delta" {
+				continue
+			}
+			switch event.Delta.Type {
+			case "text_delta":
+				if !sendEvent(ctx, events, ai.Event{Kind: ai.EventText, Text: event.Delta.Text, Model: a.model}) {
+					return
+				}
+			case "thinking_delta":
+				if !sendEvent(ctx, events, ai.Event{Kind: ai.EventThinking, Text: event.Delta.Thinking, Model: a.model}) {
+					return
+				}
+			}
+		}
+
+		if err := stream.Err(); err != nil {
+			sendEvent(ctx, events, ai.Event{Kind: ai.EventError, Model: a.model, Error: anthropicError(ctx, err).Error()})
+			return
+		}
+
+		for _, block := range msg.Content {
+			if block.Type != "tool_use" {
+				continue
+			}
+			var input map[string]any
+			_ = json.Unmarshal(block.Input, &input)
+			if !sendEvent(ctx, events, ai.Event{Kind: ai.EventToolUse, Tool: block.Name, Input: input, Model: a.model}) {
+				return
+			}
+		}
+
+		model := string(msg.Model)
+		if model == "" {
+			model = a.model
+		}
+		usage := anthropicUsage(msg.Usage)
+		sendEvent(ctx, events, ai.Event{
+			Kind:    ai.EventResult,
+			Model:   model,
+			Usage:   &usage,
+			CostUSD: calculateCostUSD(ai.BackendAnthropic, model, usage),
+			Success: true,
+		})
+	}()
+
+	return events, nil
+}
+
+func anthropicMessages(msgs []ai.Message) []anthropic.MessageParam {
+	params := make([]anthropic.MessageParam, 0, len(msgs))
+	for _, msg := range msgs {
+		var blocks []anthropic.ContentBlockParamUnion
+		for _, block := range msg.Content {
+			switch {
+			case block.Kind == ai.ContentText:
+				blocks = append(blocks, anthropic.NewTextBlock(block.Text))
+			case block.Kind == ai.ContentToolUse && block.ToolCall != nil:
+				blocks = append(blocks, anthropic.NewToolUseBlock(block.ToolCall.ID, toolInput(block.ToolCall.Input), block.ToolCall.Name))
+			case block.Kind == ai.ContentToolResult && block.ToolResult != nil:
+				blocks = append(blocks, anthropic.NewToolResultBlock(block.ToolResult.CallID, block.ToolResult.Content, block.ToolResult.IsError))
+			case block.Kind == ai.ContentAttachment && block.Attachment != nil:
+				blocks = append(blocks, anthropicAttachment(*block.Attachment))
+			case block.Kind == ai.ContentThinking && block.Thinking != nil && block.Thinking.Redacted != "":
+				blocks = append(blocks, anthropic.NewRedactedThinkingBlock(block.Thinking.Redacted))
+			case block.Kind == ai.ContentThinking && block.Thinking != nil:
+				blocks = append(blocks, anthropic.NewThinkingBlock(block.Thinking.Signature, block.Thinking.Text))
+			}
+		}
+		if msg.Role == ai.RoleAssistant {
+			params = append(params, anthropic.NewAssistantMessage(blocks...))
+		} else {
+			params = append(params, anthropic.NewUserMessage(blocks...))
+		}
+	}
+	return params
+}
+
+// anthropicAttachment sends images as image blocks and PDFs and text files as
+// document blocks titled with the file name.
+func anthropicAttachment(a ai.Attachment) anthropic.ContentBlockParamUnion {
+	if a.IsImage() {
+		return anthropic.NewImageBlockBase64(a.MIMEType, base64.StdEncoding.EncodeToString(a.Data))
+	}
+
+	var block anthropic.ContentBlockParamUnion
+	if a.IsPDF() {
+		block = anthropic.NewDocumentBlock(anthropic.Base64PDFSourceParam{Data: base64.StdEncoding.EncodeToString(a.Data)})
+	} else {
+		block = anthropic.NewDocumentBlock(anthropic.PlainTextSourceParam{Data: string(a.Data)})
+	}
+	if a.Name != "" {
+		block.OfDocument.Title = anthropic.String(a.Name)
+	}
+	return block
+}
+
+// anthropicTool splits the tool's JSON schema into the properties/required
+// fields the SDK models explicitly, passing any other keywords through.
+func anthropicTool(tool ai.Tool) (anthropic.ToolParam, error) {
+	schema, err := schemaMap(tool.InputSchema)
+	if err != nil {
+		return anthropic.ToolParam{}, fmt.Errorf("invalid input schema for tool %s: %w", tool.Name, err)
+	}
+
+	inputSchema := anthropic.ToolInputSchemaParam{Properties: schema["properties"]}
+	if required, ok := schema["required"].([]any); ok {
+		for _, name := range required {
+			if s, ok := name.(string); ok {
+				inputSchema.Required = append(inputSchema.Required, s)
+			}
+		}
+	}
+	delete(schema, "type")
+	delete(schema, "properties")
+	delete(schema, "required")
+	if len(schema) > 0 {
+		inputSchema.ExtraFields = schema
+	}
+
+	param := anthropic.ToolParam{Name: tool.Name, InputSchema: inputSchema}
+	if tool.Description != "" {
+		param.Description = anthropic.String(tool.Description)
+	}
+	return param, nil
+}
+
+func anthropicUsage(u anthropic.Usage) ai.Usage {
+	return ai.Usage{
+		InputTokens:        int(u.InputTokens),
+		OutputTokens:       int(u.OutputTokens),
+		CacheReadTokens:    int(u.CacheReadInputTokens),
+		CacheWriteTokens:   int(u.CacheCreationInputTokens),
+		CacheWrite1hTokens: int(u.CacheCreation.Ephemeral1hInputTokens),
+		ServiceTier:        string(u.ServiceTier),
+	}
+}
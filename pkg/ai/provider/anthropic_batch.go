@@ -0,0 +1,96 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/flanksource/captain/pkg/ai"
+)
+
+type anthropicBatchRequest struct {
+	CustomID string                     `json:"custom_id"`
+	Params   anthropic.MessageNewParams `json:"params"`
+}
+
+// SubmitBatch sends reqs as a Message Batch, polls every pollInterval until
+// processing has ended and returns the results in request order. Requests are
+// identified by their index. If ctx is cancelled while polling, the batch is
+// cancelled too.
+func (a *Anthropic) SubmitBatch(ctx context.Context, reqs []ai.Request, pollInterval time.Duration) (string, []ai.BatchResult, error) {
+	start := time.Now()
+	client := a.newClient()
+	results := make([]ai.BatchResult, len(reqs))
+
+	var requests []anthropicBatchRequest
+	for i, req := range reqs {
+		params, err := a.buildParams(req)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		requests = append(requests, anthropicBatchRequest{CustomID: strconv.Itoa(i), Params: params})
+	}
+	if len(requests) == 0 {
+		return "", results, nil
+	}
+
+	body, err := json.Marshal(map[string]any{"requests": requests})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to marshal batch: %w", err)
+	}
+	batch, err := client.Messages.Batches.New(ctx, anthropic.MessageBatchNewParams{}, option.WithRequestBody("application/json", body))
+	if err != nil {
+		return "", nil, anthropicError(ctx, err)
+	}
+	id := batch.ID
+
+	for batch.ProcessingStatus != anthropic.MessageBatchProcessingStatusEnded {
+		select {
+		case <-ctx.Done():
+			_, _ = client.Messages.Batches.Cancel(context.Background(), id)
+			return id, nil, fmt.Errorf("%w: %v", ai.ErrTimeout, ctx.Err())
+		case <-time.After(pollInterval):
+		}
+		if batch, err = client.Messages.Batches.Get(ctx, id); err != nil {
+			return id, nil, anthropicError(ctx, err)
+		}
+	}
+
+	stream := client.Messages.Batches.ResultsStreaming(ctx, id)
+	defer func() { _ = stream.Close() }()
+	for stream.Next() {
+		item := stream.Current()
+		i, err := strconv.Atoi(item.CustomID)
+		if err != nil || i < 0 || i >= len(reqs) {
+			continue
+		}
+		switch result := item.Result; result.Type {
+		case "succeeded":
+			results[i].Response, results[i].Err = anthropicResponse(&result.Message, reqs[i], start)
+		case "errored":
+			e := result.Error.Error
+			results[i].Err = &ai.ProviderError{
+				Backend:  ai.BackendAnthropic,
+				Category: ai.ClassifyError(0, e.Type, e.Message),
+				Message:  e.Message,
+			}
+		default:
+			results[i].Err = fmt.Errorf("batch request %s", result.Type)
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return id, nil, anthropicError(ctx, err)
+	}
+
+	for i := range results {
+		if results[i].Response == nil && results[i].Err == nil {
+			results[i].Err = fmt.Errorf("batch %s returned no result for request %d", id, i)
+		}
+	}
+	return id, results, nil
+}
@@ -2,8 +2,13 @@ package provider
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/flanksource/captain/pkg/ai"
 	"github.com/stretchr/testify/require"
@@ -67,3 +72,173 @@ func TestAnthropicStructuredIntegration(t *testing.T) {
 	require.Equal(t, "Paris", result.City)
 	require.Equal(t, "France", result.Country)
 }
+
+func TestAnthropicExecuteStream(t *testing.T) {
+	events := []string{
+		`{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"claude-sonnet-4-6","content":[],"usage":{"input_tokens":12,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":"","signature":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"Let me think"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"Hello"}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":" world"}}`,
+		`{"type":"content_block_stop","index":1}`,
+		`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":7}}`,
+		`{"type":"message_stop"}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, e := range events {
+			var typed struct{ Type string }
+			_ = json.Unmarshal([]byte(e), &typed)
+			_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", typed.Type, e)
+		}
+	}))
+	defer server.Close()
+
+	p := NewAnthropic(ai.Config{Model: "claude-sonnet-4-6", APIKey: "key", APIURL: server.URL})
+	ch, err := p.ExecuteStream(context.Background(), ai.Request{Prompt: "hi"})
+	require.NoError(t, err)
+
+	var text, thinking string
+	var result *ai.Event
+	for ev := range ch {
+		switch ev.Kind {
+		case ai.EventText:
+			text += ev.Text
+		case ai.EventThinking:
+			thinking += ev.Text
+		case ai.EventResult:
+			result = &ev
+		case ai.EventError:
+			t.Fatalf("unexpected error event: %s", ev.Error)
+		}
+	}
+
+	require.Equal(t, "Hello world", text)
+	require.Equal(t, "Let me think", thinking)
+	require.NotNil(t, result)
+	require.True(t, result.Success)
+	require.Equal(t, 12, result.Usage.InputTokens)
+	require.Equal(t, 7, result.Usage.OutputTokens)
+	require.Greater(t, result.CostUSD, 0.0)
+}
+
+func TestAnthropicExecuteStreamCancel(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = fmt.Fprint(w, "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"m\",\"type\":\"message\",\"role\":\"assistant\",\"model\":\"claude-sonnet-4-6\",\"content\":[],\"usage\":{\"input_tokens\":1}}}\n\n")
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := NewAnthropic(ai.Config{Model: "claude-sonnet-4-6", APIKey: "key", APIURL: server.URL})
+	ch, err := p.ExecuteStream(ctx, ai.Request{Prompt: "hi"})
+	require.NoError(t, err)
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		for range ch {
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream channel was not closed after context cancellation")
+	}
+}
+
+func TestAnthropicMessagesHistory(t *testing.T) {
+	var body struct {
+		Messages []struct {
+			Role    string `json:"role"`
+			Content []struct {
+				Text string `json:"text"`
+			} `json:"content"`
+		} `json:"messages"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"id":"m","type":"message","role":"assistant","model":"claude-sonnet-4-6","content":[{"type":"text","text":"Blue"}],"usage":{"input_tokens":5,"output_tokens":1}}`)
+	}))
+	defer server.Close()
+
+	p := NewAnthropic(ai.Config{Model: "claude-sonnet-4-6", APIKey: "key", APIURL: server.URL})
+	resp, err := p.Execute(context.Background(), ai.Request{
+		Messages: []ai.Message{ai.UserMessage("Pick a colour"), ai.AssistantMessage("Red")},
+		Prompt:   "Another?",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "Blue", resp.Text)
+
+	require.Len(t, body.Messages, 3)
+	require.Equal(t, "user", body.Messages[0].Role)
+	require.Equal(t, "assistant", body.Messages[1].Role)
+	require.Equal(t, "Red", body.Messages[1].Content[0].Text)
+	require.Equal(t, "Another?", body.Messages[2].Content[0].Text)
+}
+
+func TestAnthropicSubmitBatch(t *testing.T) {
+	var submitted struct {
+		Requests []struct {
+			CustomID string `json:"custom_id"`
+			Params   struct {
+				Model string `json:"model"`
+			} `json:"params"`
+		} `json:"requests"`
+	}
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/messages/batches":
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&submitted))
+			_, _ = fmt.Fprint(w, `{"id":"msgbatch_1","type":"message_batch","processing_status":"in_progress"}`)
+		case r.URL.Path == "/v1/messages/batches/msgbatch_1":
+			polls++
+			_, _ = fmt.Fprint(w, `{"id":"msgbatch_1","type":"message_batch","processing_status":"ended"}`)
+		case r.URL.Path == "/v1/messages/batches/msgbatch_1/results":
+			w.Header().Set("Content-Type", "application/x-jsonl")
+			// results arrive in completion order, not request order
+			_, _ = fmt.Fprintln(w, `{"custom_id":"2","result":{"type":"expired"}}`)
+			_, _ = fmt.Fprintln(w, `{"custom_id":"1","result":{"type":"errored","error":{"type":"error","error":{"type":"invalid_request_error","message":"prompt is too long"}}}}`)
+			_, _ = fmt.Fprintln(w, `{"custom_id":"0","result":{"type":"succeeded","message":{"id":"m","type":"message","role":"assistant","model":"claude-sonnet-4-6","content":[{"type":"text","text":"positive"}],"usage":{"input_tokens":10,"output_tokens":1}}}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	p := NewAnthropic(ai.Config{Model: "claude-sonnet-4-6", APIKey: "key", APIURL: server.URL})
+	id, results, err := p.SubmitBatch(context.Background(), []ai.Request{
+		{Prompt: "Great product"}, {Prompt: "long"}, {Prompt: "late"},
+	}, time.Millisecond)
+	require.NoError(t, err)
+	require.Equal(t, "msgbatch_1", id)
+	require.Equal(t, 1, polls)
+
+	require.Len(t, submitted.Requests, 3)
+	require.Equal(t, "0", submitted.Requests[0].CustomID)
+	require.Equal(t, "claude-sonnet-4-6", submitted.Requests[0].Params.Model)
+
+	require.Len(t, results, 3)
+	require.NoError(t, results[0].Err)
+	require.Equal(t, "positive", results[0].Response.Text)
+	require.Equal(t, 10, results[0].Response.Usage.InputTokens)
+
+	perr, ok := ai.AsProviderError(results[1].Err)
+	require.True(t, ok)
+	require.Equal(t, ai.CategoryContextLength, perr.Category)
+
+	require.ErrorContains(t, results[2].Err, "expired")
+}
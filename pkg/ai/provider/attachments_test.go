@@ -0,0 +1,106 @@
+package provider
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flanksource/captain/pkg/ai"
+	"github.com/stretchr/testify/require"
+)
+
+// pngHeader is enough of a PNG file for content sniffing.
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func testAttachments(t *testing.T) []ai.Attachment {
+	t.Helper()
+	image, err := ai.NewAttachment("screenshot", pngHeader)
+	require.NoError(t, err)
+	require.Equal(t, "image/png", image.MIMEType)
+
+	pdf, err := ai.NewAttachment("report.pdf", []byte("%PDF-1.7"))
+	require.NoError(t, err)
+
+	text, err := ai.NewAttachment("notes.md", []byte("# Notes"))
+	require.NoError(t, err)
+	require.True(t, text.IsText())
+	return []ai.Attachment{image, pdf, text}
+}
+
+func TestAnthropicAttachments(t *testing.T) {
+	var body struct {
+		Messages []struct {
+			Content []map[string]any `json:"content"`
+		} `json:"messages"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"id":"m","type":"message","role":"assistant","model":"claude-sonnet-4-6","content":[{"type":"text","text":"A login form"}],"usage":{"input_tokens":1500,"output_tokens":4}}`)
+	}))
+	defer server.Close()
+
+	p := NewAnthropic(ai.Config{Model: "claude-sonnet-4-6", APIKey: "key", APIURL: server.URL})
+	resp, err := p.Execute(context.Background(), ai.Request{Prompt: "What is on screen?", Attachments: testAttachments(t)})
+	require.NoError(t, err)
+	require.Equal(t, "A login form", resp.Text)
+
+	require.Len(t, body.Messages, 1)
+	content := body.Messages[0].Content
+	require.Len(t, content, 4)
+
+	require.Equal(t, "image", content[0]["type"])
+	source := content[0]["source"].(map[string]any)
+	require.Equal(t, "image/png", source["media_type"])
+	require.Equal(t, base64.StdEncoding.EncodeToString(pngHeader), source["data"])
+
+	require.Equal(t, "document", content[1]["type"])
+	require.Equal(t, "report.pdf", content[1]["title"])
+	require.Equal(t, "application/pdf", content[1]["source"].(map[string]any)["media_type"])
+
+	require.Equal(t, "document", content[2]["type"])
+	require.Equal(t, "# Notes", content[2]["source"].(map[string]any)["data"])
+
+	require.Equal(t, "text", content[3]["type"])
+	require.Equal(t, "What is on screen?", content[3]["text"])
+}
+
+func TestGeminiAttachments(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"candidates":[{"content":{"role":"model","parts":[{"text":"A login form"}]}}],"usageMetadata":{"promptTokenCount":300,"candidatesTokenCount":4}}`)
+	}))
+	defer server.Close()
+
+	p := NewGemini(ai.Config{Model: "gemini-2.5-flash", APIKey: "key", APIURL: server.URL})
+	resp, err := p.Execute(context.Background(), ai.Request{Prompt: "What is on screen?", Attachments: testAttachments(t)})
+	require.NoError(t, err)
+	require.Equal(t, "A login form", resp.Text)
+
+	require.Contains(t, body, `"inlineData":{"data":"`+base64.StdEncoding.EncodeToString(pngHeader)+`","mimeType":"image/png"}`)
+	require.Contains(t, body, `"mimeType":"application/pdf"`)
+	require.Contains(t, body, `"mimeType":"text/plain"`)
+}
+
+func TestUnsupportedAttachments(t *testing.T) {
+	_, err := ai.NewAttachment("archive.zip", []byte("PK\x03\x04"))
+	require.ErrorIs(t, err, ai.ErrUnsupportedAttachment)
+
+	req := ai.Request{Prompt: "hi", Attachments: testAttachments(t)[:1]}
+	providers := []ai.Provider{
+		NewClaudeCLI("sonnet"), NewCodexCLI(""), NewGeminiCLI(""),
+		NewOpenAI(ai.Config{Model: "gpt-4o", APIKey: "key"}), NewOllama(ai.Config{Model: "llama3.2"}),
+	}
+	for _, p := range providers {
+		_, err := p.Execute(context.Background(), req)
+		require.ErrorIs(t, err, ai.ErrAttachmentsNotSupported, p.GetBackend())
+	}
+}
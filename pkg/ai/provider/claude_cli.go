@@ -1,6 +1,8 @@
 package provider
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -8,9 +10,11 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/flanksource/captain/pkg/ai"
+	"github.com/flanksource/captain/pkg/claude"
 )
 
 type ClaudeCLI struct {
@@ -51,28 +55,145 @@ type claudeCLIUsage struct {
 
 func (c *ClaudeCLI) Execute(ctx context.Context, req ai.Request) (*ai.Response, error) {
 	start := time.Now()
-	timeout := 60 * time.Second
+	ctx, cancel := context.WithTimeout(ctx, claudeCLITimeout(req))
+	defer cancel()
+
+	// --verbose makes the json output the list of every message, so the
+	// thinking blocks are kept alongside the result
+	args, err := c.buildArgs(req, "json", "--max-turns", "1", "--verbose")
+	if err != nil {
+		return nil, err
+	}
+
+	stdoutData, stderrData, err := runClaudeCLI(ctx, args, claudeCLIEnv(req))
+	if err != nil {
+		return nil, err
+	}
+	cliResp, thinking, err := parseClaudeCLIOutput(stdoutData)
+	if err != nil {
+		return nil, err
+	}
+	_ = stderrData
+
+	if cliResp.IsError || cliResp.Error != "" {
+		msg := cliResp.Error
+		if msg == "" {
+			msg = cliResp.Result
+		}
+		return nil, cliError(ai.BackendClaudeCLI, "", msg)
+	}
+
+	usage := ai.Usage{}
+	if cliResp.Usage != nil {
+		usage = ai.Usage{
+			InputTokens:      cliResp.Usage.InputTokens,
+			OutputTokens:     cliResp.Usage.OutputTokens,
+			ReasoningTokens:  cliResp.Usage.ReasoningTokens,
+			CacheReadTokens:  cliResp.Usage.CacheReadTokens,
+			CacheWriteTokens: cliResp.Usage.CacheWriteTokens,
+		}
+	}
+
+	var structuredData any
+	if req.StructuredOutput != nil {
+		if cliResp.Structured == nil {
+			return nil, fmt.Errorf("%w: no structured data in response", ai.ErrSchemaValidation)
+		}
+		structBytes, err := json.Marshal(cliResp.Structured)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal structured response: %w", err)
+		}
+		if err := DecodeStructured(string(structBytes), req.StructuredOutput); err != nil {
+			return nil, withUsage(err, usage)
+		}
+		structuredData = req.StructuredOutput
+	}
+
+	text := cliResp.Result
 	if req.StructuredOutput != nil {
-		timeout = 120 * time.Second
+		text = ""
 	}
-	if deadline, ok := ctx.Deadline(); ok {
-		if ctxTimeout := time.Until(deadline); ctxTimeout < timeout {
-			timeout = ctxTimeout
+
+	return &ai.Response{
+		Text:           text,
+		Thinking:       thinking,
+		StructuredData: structuredData,
+		Model:          c.model,
+		Backend:        ai.BackendClaudeCLI,
+		Usage:          usage,
+		Duration:       time.Since(start),
+		Raw:            cliResp,
+	}, nil
+}
+
+// parseClaudeCLIOutput decodes `--output-format json` output: the result
+// object alone, or with --verbose the list of messages ending in it, from
+// whose assistant turns the thinking is collected.
+func parseClaudeCLIOutput(stdout []byte) (claudeCLIResponse, string, error) {
+	var cliResp claudeCLIResponse
+	output := string(stdout)
+	if idx := strings.IndexAny(output, "[{"); idx >= 0 {
+		output = output[idx:]
+	}
+	if !strings.HasPrefix(output, "[") {
+		if err := json.Unmarshal([]byte(output), &cliResp); err != nil {
+			return cliResp, "", fmt.Errorf("failed to parse CLI response: %w (output: %s)", err, output)
 		}
+		return cliResp, "", nil
 	}
 
-	ctx, cancel := context.WithTimeout(ctx, timeout)
-	defer cancel()
+	var lines []json.RawMessage
+	if err := json.Unmarshal([]byte(output), &lines); err != nil {
+		return cliResp, "", fmt.Errorf("failed to parse CLI response: %w (output: %s)", err, output)
+	}
+	var thinking strings.Builder
+	found := false
+	for _, raw := range lines {
+		line, err := claude.DecodeStreamJSONLine(raw)
+		if err != nil {
+			continue
+		}
+		switch line.Type {
+		case "assistant":
+			msg, ok := line.AssistantMessage()
+			if !ok {
+				continue
+			}
+			for _, block := range msg.Content {
+				if block.Type == claude.ContentTypeThinking {
+					thinking.WriteString(block.Thinking)
+				}
+			}
+		case "result":
+			if err := json.Unmarshal(raw, &cliResp); err != nil {
+				return cliResp, "", fmt.Errorf("failed to parse CLI result: %w", err)
+			}
+			found = true
+		}
+	}
+	if !found {
+		return cliResp, "", fmt.Errorf("no result in CLI response (output: %s)", output)
+	}
+	return cliResp, thinking.String(), nil
+}
 
-	actualModel := MapClaudeCodeModel(c.model)
+// buildArgs assembles the `claude -p` arguments for req, with outputFormat
+// and any extra flags placed before the prompt.
+func (c *ClaudeCLI) buildArgs(req ai.Request, outputFormat string, extra ...string) ([]string, error) {
+	if err := validateCLIRequest(req, ai.BackendClaudeCLI); err != nil {
+		return nil, err
+	}
+	if err := ai.CheckReasoning(c.model, req); err != nil {
+		return nil, err
+	}
 
 	args := []string{
 		"-p",
-		"--output-format", "json",
-		"--model", actualModel,
-		"--max-turns", "1",
+		"--output-format", outputFormat,
+		"--model", MapClaudeCodeModel(c.model),
 		"--no-session-persistence",
 	}
+	args = append(args, extra...)
 
 	if req.SystemPrompt != "" {
 		args = append(args, "--system-prompt", req.SystemPrompt)
@@ -90,77 +211,185 @@ func (c *ClaudeCLI) Execute(ctx context.Context, req ai.Request) (*ai.Response,
 		args = append(args, "--json-schema", string(schemaBytes))
 	}
 
-	args = append(args, req.Prompt)
+	return append(args, cliPrompt(req)), nil
+}
 
-	stdoutData, stderrData, err := runClaudeCLI(ctx, args)
+// ExecuteStream runs `claude -p --output-format stream-json --verbose` without
+// a turn limit and decodes each line into events: the system init line, assistant
+// text, thinking and tool_use blocks, and the final result with cost and usage.
+// Agent runs can take much longer than a single Execute turn, so only ctx
+// bounds the run: the process is killed when ctx is cancelled or its deadline
+// passes, and the channel is then closed.
+func (c *ClaudeCLI) ExecuteStream(ctx context.Context, req ai.Request) (<-chan ai.Event, error) {
+	args, err := c.buildArgs(req, "stream-json", "--verbose")
 	if err != nil {
 		return nil, err
 	}
 
-	var cliResp claudeCLIResponse
-	stdoutStr := string(stdoutData)
-	if idx := strings.Index(stdoutStr, "{"); idx >= 0 {
-		stdoutStr = stdoutStr[idx:]
-	}
+	runCtx, cancel := context.WithCancel(ctx)
+	stdoutReader, stdoutWriter := io.Pipe()
+	var stderr bytes.Buffer
 
-	if err := json.Unmarshal([]byte(stdoutStr), &cliResp); err != nil {
-		return nil, fmt.Errorf("failed to parse CLI response: %w (output: %s)", err, stdoutStr)
-	}
-	_ = stderrData
+	cmd := exec.CommandContext(runCtx, "claude", args...)
+	cmd.Env = claudeCLIEnv(req)
+	cmd.Stdout = stdoutWriter
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = 2 * time.Second
 
-	if cliResp.IsError || cliResp.Error != "" {
-		msg := cliResp.Error
-		if msg == "" {
-			msg = cliResp.Result
+	if err := cmd.Start(); err != nil {
+		cancel()
+		if IsCommandNotFound(err) {
+			return nil, fmt.Errorf("%w: %v", ai.ErrCLINotFound, err)
 		}
-		return nil, fmt.Errorf("CLI returned error: %s", msg)
+		return nil, fmt.Errorf("failed to start claude: %w", err)
 	}
 
-	var structuredData any
-	if req.StructuredOutput != nil {
-		if cliResp.Structured == nil {
-			return nil, fmt.Errorf("%w: no structured data in response", ai.ErrSchemaValidation)
+	waitCh := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		_ = stdoutWriter.Close()
+		waitCh <- err
+	}()
+
+	events := make(chan ai.Event)
+	go func() {
+		defer close(events)
+		defer cancel()
+		defer func() { _ = stdoutReader.Close() }()
+
+		gotResult := false
+		scanner := bufio.NewScanner(stdoutReader)
+		scanner.Buffer(make([]byte, 1024*1024), 10*1024*1024)
+		for scanner.Scan() {
+			line, err := claude.DecodeStreamJSONLine(scanner.Bytes())
+			if err != nil {
+				continue
+			}
+			for _, ev := range c.streamEvents(line) {
+				if ev.Kind == ai.EventResult {
+					gotResult = true
+				}
+				if !sendEvent(ctx, events, ev) {
+					return
+				}
+			}
 		}
-		structBytes, err := json.Marshal(cliResp.Structured)
-		if err != nil {
-			return nil, fmt.Errorf("failed to marshal structured response: %w", err)
+
+		// output that can no longer be read would block claude on a full pipe,
+		// so stop it before waiting
+		scanErr := scanner.Err()
+		if scanErr != nil {
+			cancel()
 		}
-		if err := UnmarshalWithCleanup(string(structBytes), req.StructuredOutput); err != nil {
-			return nil, fmt.Errorf("%w: %v", ai.ErrSchemaValidation, err)
+		_ = stdoutReader.Close()
+		waitErr := <-waitCh
+
+		var err error
+		switch {
+		case ctx.Err() != nil || gotResult:
+			return
+		case scanErr != nil:
+			err = fmt.Errorf("failed to read claude output: %w", scanErr)
+		case waitErr != nil:
+			err = HandleExitError(ai.BackendClaudeCLI, GetExitCode(waitErr), ParseStderr(stderr.String()))
+		default:
+			err = fmt.Errorf("claude exited without a result")
 		}
-		structuredData = req.StructuredOutput
+		sendEvent(ctx, events, ai.Event{Kind: ai.EventError, Model: c.model, Error: err.Error()})
+	}()
+
+	return events, nil
+}
+
+// claudeCLITimeout is how long a single-turn Execute may take; structured
+// output gets longer as claude validates it against the schema.
+func claudeCLITimeout(req ai.Request) time.Duration {
+	if req.StructuredOutput != nil {
+		return 120 * time.Second
 	}
+	return 60 * time.Second
+}
 
-	usage := ai.Usage{}
-	if cliResp.Usage != nil {
-		usage = ai.Usage{
-			InputTokens:      cliResp.Usage.InputTokens,
-			OutputTokens:     cliResp.Usage.OutputTokens,
-			ReasoningTokens:  cliResp.Usage.ReasoningTokens,
-			CacheReadTokens:  cliResp.Usage.CacheReadTokens,
-			CacheWriteTokens: cliResp.Usage.CacheWriteTokens,
+// streamEvents maps a decoded stream-json line to zero or more events
+func (c *ClaudeCLI) streamEvents(line claude.StreamJSONLine) []ai.Event {
+	switch line.Type {
+	case "system":
+		if line.Subtype != "init" {
+			return nil
 		}
-	}
+		return []ai.Event{{Kind: ai.EventSystem, SessionID: line.SessionID, Model: line.Model}}
 
-	text := cliResp.Result
-	if req.StructuredOutput != nil {
-		text = ""
+	case "assistant":
+		msg, ok := line.AssistantMessage()
+		if !ok {
+			return nil
+		}
+		model := msg.Model
+		if model == "" {
+			model = c.model
+		}
+		var events []ai.Event
+		for _, block := range msg.Content {
+			switch block.Type {
+			case claude.ContentTypeText:
+				events = append(events, ai.Event{Kind: ai.EventText, Text: block.Text, Model: model})
+			case claude.ContentTypeThinking:
+				events = append(events, ai.Event{Kind: ai.EventThinking, Text: block.Thinking, Model: model})
+			case claude.ContentTypeToolUse:
+				var input map[string]any
+				if len(block.Input) > 0 {
+					_ = json.Unmarshal(block.Input, &input)
+				}
+				events = append(events, ai.Event{Kind: ai.EventToolUse, Tool: block.Name, Input: input, Model: model})
+			}
+		}
+		return events
+
+	case "result":
+		ev := ai.Event{
+			Kind:      ai.EventResult,
+			Text:      line.Result,
+			CostUSD:   line.Cost(),
+			Success:   !line.IsError && (line.Subtype == "" || line.Subtype == "success"),
+			SessionID: line.SessionID,
+			Model:     c.model,
+		}
+		if line.Usage != nil {
+			ev.Usage = &ai.Usage{
+				InputTokens:      line.Usage.InputTokens,
+				OutputTokens:     line.Usage.OutputTokens,
+				CacheReadTokens:  line.Usage.CacheReadInputTokens,
+				CacheWriteTokens: line.Usage.CacheCreationInputTokens,
+				ServiceTier:      line.Usage.ServiceTier,
+			}
+			if line.Usage.CacheCreation != nil {
+				ev.Usage.CacheWrite1hTokens = line.Usage.CacheCreation.Ephemeral1hInputTokens
+			}
+		}
+		if !ev.Success {
+			ev.Error = line.Result
+			if ev.Error == "" {
+				ev.Error = line.Subtype
+			}
+		}
+		return []ai.Event{ev}
 	}
+	return nil
+}
 
-	return &ai.Response{
-		Text:           text,
-		StructuredData: structuredData,
-		Model:          c.model,
-		Backend:        ai.BackendClaudeCLI,
-		Usage:          usage,
-		Duration:       time.Since(start),
-		Raw:            cliResp,
-	}, nil
+// claudeCLIEnv passes the thinking budget through MAX_THINKING_TOKENS, which
+// claude reads in place of a flag.
+func claudeCLIEnv(req ai.Request) []string {
+	env := clearNestingEnv(os.Environ())
+	if budget := req.ThinkingTokens(); budget > 0 {
+		env = append(env, fmt.Sprintf("MAX_THINKING_TOKENS=%d", budget))
+	}
+	return env
 }
 
-func runClaudeCLI(ctx context.Context, args []string) (stdout []byte, stderr string, err error) {
+func runClaudeCLI(ctx context.Context, args, env []string) (stdout []byte, stderr string, err error) {
 	cmd := exec.CommandContext(ctx, "claude", args...)
-	cmd.Env = clearNestingEnv(os.Environ())
+	cmd.Env = env
 
 	stdoutPipe, err := cmd.StdoutPipe()
 	if err != nil {
@@ -182,7 +411,12 @@ func runClaudeCLI(ctx context.Context, args []string) (stdout []byte, stderr str
 	stderrCh := make(chan string, 1)
 	errCh := make(chan error, 2)
 
+	// cmd.Wait closes the pipes, so it must only run once both reads finish
+	var readers sync.WaitGroup
+	readers.Add(2)
+
 	go func() {
+		defer readers.Done()
 		data, err := io.ReadAll(stdoutPipe)
 		if err != nil {
 			errCh <- fmt.Errorf("failed to read stdout: %w", err)
@@ -192,6 +426,7 @@ func runClaudeCLI(ctx context.Context, args []string) (stdout []byte, stderr str
 	}()
 
 	go func() {
+		defer readers.Done()
 		data, err := io.ReadAll(stderrPipe)
 		if err != nil {
 			errCh <- fmt.Errorf("failed to read stderr: %w", err)
@@ -201,7 +436,10 @@ func runClaudeCLI(ctx context.Context, args []string) (stdout []byte, stderr str
 	}()
 
 	waitCh := make(chan error, 1)
-	go func() { waitCh <- cmd.Wait() }()
+	go func() {
+		readers.Wait()
+		waitCh <- cmd.Wait()
+	}()
 
 	var stdoutData []byte
 	var stderrData string
@@ -224,7 +462,13 @@ func runClaudeCLI(ctx context.Context, args []string) (stdout []byte, stderr str
 	}
 
 	if waitErr != nil {
-		return nil, stderrData, HandleExitError(GetExitCode(waitErr), ParseStderr(stderrData))
+		// claude reports API failures (rate limits, auth) as an error result on
+		// stdout and exits non-zero, so prefer that message over stderr
+		var result claudeCLIResponse
+		if json.Unmarshal(bytes.TrimSpace(stdoutData), &result) == nil && result.IsError && result.Result != "" {
+			return nil, stderrData, cliError(ai.BackendClaudeCLI, "", result.Result)
+		}
+		return nil, stderrData, HandleExitError(ai.BackendClaudeCLI, GetExitCode(waitErr), ParseStderr(stderrData))
 	}
 
 	return stdoutData, stderrData, nil
@@ -8,6 +8,7 @@ import (
 	"io"
 	"os/exec"
 	"strings"
+	"sync"
 
 	"github.com/flanksource/captain/pkg/ai"
 )
@@ -55,7 +56,10 @@ func ParseStderr(stderr string) string {
 	return strings.Join(lines, "; ")
 }
 
-func HandleExitError(exitCode int, stderr string) error {
+// HandleExitError converts a failed CLI exit into an error: exit 124 is a
+// timeout, anything else an ai.ProviderError classified from the exit code
+// and stderr that wraps ai.ErrCLIExecutionFailed.
+func HandleExitError(backend ai.Backend, exitCode int, stderr string) error {
 	msg := fmt.Sprintf("CLI exited with code %d", exitCode)
 	if stderr != "" {
 		msg += fmt.Sprintf(": %s", stderr)
@@ -63,13 +67,13 @@ func HandleExitError(exitCode int, stderr string) error {
 
 	switch exitCode {
 	case 2:
-		return fmt.Errorf("invalid arguments: %s", msg)
+		return cliError(backend, ai.CategoryInvalidRequest, "invalid arguments: "+msg)
 	case 3:
-		return fmt.Errorf("authentication failed: %s", msg)
+		return cliError(backend, ai.CategoryAuth, "authentication failed: "+msg)
 	case 124:
 		return fmt.Errorf("%w: %s", ai.ErrTimeout, msg)
 	default:
-		return fmt.Errorf("%w: %s", ai.ErrCLIExecutionFailed, msg)
+		return cliError(backend, "", msg)
 	}
 }
 
@@ -89,8 +93,46 @@ func clearNestingEnv(environ []string) []string {
 	return filtered
 }
 
-func runCLI(ctx context.Context, command string, stdinData []byte) (stdout []byte, stderr string, err error) {
-	cmd := exec.CommandContext(ctx, command)
+// validateCLIRequest rejects request features the CLI tools cannot express.
+func validateCLIRequest(req ai.Request, backend ai.Backend) error {
+	if len(req.Tools) > 0 {
+		return fmt.Errorf("%w: %s", ai.ErrToolsNotSupported, backend)
+	}
+	if req.HasAttachments() {
+		return fmt.Errorf("%w: %s", ai.ErrAttachmentsNotSupported, backend)
+	}
+	return nil
+}
+
+// cliPrompt flattens the request conversation into the single prompt string
+// that the CLI tools accept. Requests without history pass Prompt through.
+func cliPrompt(req ai.Request) string {
+	if len(req.Messages) == 0 {
+		return req.Prompt
+	}
+	var sb strings.Builder
+	sb.WriteString("Continue the conversation below and reply to the last user message.\n\n")
+	for _, msg := range req.AllMessages() {
+		fmt.Fprintf(&sb, "<%s>\n%s\n</%s>\n\n", msg.Role, msg.Text(), msg.Role)
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// cliPromptWithSystem prepends the system prompt for CLIs that have no flag
+// to set one.
+func cliPromptWithSystem(req ai.Request) string {
+	prompt := cliPrompt(req)
+	if req.SystemPrompt == "" {
+		return prompt
+	}
+	return fmt.Sprintf("<system>\n%s\n</system>\n\n%s", req.SystemPrompt, prompt)
+}
+
+// runCLI runs command with args, writing stdinData to its stdin. When the
+// command exits non-zero its stdout is still returned alongside the error so
+// callers can read error events the CLI printed before exiting.
+func runCLI(ctx context.Context, backend ai.Backend, command string, args []string, stdinData []byte) (stdout []byte, stderr string, err error) {
+	cmd := exec.CommandContext(ctx, command, args...)
 
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
@@ -122,7 +164,12 @@ func runCLI(ctx context.Context, command string, stdinData []byte) (stdout []byt
 	stderrCh := make(chan string, 1)
 	errCh := make(chan error, 2)
 
+	// cmd.Wait closes the pipes, so it must only run once both reads finish
+	var readers sync.WaitGroup
+	readers.Add(2)
+
 	go func() {
+		defer readers.Done()
 		data, err := io.ReadAll(stdoutPipe)
 		if err != nil {
 			errCh <- fmt.Errorf("failed to read stdout: %w", err)
@@ -132,6 +179,7 @@ func runCLI(ctx context.Context, command string, stdinData []byte) (stdout []byt
 	}()
 
 	go func() {
+		defer readers.Done()
 		data, err := io.ReadAll(stderrPipe)
 		if err != nil {
 			errCh <- fmt.Errorf("failed to read stderr: %w", err)
@@ -141,7 +189,10 @@ func runCLI(ctx context.Context, command string, stdinData []byte) (stdout []byt
 	}()
 
 	waitCh := make(chan error, 1)
-	go func() { waitCh <- cmd.Wait() }()
+	go func() {
+		readers.Wait()
+		waitCh <- cmd.Wait()
+	}()
 
 	var stdoutData []byte
 	var stderrData string
@@ -164,7 +215,7 @@ func runCLI(ctx context.Context, command string, stdinData []byte) (stdout []byt
 	}
 
 	if waitErr != nil {
-		return nil, stderrData, HandleExitError(GetExitCode(waitErr), ParseStderr(stderrData))
+		return stdoutData, stderrData, HandleExitError(backend, GetExitCode(waitErr), ParseStderr(stderrData))
 	}
 
 	return stdoutData, stderrData, nil
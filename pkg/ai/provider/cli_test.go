@@ -1,6 +1,16 @@
 package provider
 
-import "testing"
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flanksource/captain/pkg/ai"
+	"github.com/stretchr/testify/require"
+)
 
 func TestMapClaudeCodeModel(t *testing.T) {
 	tests := []struct {
@@ -49,3 +59,295 @@ func TestParseStderr(t *testing.T) {
 		})
 	}
 }
+
+// fakeCLI installs an executable shell script named name on PATH for the test.
+func fakeCLI(t *testing.T, name, script string) {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestClaudeCLIExecute(t *testing.T) {
+	dir := t.TempDir()
+	fakeCLI(t, "claude", `for arg in "$@"; do echo "$arg"; done > `+dir+`/args
+echo "$MAX_THINKING_TOKENS" > `+dir+`/budget
+cat <<'JSON'
+[{"type":"system","subtype":"init","session_id":"sess-1","model":"claude-sonnet-4-6"},
+ {"type":"assistant","session_id":"sess-1","message":{"role":"assistant","model":"claude-sonnet-4-6","content":[{"type":"thinking","thinking":"France's capital is Paris."},{"type":"text","text":"Paris"}]}},
+ {"type":"result","subtype":"success","is_error":false,"result":"Paris","session_id":"sess-1","usage":{"input_tokens":12,"output_tokens":30}}]
+JSON`)
+
+	resp, err := NewClaudeCLI("claude-code-sonnet").Execute(context.Background(), ai.Request{
+		Prompt: "Capital of France?", ReasoningEffort: ai.EffortLow,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "Paris", resp.Text)
+	require.Equal(t, "France's capital is Paris.", resp.Thinking)
+	require.Equal(t, ai.Usage{InputTokens: 12, OutputTokens: 30}, resp.Usage)
+
+	args, err := os.ReadFile(filepath.Join(dir, "args"))
+	require.NoError(t, err)
+	require.Contains(t, string(args), "--output-format\njson\n")
+	require.Contains(t, string(args), "--verbose\n")
+	budget, err := os.ReadFile(filepath.Join(dir, "budget"))
+	require.NoError(t, err)
+	require.Equal(t, "2048\n", string(budget))
+
+	// without --verbose support the CLI prints the result alone
+	fakeCLI(t, "claude", `echo '{"type":"result","result":"Paris","usage":{"input_tokens":12,"output_tokens":3}}'`)
+	resp, err = NewClaudeCLI("claude-code-sonnet").Execute(context.Background(), ai.Request{Prompt: "Capital of France?"})
+	require.NoError(t, err)
+	require.Equal(t, "Paris", resp.Text)
+	require.Empty(t, resp.Thinking)
+}
+
+func TestClaudeCLIExecuteStream(t *testing.T) {
+	fakeCLI(t, "claude", `cat <<'JSONL'
+{"type":"system","subtype":"init","session_id":"sess-1","model":"claude-sonnet-4-6","tools":["Bash"]}
+{"type":"assistant","session_id":"sess-1","message":{"role":"assistant","model":"claude-sonnet-4-6","content":[{"type":"thinking","thinking":"checking"},{"type":"text","text":"Listing files"},{"type":"tool_use","id":"tu-1","name":"Bash","input":{"command":"ls"}}]}}
+{"type":"user","session_id":"sess-1","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"tu-1","content":"a.go"}]}}
+{"type":"assistant","session_id":"sess-1","message":{"role":"assistant","model":"claude-sonnet-4-6","content":[{"type":"text","text":"Done"}]}}
+{"type":"result","subtype":"success","is_error":false,"num_turns":2,"result":"Done","session_id":"sess-1","total_cost_usd":0.0123,"usage":{"input_tokens":100,"output_tokens":20,"cache_read_input_tokens":50}}
+JSONL
+`)
+
+	ch, err := NewClaudeCLI("claude-code-sonnet").ExecuteStream(context.Background(), ai.Request{Prompt: "list files"})
+	if err != nil {
+		t.Fatalf("ExecuteStream: %v", err)
+	}
+
+	var kinds []ai.EventKind
+	var events []ai.Event
+	for ev := range ch {
+		kinds = append(kinds, ev.Kind)
+		events = append(events, ev)
+	}
+
+	want := []ai.EventKind{ai.EventSystem, ai.EventThinking, ai.EventText, ai.EventToolUse, ai.EventText, ai.EventResult}
+	if len(kinds) != len(want) {
+		t.Fatalf("event kinds = %v, want %v", kinds, want)
+	}
+	for i := range want {
+		if kinds[i] != want[i] {
+			t.Fatalf("event kinds = %v, want %v", kinds, want)
+		}
+	}
+
+	if events[0].SessionID != "sess-1" {
+		t.Errorf("system session = %q", events[0].SessionID)
+	}
+	if events[3].Tool != "Bash" || events[3].Input["command"] != "ls" {
+		t.Errorf("tool_use event = %+v", events[3])
+	}
+	result := events[5]
+	if !result.Success || result.CostUSD != 0.0123 || result.Usage == nil || result.Usage.InputTokens != 100 || result.Usage.CacheReadTokens != 50 {
+		t.Errorf("result event = %+v", result)
+	}
+}
+
+func TestClaudeCLIExecuteStreamCancel(t *testing.T) {
+	fakeCLI(t, "claude", `echo '{"type":"system","subtype":"init","session_id":"sess-1"}'
+exec sleep 30
+`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := NewClaudeCLI("claude-code-sonnet").ExecuteStream(ctx, ai.Request{Prompt: "wait"})
+	if err != nil {
+		t.Fatalf("ExecuteStream: %v", err)
+	}
+
+	if ev := <-ch; ev.Kind != ai.EventSystem {
+		t.Fatalf("first event = %+v", ev)
+	}
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		for range ch {
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream channel was not closed after context cancellation")
+	}
+}
+
+func TestClaudeCLIExecuteStreamExitError(t *testing.T) {
+	fakeCLI(t, "claude", `echo "Error: not logged in" >&2
+exit 1
+`)
+
+	ch, err := NewClaudeCLI("claude-code-sonnet").ExecuteStream(context.Background(), ai.Request{Prompt: "hi"})
+	if err != nil {
+		t.Fatalf("ExecuteStream: %v", err)
+	}
+	var last ai.Event
+	for ev := range ch {
+		last = ev
+	}
+	if last.Kind != ai.EventError || !strings.Contains(last.Error, "not logged in") {
+		t.Errorf("last event = %+v", last)
+	}
+}
+
+func TestCodexCLIExecute(t *testing.T) {
+	dir := t.TempDir()
+	fakeCLI(t, "codex", `echo "$@" > `+dir+`/args
+cat > `+dir+`/stdin
+cat <<'JSONL'
+{"type":"thread.started","thread_id":"0199a213-81c0-7800-8aa1-bbab2a035a53"}
+{"type":"turn.started"}
+{"type":"item.completed","item":{"id":"item_0","type":"reasoning","text":"**Answering**"}}
+{"type":"item.completed","item":{"id":"item_1","type":"agent_message","text":"hello"}}
+{"type":"turn.completed","usage":{"input_tokens":2400,"cached_input_tokens":2000,"output_tokens":50,"reasoning_output_tokens":30}}
+JSONL`)
+
+	resp, err := NewCodexCLI("gpt-5-codex").Execute(context.Background(), ai.Request{
+		SystemPrompt:    "Be brief",
+		Prompt:          "Say hello",
+		MaxTokens:       100,
+		ReasoningEffort: ai.EffortHigh,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "hello", resp.Text)
+	require.Equal(t, "**Answering**", resp.Thinking)
+	require.Equal(t, ai.Usage{InputTokens: 400, OutputTokens: 20, ReasoningTokens: 30, CacheReadTokens: 2000}, resp.Usage)
+
+	args, err := os.ReadFile(filepath.Join(dir, "args"))
+	require.NoError(t, err)
+	require.Equal(t, "exec --json --skip-git-repo-check --sandbox read-only --model gpt-5-codex -c model_max_output_tokens=100 -c model_reasoning_effort=high -", strings.TrimSpace(string(args)))
+	stdin, err := os.ReadFile(filepath.Join(dir, "stdin"))
+	require.NoError(t, err)
+	require.Contains(t, string(stdin), "<system>\nBe brief\n</system>")
+	require.Contains(t, string(stdin), "Say hello")
+}
+
+func TestCodexCLIStructuredOutput(t *testing.T) {
+	dir := t.TempDir()
+	fakeCLI(t, "codex", `while [ $# -gt 0 ]; do
+  if [ "$1" = "--output-schema" ]; then cp "$2" `+dir+`/schema.json; fi
+  shift
+done
+cat > /dev/null
+echo '{"id":"0","msg":{"type":"agent_message","message":"{\"city\":\"Paris\",\"country\":\"France\"}"}}'
+echo '{"id":"0","msg":{"type":"token_count","info":{"total_token_usage":{"input_tokens":30,"output_tokens":12}}}}'`)
+
+	type Capital struct {
+		City    string `json:"city"`
+		Country string `json:"country,omitempty"`
+	}
+	var result Capital
+	resp, err := NewCodexCLI("").Execute(context.Background(), ai.Request{Prompt: "Capital of France?", StructuredOutput: &result})
+	require.NoError(t, err)
+	require.Empty(t, resp.Text)
+	require.Equal(t, Capital{City: "Paris", Country: "France"}, result)
+	require.Equal(t, 30, resp.Usage.InputTokens)
+
+	schema, err := os.ReadFile(filepath.Join(dir, "schema.json"))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"type":"object","additionalProperties":false,"required":["city","country"],
+		"properties":{"city":{"type":"string"},"country":{"type":"string"}}}`, string(schema))
+}
+
+func TestCodexCLITurnFailed(t *testing.T) {
+	fakeCLI(t, "codex", `cat > /dev/null
+echo '{"type":"thread.started","thread_id":"t1"}'
+echo '{"type":"turn.failed","error":{"message":"You have hit your usage limit. Upgrade to Pro or try again later."}}'
+exit 1`)
+
+	_, err := NewCodexCLI("").Execute(context.Background(), ai.Request{Prompt: "hi"})
+	perr, ok := ai.AsProviderError(err)
+	require.True(t, ok, "expected ProviderError, got %v", err)
+	require.Equal(t, ai.BackendCodexCLI, perr.Backend)
+	require.Equal(t, ai.CategoryQuota, perr.Category)
+	require.Contains(t, perr.Message, "usage limit")
+	require.ErrorIs(t, err, ai.ErrCLIExecutionFailed)
+}
+
+func TestGeminiCLIExecute(t *testing.T) {
+	dir := t.TempDir()
+	fakeCLI(t, "gemini", `for arg in "$@"; do echo "$arg"; done > `+dir+`/args
+cat <<'JSON'
+{
+  "response": "{\"city\": \"Paris\"}",
+  "stats": {
+    "models": {
+      "gemini-2.5-flash": {"tokens": {"prompt": 120, "candidates": 8, "total": 150, "cached": 100, "thoughts": 22, "tool": 0}},
+      "gemini-2.5-flash-lite": {"tokens": {"prompt": 40, "candidates": 2, "total": 42, "cached": 0, "thoughts": 0, "tool": 0}}
+    }
+  }
+}
+JSON`)
+
+	type Capital struct {
+		City string `json:"city"`
+	}
+	var result Capital
+	resp, err := NewGeminiCLI("gemini-cli-2.5-flash").Execute(context.Background(), ai.Request{
+		SystemPrompt:     "Answer in JSON",
+		Prompt:           "Capital of France?",
+		StructuredOutput: &result,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "Paris", result.City)
+	require.Equal(t, ai.Usage{InputTokens: 60, OutputTokens: 10, ReasoningTokens: 22, CacheReadTokens: 100}, resp.Usage)
+
+	data, err := os.ReadFile(filepath.Join(dir, "args"))
+	require.NoError(t, err)
+	args := string(data)
+	require.True(t, strings.HasPrefix(args, "--output-format\njson\n--model\ngemini-2.5-flash\n--prompt\n<system>\nAnswer in JSON\n</system>"), args)
+	require.Contains(t, args, `"city":{"type":"string"}`)
+}
+
+func TestGeminiCLIError(t *testing.T) {
+	fakeCLI(t, "gemini", `echo '{"error":{"type":"Error","message":"[API Error: You have exhausted your daily quota on this model.]","code":1}}' >&2
+exit 1`)
+
+	_, err := NewGeminiCLI("").Execute(context.Background(), ai.Request{Prompt: "hi"})
+	perr, ok := ai.AsProviderError(err)
+	require.True(t, ok, "expected ProviderError, got %v", err)
+	require.Equal(t, ai.BackendGeminiCLI, perr.Backend)
+	require.Equal(t, ai.CategoryQuota, perr.Category)
+}
+
+func TestMapGeminiCLIModel(t *testing.T) {
+	require.Equal(t, "", MapGeminiCLIModel("gemini-cli-pro"))
+	require.Equal(t, "gemini-2.5-pro", MapGeminiCLIModel("gemini-cli-2.5-pro"))
+	require.Equal(t, "gemini-3-pro-preview", MapGeminiCLIModel("gemini-cli-3-pro"))
+}
+
+func TestClaudeCLIExecuteStreamLineTooLong(t *testing.T) {
+	// the oversized line stops the scanner while claude still has output to write
+	fakeCLI(t, "claude", `echo '{"type":"system","subtype":"init","session_id":"sess-1"}'
+head -c 11000000 /dev/zero | tr '\0' 'a'
+echo
+head -c 1000000 /dev/zero | tr '\0' 'b'
+echo '{"type":"result","subtype":"success","result":"Done"}'
+`)
+
+	ch, err := NewClaudeCLI("claude-code-sonnet").ExecuteStream(context.Background(), ai.Request{Prompt: "hi"})
+	require.NoError(t, err)
+
+	done := make(chan ai.Event)
+	go func() {
+		var last ai.Event
+		for ev := range ch {
+			last = ev
+		}
+		done <- last
+	}()
+	select {
+	case last := <-done:
+		require.Equal(t, ai.EventError, last.Kind, "%+v", last)
+		require.Contains(t, last.Error, "token too long")
+	case <-time.After(10 * time.Second):
+		t.Fatal("stream did not finish after a line over the scanner limit")
+	}
+}
@@ -1,13 +1,18 @@
 package provider
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"os"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/flanksource/captain/pkg/ai"
+	"github.com/flanksource/captain/pkg/ai/history"
 )
 
 type CodexCLI struct {
@@ -21,26 +26,53 @@ func NewCodexCLI(model string) *CodexCLI {
 	return &CodexCLI{model: model}
 }
 
-func (c *CodexCLI) GetModel() string      { return c.model }
+func (c *CodexCLI) GetModel() string       { return c.model }
 func (c *CodexCLI) GetBackend() ai.Backend { return ai.BackendCodexCLI }
 
-type codexCLIRequest struct {
-	Prompt string `json:"prompt"`
-	Model  string `json:"model,omitempty"`
+// codexExecEvent is one line of `codex exec --json`. Current releases emit
+// thread events (item.completed, turn.completed, turn.failed); older ones wrap
+// the same payloads as the session rollout files in {"id":..., "msg":...}.
+type codexExecEvent struct {
+	Type     string                   `json:"type"`
+	ThreadID string                   `json:"thread_id,omitempty"`
+	Item     *codexExecItem           `json:"item,omitempty"`
+	Usage    *history.CodexTokenUsage `json:"usage,omitempty"`
+	Error    *codexExecError          `json:"error,omitempty"`
+	Message  string                   `json:"message,omitempty"`
+	Msg      *history.CodexPayload    `json:"msg,omitempty"`
 }
 
-type codexCLIResponse struct {
-	Text  string `json:"text,omitempty"`
-	Error string `json:"error,omitempty"`
-	Usage *struct {
-		InputTokens  int `json:"input_tokens"`
-		OutputTokens int `json:"output_tokens"`
-	} `json:"usage,omitempty"`
+type codexExecItem struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+}
+
+type codexExecError struct {
+	Message string `json:"message"`
+}
+
+// codexExecResult is what Execute needs from the event stream: the final agent
+// message, the reasoning summaries, token usage and the first error reported.
+type codexExecResult struct {
+	ThreadID string
+	Text     string
+	Thinking string
+	Usage    history.CodexTokenUsage
+	Error    string
+	Events   []codexExecEvent
 }
 
 func (c *CodexCLI) Execute(ctx context.Context, req ai.Request) (*ai.Response, error) {
 	start := time.Now()
 
+	if err := validateCLIRequest(req, ai.BackendCodexCLI); err != nil {
+		return nil, err
+	}
+	if err := ai.CheckReasoning(c.model, req); err != nil {
+		return nil, err
+	}
+
 	timeout := 120 * time.Second
 	if deadline, ok := ctx.Deadline(); ok {
 		if ctxTimeout := time.Until(deadline); ctxTimeout < timeout {
@@ -50,46 +82,226 @@ func (c *CodexCLI) Execute(ctx context.Context, req ai.Request) (*ai.Response, e
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	cliReq := codexCLIRequest{
-		Prompt: req.Prompt,
-		Model:  c.model,
-	}
-	reqBytes, err := json.Marshal(cliReq)
+	args, cleanup, err := c.buildArgs(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+		return nil, err
 	}
+	defer cleanup()
 
-	stdoutData, _, err := runCLI(ctx, "codex", reqBytes)
-	if err != nil {
-		return nil, err
+	stdoutData, _, runErr := runCLI(ctx, ai.BackendCodexCLI, "codex", args, []byte(cliPromptWithSystem(req)))
+	result := parseCodexEvents(stdoutData)
+	if result.Error != "" {
+		return nil, cliError(ai.BackendCodexCLI, "", result.Error)
+	}
+	if runErr != nil {
+		return nil, runErr
 	}
 
-	var cliResp codexCLIResponse
-	stdoutStr := string(stdoutData)
-	if idx := strings.Index(stdoutStr, "{"); idx >= 0 {
-		stdoutStr = stdoutStr[idx:]
+	text := result.Text
+	var structuredData any
+	if req.StructuredOutput != nil {
+		if err := DecodeStructured(text, req.StructuredOutput); err != nil {
+			return nil, withUsage(err, ai.Usage(result.Usage.PricingUsage()))
+		}
+		structuredData = req.StructuredOutput
+		text = ""
 	}
 
-	if err := json.Unmarshal([]byte(stdoutStr), &cliResp); err != nil {
-		return nil, fmt.Errorf("failed to parse codex response: %w (output: %s)", err, stdoutStr)
+	return &ai.Response{
+		Text:           text,
+		Thinking:       result.Thinking,
+		StructuredData: structuredData,
+		Model:          c.model,
+		Backend:        ai.BackendCodexCLI,
+		Usage:          ai.Usage(result.Usage.PricingUsage()),
+		Duration:       time.Since(start),
+		Raw:            result,
+	}, nil
+}
+
+// buildArgs assembles `codex exec --json` reading the prompt from stdin. The
+// session runs read-only and outside git checks since captain only wants the
+// model's answer. The returned cleanup removes the temporary schema file.
+func (c *CodexCLI) buildArgs(req ai.Request) ([]string, func(), error) {
+	cleanup := func() {}
+	args := []string{"exec", "--json", "--skip-git-repo-check", "--sandbox", "read-only"}
+
+	// "codex" means whatever model the user's codex config selects
+	if c.model != "" && c.model != "codex" {
+		args = append(args, "--model", c.model)
+	}
+	if req.MaxTokens > 0 {
+		args = append(args, "-c", fmt.Sprintf("model_max_output_tokens=%d", req.MaxTokens))
+	}
+	if effort := req.Effort(); effort != "" {
+		args = append(args, "-c", "model_reasoning_effort="+string(effort))
 	}
 
-	if cliResp.Error != "" {
-		return nil, fmt.Errorf("codex CLI error: %s", cliResp.Error)
+	if req.StructuredOutput != nil {
+		schema, err := GenerateJSONSchema(req.StructuredOutput)
+		if err != nil {
+			return nil, cleanup, fmt.Errorf("failed to generate schema: %w", err)
+		}
+		strict, err := schemaMap(schema)
+		if err != nil {
+			return nil, cleanup, err
+		}
+		path, err := writeTempJSON("codex-schema-*.json", strictSchema(strict))
+		if err != nil {
+			return nil, cleanup, err
+		}
+		cleanup = func() { _ = os.Remove(path) }
+		args = append(args, "--output-schema", path)
 	}
 
-	usage := ai.Usage{}
-	if cliResp.Usage != nil {
-		usage.InputTokens = cliResp.Usage.InputTokens
-		usage.OutputTokens = cliResp.Usage.OutputTokens
+	return append(args, "-"), cleanup, nil
+}
+
+// parseCodexEvents reads the JSONL event stream, skipping lines that are not
+// JSON (codex prints some diagnostics to stdout).
+func parseCodexEvents(data []byte) codexExecResult {
+	var result codexExecResult
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "{") {
+			continue
+		}
+		var event codexExecEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			continue
+		}
+		result.Events = append(result.Events, event)
+
+		if event.Msg != nil {
+			result.applyLegacy(*event.Msg)
+			continue
+		}
+
+		switch event.Type {
+		case "thread.started":
+			result.ThreadID = event.ThreadID
+		case "item.completed":
+			if event.Item == nil {
+				break
+			}
+			switch event.Item.Type {
+			case "agent_message":
+				result.Text = event.Item.Text
+			case "reasoning":
+				result.addThinking(event.Item.Text)
+			}
+		case "turn.completed":
+			if event.Usage != nil {
+				result.Usage = addCodexUsage(result.Usage, *event.Usage)
+			}
+		case "turn.failed":
+			if event.Error != nil {
+				result.setError(event.Error.Message)
+			}
+		case "error":
+			result.setError(event.Message)
+		}
 	}
+	return result
+}
 
-	return &ai.Response{
-		Text:     cliResp.Text,
-		Model:    c.model,
-		Backend:  ai.BackendCodexCLI,
-		Usage:    usage,
-		Duration: time.Since(start),
-		Raw:      cliResp,
-	}, nil
+func (r *codexExecResult) applyLegacy(msg history.CodexPayload) {
+	switch msg.Type {
+	case "agent_message":
+		r.Text = msg.Message
+	case "agent_reasoning":
+		r.addThinking(msg.Text)
+	case "token_count":
+		// token_count reports the running total for the session
+		if msg.Info != nil {
+			r.Usage = msg.Info.TotalTokenUsage
+		}
+	case "error", "stream_error":
+		r.setError(msg.Message)
+	}
+}
+
+func (r *codexExecResult) addThinking(text string) {
+	if text == "" {
+		return
+	}
+	if r.Thinking != "" {
+		r.Thinking += "\n\n"
+	}
+	r.Thinking += text
+}
+
+func (r *codexExecResult) setError(message string) {
+	if r.Error == "" {
+		r.Error = message
+	}
+}
+
+func addCodexUsage(a, b history.CodexTokenUsage) history.CodexTokenUsage {
+	return history.CodexTokenUsage{
+		InputTokens:           a.InputTokens + b.InputTokens,
+		CachedInputTokens:     a.CachedInputTokens + b.CachedInputTokens,
+		OutputTokens:          a.OutputTokens + b.OutputTokens,
+		ReasoningOutputTokens: a.ReasoningOutputTokens + b.ReasoningOutputTokens,
+		TotalTokens:           a.TotalTokens + b.TotalTokens,
+	}
+}
+
+// strictSchema adapts a generated schema to OpenAI's strict structured output
+// rules, which codex applies to --output-schema: every object must list all
+// of its properties as required and disallow additional properties.
+func strictSchema(schema map[string]any) map[string]any {
+	if props, ok := schema["properties"].(map[string]any); ok {
+		required := make([]string, 0, len(props))
+		for name, prop := range props {
+			if m, ok := prop.(map[string]any); ok {
+				props[name] = strictSchema(m)
+			}
+			required = append(required, name)
+		}
+		sort.Strings(required)
+		schema["required"] = required
+		schema["additionalProperties"] = false
+	}
+	if items, ok := schema["items"].(map[string]any); ok {
+		schema["items"] = strictSchema(items)
+	}
+	if defs, ok := schema["$defs"].(map[string]any); ok {
+		for name, def := range defs {
+			if m, ok := def.(map[string]any); ok {
+				defs[name] = strictSchema(m)
+			}
+		}
+	}
+	// strict mode supports anyOf but not oneOf
+	if alternatives, ok := schema["oneOf"].([]any); ok {
+		for i, alt := range alternatives {
+			if m, ok := alt.(map[string]any); ok {
+				alternatives[i] = strictSchema(m)
+			}
+		}
+		delete(schema, "oneOf")
+		schema["anyOf"] = alternatives
+	}
+	return schema
+}
+
+func writeTempJSON(pattern string, v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal %s: %w", pattern, err)
+	}
+	f, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	if _, err := f.Write(data); err != nil {
+		_ = os.Remove(f.Name())
+		return "", fmt.Errorf("failed to write %s: %w", f.Name(), err)
+	}
+	return f.Name(), nil
 }
@@ -0,0 +1,118 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/flanksource/captain/pkg/ai"
+	"google.golang.org/genai"
+)
+
+// anthropicError converts an SDK error into an ai.ProviderError, reading the
+// error type and message from the response body and Retry-After from headers.
+func anthropicError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("%w: %v", ai.ErrTimeout, ctx.Err())
+	}
+
+	var apiErr *anthropic.Error
+	if !errors.As(err, &apiErr) {
+		return fmt.Errorf("anthropic API error: %w", err)
+	}
+
+	var body struct {
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	_ = json.Unmarshal([]byte(apiErr.RawJSON()), &body)
+
+	message := body.Error.Message
+	if message == "" {
+		message = apiErr.RawJSON()
+	}
+
+	perr := &ai.ProviderError{
+		Backend:    ai.BackendAnthropic,
+		StatusCode: apiErr.StatusCode,
+		Category:   ai.ClassifyError(apiErr.StatusCode, body.Error.Type, message),
+		Message:    message,
+		Err:        err,
+	}
+	if apiErr.Response != nil {
+		perr.RetryAfter = parseRetryAfter(apiErr.Response.Header)
+	}
+	return perr
+}
+
+// geminiError converts an SDK error into an ai.ProviderError. Gemini reports
+// the retry delay in a google.rpc.RetryInfo detail rather than a header.
+func geminiError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("%w: %v", ai.ErrTimeout, ctx.Err())
+	}
+
+	var apiErr genai.APIError
+	if !errors.As(err, &apiErr) {
+		return fmt.Errorf("gemini API error: %w", err)
+	}
+
+	perr := &ai.ProviderError{
+		Backend:    ai.BackendGemini,
+		StatusCode: apiErr.Code,
+		Category:   ai.ClassifyError(apiErr.Code, apiErr.Status, apiErr.Message),
+		Message:    apiErr.Message,
+		Err:        err,
+	}
+	for _, detail := range apiErr.Details {
+		if t, _ := detail["@type"].(string); !strings.HasSuffix(t, "google.rpc.RetryInfo") {
+			continue
+		}
+		if delay, ok := detail["retryDelay"].(string); ok {
+			perr.RetryAfter, _ = time.ParseDuration(delay)
+		}
+	}
+	return perr
+}
+
+// cliError classifies a failure reported by a CLI backend, either from its
+// stderr or from an error result in its output.
+func cliError(backend ai.Backend, category ai.ErrorCategory, message string) error {
+	if category == "" {
+		category = ai.ClassifyError(0, "", message)
+	}
+	return &ai.ProviderError{
+		Backend:  backend,
+		Category: category,
+		Message:  message,
+		Err:      ai.ErrCLIExecutionFailed,
+	}
+}
+
+// parseRetryAfter reads retry-after-ms or Retry-After (seconds or HTTP date).
+func parseRetryAfter(h http.Header) time.Duration {
+	if ms, err := strconv.ParseFloat(h.Get("retry-after-ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	value := h.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseFloat(value, 64); err == nil && secs > 0 {
+		return time.Duration(secs * float64(time.Second))
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,123 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/flanksource/captain/pkg/ai"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnthropicProviderErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		headers    map[string]string
+		body       string
+		category   ai.ErrorCategory
+		retryAfter time.Duration
+		retryable  bool
+	}{
+		{
+			name:       "rate limit",
+			status:     429,
+			headers:    map[string]string{"retry-after-ms": "5"},
+			body:       `{"type":"error","error":{"type":"rate_limit_error","message":"Number of request tokens has exceeded your per-minute rate limit"}}`,
+			category:   ai.CategoryRateLimit,
+			retryAfter: 5 * time.Millisecond,
+			retryable:  true,
+		},
+		{
+			name:     "auth",
+			status:   401,
+			body:     `{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`,
+			category: ai.CategoryAuth,
+		},
+		{
+			name:     "request too large",
+			status:   413,
+			body:     `{"type":"error","error":{"type":"request_too_large","message":"Request exceeds the maximum allowed number of bytes."}}`,
+			category: ai.CategoryContextLength,
+		},
+		{
+			name:     "status decides over the message",
+			status:   400,
+			body:     `{"type":"error","error":{"type":"invalid_request_error","message":"prompt is too long: 210000 tokens > 200000 maximum"}}`,
+			category: ai.CategoryInvalidRequest,
+		},
+		{
+			name:     "billing",
+			status:   402,
+			body:     `{"type":"error","error":{"type":"billing_error","message":"Your credit balance is too low to access the Anthropic API."}}`,
+			category: ai.CategoryQuota,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for k, v := range tt.headers {
+					w.Header().Set(k, v)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				_, _ = fmt.Fprint(w, tt.body)
+			}))
+			defer server.Close()
+
+			p := NewAnthropic(ai.Config{Model: "claude-sonnet-4-6", APIKey: "key", APIURL: server.URL})
+			_, err := p.Execute(context.Background(), ai.Request{Prompt: "hi"})
+			perr, ok := ai.AsProviderError(err)
+			require.True(t, ok, "expected ProviderError, got %v", err)
+			require.Equal(t, ai.BackendAnthropic, perr.Backend)
+			require.Equal(t, tt.status, perr.StatusCode)
+			require.Equal(t, tt.category, perr.Category)
+			require.Equal(t, tt.retryAfter, perr.RetryAfter)
+			require.Equal(t, tt.retryable, perr.Retryable())
+		})
+	}
+}
+
+func TestGeminiProviderError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(429)
+		_, _ = fmt.Fprint(w, `{"error":{"code":429,"status":"RESOURCE_EXHAUSTED",
+			"message":"Quota exceeded for metric: generate_content_free_tier_requests, limit: 10 per minute",
+			"details":[{"@type":"type.googleapis.com/google.rpc.RetryInfo","retryDelay":"23s"}]}}`)
+	}))
+	defer server.Close()
+
+	p := NewGemini(ai.Config{Model: "gemini-2.5-flash", APIKey: "key", APIURL: server.URL})
+	_, err := p.Execute(context.Background(), ai.Request{Prompt: "hi"})
+	perr, ok := ai.AsProviderError(err)
+	require.True(t, ok, "expected ProviderError, got %v", err)
+	require.Equal(t, ai.BackendGemini, perr.Backend)
+	require.Equal(t, 429, perr.StatusCode)
+	require.Equal(t, ai.CategoryRateLimit, perr.Category)
+	require.Equal(t, 23*time.Second, perr.RetryAfter)
+	require.True(t, perr.Retryable())
+}
+
+func TestCLIProviderErrors(t *testing.T) {
+	fakeCLI(t, "claude", `echo '{"type":"result","is_error":true,"result":"API Error: 529 {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}"}'
+exit 1`)
+	_, err := NewClaudeCLI("sonnet").Execute(context.Background(), ai.Request{Prompt: "hi"})
+	perr, ok := ai.AsProviderError(err)
+	require.True(t, ok, "expected ProviderError, got %v", err)
+	require.Equal(t, ai.BackendClaudeCLI, perr.Backend)
+	require.Equal(t, ai.CategoryOverloaded, perr.Category)
+	require.ErrorIs(t, err, ai.ErrCLIExecutionFailed)
+
+	err = HandleExitError(ai.BackendCodexCLI, 1, "Error: You are not logged in. Please run codex login")
+	perr, ok = ai.AsProviderError(err)
+	require.True(t, ok)
+	require.Equal(t, ai.CategoryAuth, perr.Category)
+	require.False(t, perr.Retryable())
+
+	require.ErrorIs(t, HandleExitError(ai.BackendGeminiCLI, 124, ""), ai.ErrTimeout)
+}
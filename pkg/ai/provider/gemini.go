@@ -14,6 +14,7 @@ import (
 type Gemini struct {
 	model      string
 	apiKey     string
+	apiURL     string
 	httpClient *http.Client
 }
 
@@ -22,18 +23,20 @@ func NewGemini(cfg ai.Config) *Gemini {
 	if model == "" {
 		model = "gemini-2.0-flash"
 	}
-	return &Gemini{model: model, apiKey: cfg.APIKey, httpClient: cfg.HTTPClient}
+	return &Gemini{model: model, apiKey: cfg.APIKey, apiURL: cfg.APIURL, httpClient: cfg.HTTPClient}
 }
 
 func (g *Gemini) GetModel() string      { return g.model }
 func (g *Gemini) GetBackend() ai.Backend { return ai.BackendGemini }
 
-func (g *Gemini) Execute(ctx context.Context, req ai.Request) (*ai.Response, error) {
-	start := time.Now()
+func (g *Gemini) newClient(ctx context.Context) (*genai.Client, error) {
 	clientCfg := &genai.ClientConfig{
 		APIKey:  g.apiKey,
 		Backend: genai.BackendGeminiAPI,
 	}
+	if g.apiURL != "" {
+		clientCfg.HTTPOptions.BaseURL = g.apiURL
+	}
 	if g.httpClient != nil {
 		clientCfg.HTTPClient = g.httpClient
 	}
@@ -41,7 +44,13 @@ func (g *Gemini) Execute(ctx context.Context, req ai.Request) (*ai.Response, err
 	if err != nil {
 		return nil, fmt.Errorf("failed to create gemini client: %w", err)
 	}
+	return client, nil
+}
 
+func (g *Gemini) buildConfig(req ai.Request) (*genai.GenerateContentConfig, error) {
+	if err := ai.CheckReasoning(g.model, req); err != nil {
+		return nil, err
+	}
 	config := &genai.GenerateContentConfig{}
 
 	if req.SystemPrompt != "" {
@@ -56,6 +65,10 @@ func (g *Gemini) Execute(ctx context.Context, req ai.Request) (*ai.Response, err
 		t := float32(req.Temperature)
 		config.Temperature = &t
 	}
+	if budget := req.ThinkingTokens(); budget > 0 {
+		b := int32(budget)
+		config.ThinkingConfig = &genai.ThinkingConfig{ThinkingBudget: &b, IncludeThoughts: true}
+	}
 
 	if req.StructuredOutput != nil {
 		schema, err := GenerateJSONSchema(req.StructuredOutput)
@@ -66,42 +79,225 @@ func (g *Gemini) Execute(ctx context.Context, req ai.Request) (*ai.Response, err
 		config.ResponseJsonSchema = schema
 	}
 
-	resp, err := client.Models.GenerateContent(ctx, g.model, genai.Text(req.Prompt), config)
-	if err != nil {
-		if ctx.Err() != nil {
-			return nil, fmt.Errorf("%w: %v", ai.ErrTimeout, ctx.Err())
+	if len(req.Tools) > 0 {
+		tool := &genai.Tool{}
+		for _, t := range req.Tools {
+			schema, err := schemaMap(t.InputSchema)
+			if err != nil {
+				return nil, fmt.Errorf("invalid input schema for tool %s: %w", t.Name, err)
+			}
+			tool.FunctionDeclarations = append(tool.FunctionDeclarations, &genai.FunctionDeclaration{
+				Name:                 t.Name,
+				Description:          t.Description,
+				ParametersJsonSchema: schema,
+			})
 		}
-		return nil, fmt.Errorf("gemini API error: %w", err)
+		config.Tools = []*genai.Tool{tool}
+	}
+	return config, nil
+}
+
+func (g *Gemini) Execute(ctx context.Context, req ai.Request) (*ai.Response, error) {
+	start := time.Now()
+	client, err := g.newClient(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	text := resp.Text()
+	config, err := g.buildConfig(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Models.GenerateContent(ctx, g.model, geminiContents(req.AllMessages()), config)
+	if err != nil {
+		return nil, geminiError(ctx, err)
+	}
+
+	text, thinking := geminiText(resp)
+	toolCalls, err := geminiToolCalls(resp)
+	if err != nil {
+		return nil, err
+	}
 
 	var structuredData any
-	if req.StructuredOutput != nil {
-		cleaned := CleanupJSONResponse(text)
-		if err := json.Unmarshal([]byte(cleaned), req.StructuredOutput); err != nil {
-			return nil, fmt.Errorf("%w: %v", ai.ErrSchemaValidation, err)
+	if req.StructuredOutput != nil && len(toolCalls) == 0 {
+		if err := DecodeStructured(text, req.StructuredOutput); err != nil {
+			return nil, withUsage(err, geminiUsage(resp.UsageMetadata))
 		}
 		structuredData = req.StructuredOutput
 		text = ""
 	}
 
-	usage := ai.Usage{}
-	if resp.UsageMetadata != nil {
-		usage = ai.Usage{
-			InputTokens:     int(resp.UsageMetadata.PromptTokenCount),
-			OutputTokens:    int(resp.UsageMetadata.CandidatesTokenCount),
-			CacheReadTokens: int(resp.UsageMetadata.CachedContentTokenCount),
-		}
-	}
-
 	return &ai.Response{
 		Text:           text,
+		Thinking:       thinking,
 		StructuredData: structuredData,
+		ToolCalls:      toolCalls,
 		Model:          g.model,
 		Backend:        ai.BackendGemini,
-		Usage:          usage,
+		Usage:          geminiUsage(resp.UsageMetadata),
 		Duration:       time.Since(start),
 		Raw:            resp,
 	}, nil
 }
+
+// ExecuteStream streams text and thought-summary deltas as they arrive,
+// followed by a single EventResult carrying usage and cost. The channel is
+// closed when the stream ends or ctx is cancelled.
+func (g *Gemini) ExecuteStream(ctx context.Context, req ai.Request) (<-chan ai.Event, error) {
+	client, err := g.newClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := g.buildConfig(req)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan ai.Event)
+	go func() {
+		defer close(events)
+
+		var usage ai.Usage
+		for resp, err := range client.Models.GenerateContentStream(ctx, g.model, geminiContents(req.AllMessages()), config) {
+			if err != nil {
+				sendEvent(ctx, events, ai.Event{Kind: ai.EventError, Model: g.model, Error: geminiError(ctx, err).Error()})
+				return
+			}
+			if resp.UsageMetadata != nil {
+				usage = geminiUsage(resp.UsageMetadata)
+			}
+			if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+				continue
+			}
+			for _, part := range resp.Candidates[0].Content.Parts {
+				if part != nil && part.FunctionCall != nil {
+					if !sendEvent(ctx, events, ai.Event{Kind: ai.EventToolUse, Tool: part.FunctionCall.Name, Input: part.FunctionCall.Args, Model: g.model}) {
+						return
+					}
+					continue
+				}
+				if part == nil || part.Text == "" {
+					continue
+				}
+				kind := ai.EventText
+				if part.Thought {
+					kind = ai.EventThinking
+				}
+				if !sendEvent(ctx, events, ai.Event{Kind: kind, Text: part.Text, Model: g.model}) {
+					return
+				}
+			}
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+		sendEvent(ctx, events, ai.Event{
+			Kind:    ai.EventResult,
+			Model:   g.model,
+			Usage:   &usage,
+			CostUSD: calculateCostUSD(ai.BackendGemini, g.model, usage),
+			Success: true,
+		})
+	}()
+
+	return events, nil
+}
+
+func geminiContents(msgs []ai.Message) []*genai.Content {
+	contents := make([]*genai.Content, 0, len(msgs))
+	for _, msg := range msgs {
+		role := genai.RoleUser
+		if msg.Role == ai.RoleAssistant {
+			role = genai.RoleModel
+		}
+		content := &genai.Content{Role: role}
+		for _, block := range msg.Content {
+			switch {
+			case block.Kind == ai.ContentText:
+				content.Parts = append(content.Parts, &genai.Part{Text: block.Text})
+			case block.Kind == ai.ContentToolUse && block.ToolCall != nil:
+				var args map[string]any
+				_ = json.Unmarshal(block.ToolCall.Input, &args)
+				content.Parts = append(content.Parts, &genai.Part{FunctionCall: &genai.FunctionCall{
+					ID:   block.ToolCall.ID,
+					Name: block.ToolCall.Name,
+					Args: args,
+				}})
+			case block.Kind == ai.ContentToolResult && block.ToolResult != nil:
+				key := "output"
+				if block.ToolResult.IsError {
+					key = "error"
+				}
+				content.Parts = append(content.Parts, &genai.Part{FunctionResponse: &genai.FunctionResponse{
+					ID:       block.ToolResult.CallID,
+					Name:     block.ToolResult.Name,
+					Response: map[string]any{key: block.ToolResult.Content},
+				}})
+			case block.Kind == ai.ContentAttachment && block.Attachment != nil:
+				content.Parts = append(content.Parts, geminiAttachment(*block.Attachment))
+			}
+		}
+		contents = append(contents, content)
+	}
+	return contents
+}
+
+// geminiAttachment sends the attachment as inline data. Text files of any
+// text/* type are sent as text/plain, which Gemini accepts for all of them.
+func geminiAttachment(a ai.Attachment) *genai.Part {
+	mimeType := a.MIMEType
+	if a.IsText() {
+		mimeType = "text/plain"
+	}
+	return &genai.Part{InlineData: &genai.Blob{MIMEType: mimeType, Data: a.Data}}
+}
+
+// geminiText concatenates the text parts of the first candidate, returning
+// thought summaries separately. Unlike resp.Text it does not warn when the
+// candidate also has function calls.
+func geminiText(resp *genai.GenerateContentResponse) (text, thinking string) {
+	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+		return "", ""
+	}
+	for _, part := range resp.Candidates[0].Content.Parts {
+		switch {
+		case part == nil:
+		case part.Thought:
+			thinking += part.Text
+		default:
+			text += part.Text
+		}
+	}
+	return text, thinking
+}
+
+// geminiToolCalls extracts function calls from the first candidate. Gemini
+// matches function responses by name, so the ID may be empty.
+func geminiToolCalls(resp *genai.GenerateContentResponse) ([]ai.ToolCall, error) {
+	var calls []ai.ToolCall
+	for _, fc := range resp.FunctionCalls() {
+		input, err := json.Marshal(fc.Args)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal arguments for %s: %w", fc.Name, err)
+		}
+		calls = append(calls, ai.ToolCall{ID: fc.ID, Name: fc.Name, Input: input})
+	}
+	return calls, nil
+}
+
+func geminiUsage(meta *genai.GenerateContentResponseUsageMetadata) ai.Usage {
+	if meta == nil {
+		return ai.Usage{}
+	}
+	// the prompt count includes cached content
+	return ai.Usage{
+		InputTokens:     int(meta.PromptTokenCount - meta.CachedContentTokenCount),
+		OutputTokens:    int(meta.CandidatesTokenCount),
+		ReasoningTokens: int(meta.ThoughtsTokenCount),
+		CacheReadTokens: int(meta.CachedContentTokenCount),
+	}
+}
@@ -21,21 +21,65 @@ func NewGeminiCLI(model string) *GeminiCLI {
 	return &GeminiCLI{model: model}
 }
 
-func (g *GeminiCLI) GetModel() string      { return g.model }
+func (g *GeminiCLI) GetModel() string       { return g.model }
 func (g *GeminiCLI) GetBackend() ai.Backend { return ai.BackendGeminiCLI }
 
-type geminiCLIResponse struct {
-	Text  string `json:"text,omitempty"`
-	Error string `json:"error,omitempty"`
-	Usage *struct {
-		InputTokens  int `json:"input_tokens"`
-		OutputTokens int `json:"output_tokens"`
-	} `json:"usage,omitempty"`
+// geminiCLIOutput is the document printed by `gemini --output-format json`.
+// Failures are reported in Error, on stdout or stderr depending on the release.
+type geminiCLIOutput struct {
+	Response string          `json:"response"`
+	Stats    *geminiCLIStats `json:"stats,omitempty"`
+	Error    *geminiCLIError `json:"error,omitempty"`
+}
+
+type geminiCLIStats struct {
+	Models map[string]struct {
+		Tokens geminiCLITokens `json:"tokens"`
+	} `json:"models"`
+}
+
+type geminiCLITokens struct {
+	Prompt     int `json:"prompt"`
+	Candidates int `json:"candidates"`
+	Total      int `json:"total"`
+	Cached     int `json:"cached"`
+	Thoughts   int `json:"thoughts"`
+	Tool       int `json:"tool"`
+}
+
+type geminiCLIError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+	Code    any    `json:"code,omitempty"`
+}
+
+// MapGeminiCLIModel converts a gemini-cli-* catalog ID to the model name the
+// gemini CLI accepts, or "" to use the CLI's configured default.
+func MapGeminiCLIModel(model string) string {
+	name := strings.TrimPrefix(model, "gemini-cli-")
+	switch name {
+	case "", "pro", "default":
+		return ""
+	case "3-pro", "3-flash":
+		return "gemini-" + name + "-preview"
+	}
+	if strings.HasPrefix(name, "gemini-") {
+		return name
+	}
+	return "gemini-" + name
 }
 
 func (g *GeminiCLI) Execute(ctx context.Context, req ai.Request) (*ai.Response, error) {
 	start := time.Now()
 
+	if err := validateCLIRequest(req, ai.BackendGeminiCLI); err != nil {
+		return nil, err
+	}
+	// the thinking budget lives in the CLI's settings file, not in a flag
+	if req.WantsReasoning() {
+		return nil, fmt.Errorf("%w: %s", ai.ErrReasoningNotSupported, ai.BackendGeminiCLI)
+	}
+
 	timeout := 120 * time.Second
 	if deadline, ok := ctx.Deadline(); ok {
 		if ctxTimeout := time.Until(deadline); ctxTimeout < timeout {
@@ -45,46 +89,104 @@ func (g *GeminiCLI) Execute(ctx context.Context, req ai.Request) (*ai.Response,
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	cliReq := map[string]string{
-		"prompt": req.Prompt,
-		"model":  g.model,
-	}
-	reqBytes, err := json.Marshal(cliReq)
+	args, err := g.buildArgs(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+		return nil, err
 	}
 
-	stdoutData, _, err := runCLI(ctx, "gemini", reqBytes)
-	if err != nil {
-		return nil, err
+	stdoutData, stderrData, runErr := runCLI(ctx, ai.BackendGeminiCLI, "gemini", args, nil)
+
+	output, parseErr := parseGeminiCLIOutput(string(stdoutData))
+	if parseErr != nil && runErr != nil {
+		// errors may only be reported on stderr
+		if errOutput, err := parseGeminiCLIOutput(stderrData); err == nil && errOutput.Error != nil {
+			output, parseErr = errOutput, nil
+		}
+	}
+	if parseErr == nil && output.Error != nil {
+		return nil, cliError(ai.BackendGeminiCLI, "", output.Error.Message)
+	}
+	if runErr != nil {
+		return nil, runErr
+	}
+	if parseErr != nil {
+		return nil, parseErr
 	}
 
-	var cliResp geminiCLIResponse
-	stdoutStr := string(stdoutData)
-	if idx := strings.Index(stdoutStr, "{"); idx >= 0 {
-		stdoutStr = stdoutStr[idx:]
+	text := output.Response
+	var structuredData any
+	if req.StructuredOutput != nil {
+		if err := DecodeStructured(text, req.StructuredOutput); err != nil {
+			return nil, withUsage(err, output.usage())
+		}
+		structuredData = req.StructuredOutput
+		text = ""
 	}
 
-	if err := json.Unmarshal([]byte(stdoutStr), &cliResp); err != nil {
-		return nil, fmt.Errorf("failed to parse gemini response: %w (output: %s)", err, stdoutStr)
+	return &ai.Response{
+		Text:           text,
+		StructuredData: structuredData,
+		Model:          g.model,
+		Backend:        ai.BackendGeminiCLI,
+		Usage:          output.usage(),
+		Duration:       time.Since(start),
+		Raw:            output,
+	}, nil
+}
+
+// buildArgs assembles `gemini -p <prompt> --output-format json`. The CLI has
+// no flags for a system prompt, an output limit or a response schema, so the
+// system prompt and schema are written into the prompt and MaxTokens is not
+// enforced.
+func (g *GeminiCLI) buildArgs(req ai.Request) ([]string, error) {
+	prompt := cliPromptWithSystem(req)
+
+	if req.StructuredOutput != nil {
+		schema, err := GenerateJSONSchema(req.StructuredOutput)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate schema: %w", err)
+		}
+		schemaBytes, err := json.Marshal(schema)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal schema: %w", err)
+		}
+		prompt += fmt.Sprintf("\n\nRespond only with a JSON object matching this JSON schema, without any other text:\n%s", schemaBytes)
 	}
 
-	if cliResp.Error != "" {
-		return nil, fmt.Errorf("gemini CLI error: %s", cliResp.Error)
+	args := []string{"--output-format", "json"}
+	if model := MapGeminiCLIModel(g.model); model != "" {
+		args = append(args, "--model", model)
 	}
+	return append(args, "--prompt", prompt), nil
+}
 
-	usage := ai.Usage{}
-	if cliResp.Usage != nil {
-		usage.InputTokens = cliResp.Usage.InputTokens
-		usage.OutputTokens = cliResp.Usage.OutputTokens
+func parseGeminiCLIOutput(data string) (geminiCLIOutput, error) {
+	var output geminiCLIOutput
+	idx := strings.Index(data, "{")
+	if idx < 0 {
+		return output, fmt.Errorf("no JSON in gemini output: %s", strings.TrimSpace(data))
 	}
+	if err := json.Unmarshal([]byte(data[idx:]), &output); err != nil {
+		return output, fmt.Errorf("failed to parse gemini response: %w (output: %s)", err, data[idx:])
+	}
+	return output, nil
+}
 
-	return &ai.Response{
-		Text:     cliResp.Text,
-		Model:    g.model,
-		Backend:  ai.BackendGeminiCLI,
-		Usage:    usage,
-		Duration: time.Since(start),
-		Raw:      cliResp,
-	}, nil
+// usage sums token counts across every model the CLI called; the prompt count
+// includes cached tokens, which are reported separately.
+func (o geminiCLIOutput) usage() ai.Usage {
+	var usage ai.Usage
+	if o.Stats == nil {
+		return usage
+	}
+	for _, m := range o.Stats.Models {
+		t := m.Tokens
+		usage = usage.Add(ai.Usage{
+			InputTokens:     t.Prompt - t.Cached,
+			OutputTokens:    t.Candidates,
+			ReasoningTokens: t.Thoughts,
+			CacheReadTokens: t.Cached,
+		})
+	}
+	return usage
 }
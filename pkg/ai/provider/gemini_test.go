@@ -2,6 +2,9 @@ package provider
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 
@@ -68,3 +71,46 @@ func TestGeminiStructuredIntegration(t *testing.T) {
 	require.Equal(t, "Paris", result.City)
 	require.Equal(t, "France", result.Country)
 }
+
+func TestGeminiExecuteStream(t *testing.T) {
+	chunks := []string{
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":"Planning","thought":true}]}}]}`,
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":"Hello"}]}}]}`,
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":" world"}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":8,"candidatesTokenCount":4,"thoughtsTokenCount":3}}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Contains(t, r.URL.Path, ":streamGenerateContent")
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, c := range chunks {
+			_, _ = fmt.Fprintf(w, "data: %s\n\n", c)
+		}
+	}))
+	defer server.Close()
+
+	p := NewGemini(ai.Config{Model: "gemini-2.5-flash", APIKey: "key", APIURL: server.URL})
+	ch, err := p.ExecuteStream(context.Background(), ai.Request{Prompt: "hi"})
+	require.NoError(t, err)
+
+	var text, thinking string
+	var result *ai.Event
+	for ev := range ch {
+		switch ev.Kind {
+		case ai.EventText:
+			text += ev.Text
+		case ai.EventThinking:
+			thinking += ev.Text
+		case ai.EventResult:
+			result = &ev
+		case ai.EventError:
+			t.Fatalf("unexpected error event: %s", ev.Error)
+		}
+	}
+
+	require.Equal(t, "Hello world", text)
+	require.Equal(t, "Planning", thinking)
+	require.NotNil(t, result)
+	require.Equal(t, 8, result.Usage.InputTokens)
+	require.Equal(t, 4, result.Usage.OutputTokens)
+	require.Equal(t, 3, result.Usage.ReasoningTokens)
+	require.Greater(t, result.CostUSD, 0.0)
+}
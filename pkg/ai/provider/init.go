@@ -18,4 +18,10 @@ func init() {
 	ai.RegisterProvider(ai.BackendGemini, func(cfg ai.Config) ai.Provider {
 		return NewGemini(cfg)
 	})
+	ai.RegisterProvider(ai.BackendOpenAI, func(cfg ai.Config) ai.Provider {
+		return NewOpenAI(cfg)
+	})
+	ai.RegisterProvider(ai.BackendOllama, func(cfg ai.Config) ai.Provider {
+		return NewOllama(cfg)
+	})
 }
@@ -0,0 +1,323 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flanksource/captain/pkg/ai"
+)
+
+// Ollama talks to a local Ollama server over its native HTTP API, so it needs
+// neither network access nor a vendor CLI.
+type Ollama struct {
+	model      string
+	apiURL     string
+	httpClient *http.Client
+}
+
+// NewOllama uses cfg.APIURL, then OLLAMA_HOST, then http://localhost:11434.
+// An "ollama/" prefix on the model is stripped.
+func NewOllama(cfg ai.Config) *Ollama {
+	apiURL := cfg.APIURL
+	if apiURL == "" {
+		apiURL = os.Getenv("OLLAMA_HOST")
+	}
+	if apiURL == "" {
+		apiURL = ai.OllamaBaseURL
+	}
+	if !strings.Contains(apiURL, "://") {
+		apiURL = "http://" + apiURL
+	}
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Ollama{
+		model:      strings.TrimPrefix(cfg.Model, "ollama/"),
+		apiURL:     strings.TrimSuffix(apiURL, "/"),
+		httpClient: httpClient,
+	}
+}
+
+func (o *Ollama) GetModel() string       { return o.model }
+func (o *Ollama) GetBackend() ai.Backend { return ai.BackendOllama }
+
+type ollamaRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+	Format   any             `json:"format,omitempty"`
+	Think    any             `json:"think,omitempty"`
+	Tools    []openAITool    `json:"tools,omitempty"`
+	Options  map[string]any  `json:"options,omitempty"`
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Thinking  string           `json:"thinking,omitempty"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaResponse struct {
+	Model           string        `json:"model"`
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+}
+
+func (o *Ollama) buildRequest(req ai.Request) (*ollamaRequest, error) {
+	if err := ai.CheckReasoning(o.model, req); err != nil {
+		return nil, err
+	}
+	body := &ollamaRequest{Model: o.model}
+
+	// think takes a level for models such as gpt-oss and a boolean otherwise;
+	// there is no thinking budget
+	if effort := req.Effort(); effort != "" {
+		if strings.HasPrefix(o.model, "gpt-oss") {
+			body.Think = string(effort)
+		} else {
+			body.Think = true
+		}
+	}
+
+	if req.SystemPrompt != "" {
+		body.Messages = append(body.Messages, ollamaMessage{Role: "system", Content: req.SystemPrompt})
+	}
+	body.Messages = append(body.Messages, ollamaMessages(req.AllMessages())...)
+
+	options := map[string]any{}
+	if req.MaxTokens > 0 {
+		options["num_predict"] = req.MaxTokens
+	}
+	if req.Temperature > 0 {
+		options["temperature"] = req.Temperature
+	}
+	if len(options) > 0 {
+		body.Options = options
+	}
+
+	if req.StructuredOutput != nil {
+		schema, err := GenerateJSONSchema(req.StructuredOutput)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate schema: %w", err)
+		}
+		body.Format = schema
+	}
+
+	for _, t := range req.Tools {
+		schema, err := schemaMap(t.InputSchema)
+		if err != nil {
+			return nil, fmt.Errorf("invalid input schema for tool %s: %w", t.Name, err)
+		}
+		tool := openAITool{Type: "function"}
+		tool.Function.Name = t.Name
+		tool.Function.Description = t.Description
+		tool.Function.Parameters = schema
+		body.Tools = append(body.Tools, tool)
+	}
+	return body, nil
+}
+
+func (o *Ollama) Execute(ctx context.Context, req ai.Request) (*ai.Response, error) {
+	start := time.Now()
+
+	if o.model == "" {
+		return nil, fmt.Errorf("ollama requires a model, e.g. ollama/llama3.2")
+	}
+
+	if req.HasAttachments() {
+		return nil, fmt.Errorf("%w: %s", ai.ErrAttachmentsNotSupported, ai.BackendOllama)
+	}
+
+	body, err := o.buildRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp ollamaResponse
+	if err := o.post(ctx, "/api/chat", body, &resp); err != nil {
+		return nil, err
+	}
+
+	text := resp.Message.Content
+	var toolCalls []ai.ToolCall
+	for i, call := range resp.Message.ToolCalls {
+		// Ollama does not assign call IDs, results are matched by tool name
+		toolCalls = append(toolCalls, ai.ToolCall{
+			ID:    fmt.Sprintf("call_%d", i),
+			Name:  call.Function.Name,
+			Input: call.Function.Arguments,
+		})
+	}
+
+	var structuredData any
+	if req.StructuredOutput != nil && len(toolCalls) == 0 {
+		if err := DecodeStructured(text, req.StructuredOutput); err != nil {
+			return nil, withUsage(err, ai.Usage{InputTokens: resp.PromptEvalCount, OutputTokens: resp.EvalCount})
+		}
+		structuredData = req.StructuredOutput
+		text = ""
+	}
+
+	return &ai.Response{
+		Text:           text,
+		Thinking:       resp.Message.Thinking,
+		StructuredData: structuredData,
+		ToolCalls:      toolCalls,
+		Model:          o.model,
+		Backend:        ai.BackendOllama,
+		Usage: ai.Usage{
+			InputTokens:  resp.PromptEvalCount,
+			OutputTokens: resp.EvalCount,
+		},
+		Duration: time.Since(start),
+		Raw:      resp,
+	}, nil
+}
+
+// ListModels returns the locally pulled models, prefixed with "ollama/", with
+// context windows read from each model's metadata.
+func (o *Ollama) ListModels(ctx context.Context) ([]ai.ModelDef, error) {
+	var tags struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := o.get(ctx, "/api/tags", &tags); err != nil {
+		return nil, err
+	}
+
+	var models []ai.ModelDef
+	for _, m := range tags.Models {
+		var show struct {
+			Capabilities []string       `json:"capabilities"`
+			ModelInfo    map[string]any `json:"model_info"`
+		}
+		if err := o.post(ctx, "/api/show", map[string]string{"model": m.Name}, &show); err != nil {
+			return nil, fmt.Errorf("failed to describe %s: %w", m.Name, err)
+		}
+
+		def := ai.ModelDef{ID: "ollama/" + m.Name, Name: m.Name, Backend: ai.BackendOllama}
+		for key, value := range show.ModelInfo {
+			if n, ok := value.(float64); ok && strings.HasSuffix(key, ".context_length") {
+				def.ContextWindow = int(n)
+			}
+		}
+		for _, c := range show.Capabilities {
+			if c == "thinking" {
+				def.Reasoning = true
+			}
+		}
+		models = append(models, def)
+	}
+
+	sort.Slice(models, func(i, j int) bool { return models[i].ID < models[j].ID })
+	return models, nil
+}
+
+func (o *Ollama) get(ctx context.Context, path string, out any) error {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, o.apiURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	return o.do(ctx, httpReq, out)
+}
+
+func (o *Ollama) post(ctx context.Context, path string, body, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, o.apiURL+path, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	return o.do(ctx, httpReq, out)
+}
+
+func (o *Ollama) do(ctx context.Context, httpReq *http.Request, out any) error {
+	httpResp, err := o.httpClient.Do(httpReq)
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("%w: %v", ai.ErrTimeout, ctx.Err())
+		}
+		return &ai.ProviderError{
+			Backend:  ai.BackendOllama,
+			Category: ai.CategoryUnknown,
+			Message:  fmt.Sprintf("ollama is not reachable at %s", o.apiURL),
+			Err:      err,
+		}
+	}
+	defer func() { _ = httpResp.Body.Close() }()
+
+	respBody, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if httpResp.StatusCode >= 300 {
+		var errBody struct {
+			Error string `json:"error"`
+		}
+		_ = json.Unmarshal(respBody, &errBody)
+		message := errBody.Error
+		if message == "" {
+			message = strings.TrimSpace(string(respBody))
+		}
+		return &ai.ProviderError{
+			Backend:    ai.BackendOllama,
+			StatusCode: httpResp.StatusCode,
+			Category:   ai.ClassifyError(httpResp.StatusCode, "", message),
+			Message:    message,
+		}
+	}
+
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to parse ollama response: %w", err)
+	}
+	return nil
+}
+
+func ollamaMessages(msgs []ai.Message) []ollamaMessage {
+	var out []ollamaMessage
+	for _, msg := range msgs {
+		m := ollamaMessage{Role: string(msg.Role)}
+		for _, block := range msg.Content {
+			switch {
+			case block.Kind == ai.ContentText:
+				m.Content += block.Text
+			case block.Kind == ai.ContentToolUse && block.ToolCall != nil:
+				var call ollamaToolCall
+				call.Function.Name = block.ToolCall.Name
+				call.Function.Arguments = block.ToolCall.Input
+				m.ToolCalls = append(m.ToolCalls, call)
+			case block.Kind == ai.ContentToolResult && block.ToolResult != nil:
+				out = append(out, ollamaMessage{Role: "tool", ToolName: block.ToolResult.Name, Content: block.ToolResult.Content})
+			}
+		}
+		if m.Content != "" || len(m.ToolCalls) > 0 {
+			out = append(out, m)
+		}
+	}
+	return out
+}
@@ -0,0 +1,108 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flanksource/captain/pkg/ai"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOllamaDefaults(t *testing.T) {
+	t.Setenv("OLLAMA_HOST", "0.0.0.0:11500")
+	p := NewOllama(ai.Config{Model: "ollama/llama3.2"})
+	require.Equal(t, "llama3.2", p.GetModel())
+	require.Equal(t, ai.BackendOllama, p.GetBackend())
+	require.Equal(t, "http://0.0.0.0:11500", p.apiURL)
+
+	backend, err := ai.InferBackend("ollama/qwen3:8b")
+	require.NoError(t, err)
+	require.Equal(t, ai.BackendOllama, backend)
+}
+
+func TestOllamaExecute(t *testing.T) {
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/chat", r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		_, _ = w.Write([]byte(`{"model":"llama3.2","message":{"role":"assistant","content":"{\"city\":\"Paris\",\"country\":\"France\"}"},
+			"done":true,"prompt_eval_count":26,"eval_count":12}`))
+	}))
+	defer server.Close()
+
+	type Capital struct {
+		City    string `json:"city"`
+		Country string `json:"country"`
+	}
+
+	p := NewOllama(ai.Config{Model: "ollama/llama3.2", APIURL: server.URL})
+	var result Capital
+	resp, err := p.Execute(context.Background(), ai.Request{
+		Prompt:           "What is the capital of France?",
+		MaxTokens:        64,
+		StructuredOutput: &result,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "Paris", result.City)
+	require.Equal(t, ai.Usage{InputTokens: 26, OutputTokens: 12}, resp.Usage)
+	require.Equal(t, ai.BackendOllama, resp.Backend)
+
+	require.Equal(t, "llama3.2", body["model"])
+	require.Equal(t, false, body["stream"])
+	require.EqualValues(t, 64, body["options"].(map[string]any)["num_predict"])
+	format := body["format"].(map[string]any)
+	require.Equal(t, "object", format["type"])
+	require.Contains(t, format["properties"], "country")
+}
+
+func TestOllamaListModels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags":
+			_, _ = w.Write([]byte(`{"models":[{"name":"qwen3:8b"},{"name":"llama3.2:latest"}]}`))
+		case "/api/show":
+			var req struct {
+				Model string `json:"model"`
+			}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			if req.Model == "qwen3:8b" {
+				_, _ = w.Write([]byte(`{"capabilities":["completion","thinking"],"model_info":{"general.architecture":"qwen3","qwen3.context_length":40960}}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"capabilities":["completion"],"model_info":{"general.architecture":"llama","llama.context_length":131072}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	models, err := NewOllama(ai.Config{APIURL: server.URL}).ListModels(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []ai.ModelDef{
+		{ID: "ollama/llama3.2:latest", Name: "llama3.2:latest", Backend: ai.BackendOllama, ContextWindow: 131072},
+		{ID: "ollama/qwen3:8b", Name: "qwen3:8b", Backend: ai.BackendOllama, ContextWindow: 40960, Reasoning: true},
+	}, models)
+}
+
+func TestOllamaErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":"model \"mistral\" not found, try pulling it first"}`))
+	}))
+
+	p := NewOllama(ai.Config{Model: "mistral", APIURL: server.URL})
+	_, err := p.Execute(context.Background(), ai.Request{Prompt: "hello"})
+	perr, ok := ai.AsProviderError(err)
+	require.True(t, ok)
+	require.Equal(t, http.StatusNotFound, perr.StatusCode)
+	require.Contains(t, perr.Message, "try pulling it first")
+
+	server.Close()
+	_, err = p.Execute(context.Background(), ai.Request{Prompt: "hello"})
+	perr, ok = ai.AsProviderError(err)
+	require.True(t, ok)
+	require.Contains(t, perr.Message, "not reachable")
+}
@@ -0,0 +1,335 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/flanksource/captain/pkg/ai"
+	"github.com/flanksource/captain/pkg/ai/pricing"
+	"github.com/flanksource/commons/logger"
+)
+
+// OpenAI talks to the Chat Completions API over plain HTTP. Setting APIURL
+// points it at any OpenAI-compatible server such as xAI, vLLM or LM Studio.
+type OpenAI struct {
+	model      string
+	apiKey     string
+	apiURL     string
+	httpClient *http.Client
+}
+
+func NewOpenAI(cfg ai.Config) *OpenAI {
+	model := cfg.Model
+	if model == "" {
+		model = "gpt-5-mini"
+	}
+	apiURL := strings.TrimSuffix(cfg.APIURL, "/")
+	if apiURL == "" {
+		apiURL = ai.OpenAIBaseURL
+	}
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &OpenAI{model: model, apiKey: cfg.APIKey, apiURL: apiURL, httpClient: httpClient}
+}
+
+func (o *OpenAI) GetModel() string       { return o.model }
+func (o *OpenAI) GetBackend() ai.Backend { return ai.BackendOpenAI }
+
+type openAIRequest struct {
+	Model               string            `json:"model"`
+	Messages            []openAIMessage   `json:"messages"`
+	MaxTokens           int               `json:"max_tokens,omitempty"`
+	MaxCompletionTokens int               `json:"max_completion_tokens,omitempty"`
+	Temperature         *float64          `json:"temperature,omitempty"`
+	ReasoningEffort     string            `json:"reasoning_effort,omitempty"`
+	ResponseFormat      *openAIRespFormat `json:"response_format,omitempty"`
+	Tools               []openAITool      `json:"tools,omitempty"`
+}
+
+type openAIMessage struct {
+	Role       string           `json:"role"`
+	Content    string           `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type openAIRespFormat struct {
+	Type       string `json:"type"`
+	JSONSchema struct {
+		Name   string `json:"name"`
+		Schema any    `json:"schema"`
+	} `json:"json_schema"`
+}
+
+type openAITool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string `json:"name"`
+		Description string `json:"description,omitempty"`
+		Parameters  any    `json:"parameters"`
+	} `json:"function"`
+}
+
+type openAIToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type openAIResponse struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Message struct {
+			Content          string           `json:"content"`
+			ReasoningContent string           `json:"reasoning_content"`
+			ToolCalls        []openAIToolCall `json:"tool_calls"`
+		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage       openAIUsage `json:"usage"`
+	ServiceTier string      `json:"service_tier"`
+}
+
+type openAIUsage struct {
+	PromptTokens        int `json:"prompt_tokens"`
+	CompletionTokens    int `json:"completion_tokens"`
+	PromptTokensDetails struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"prompt_tokens_details"`
+	CompletionTokensDetails struct {
+		ReasoningTokens int `json:"reasoning_tokens"`
+	} `json:"completion_tokens_details"`
+}
+
+type openAIErrorBody struct {
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+		Code    any    `json:"code"`
+	} `json:"error"`
+}
+
+func (o *OpenAI) buildRequest(req ai.Request) (*openAIRequest, error) {
+	if err := ai.CheckReasoning(o.model, req); err != nil {
+		return nil, err
+	}
+	body := &openAIRequest{Model: o.model}
+	// Chat Completions takes an effort, not a thinking budget. Compatible
+	// servers may reject the field, so they only get it for models the
+	// catalog knows to reason.
+	if effort := req.Effort(); effort != "" {
+		if def, ok := ai.LookupModel(o.model); o.apiURL == ai.OpenAIBaseURL || (ok && def.Reasoning) {
+			body.ReasoningEffort = string(effort)
+		} else {
+			logger.Debugf("[openai/%s] omitting reasoning_effort %s for %s, the model is not known to reason", o.model, effort, o.apiURL)
+		}
+	}
+
+	if req.SystemPrompt != "" {
+		body.Messages = append(body.Messages, openAIMessage{Role: "system", Content: req.SystemPrompt})
+	}
+	body.Messages = append(body.Messages, openAIMessages(req.AllMessages())...)
+
+	if req.MaxTokens > 0 {
+		// OpenAI's reasoning models reject max_tokens; compatible servers may
+		// not know max_completion_tokens
+		if o.apiURL == ai.OpenAIBaseURL {
+			body.MaxCompletionTokens = req.MaxTokens
+		} else {
+			body.MaxTokens = req.MaxTokens
+		}
+	}
+	if req.Temperature > 0 {
+		body.Temperature = &req.Temperature
+	}
+
+	if req.StructuredOutput != nil {
+		schema, err := GenerateJSONSchema(req.StructuredOutput)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate schema: %w", err)
+		}
+		format := &openAIRespFormat{Type: "json_schema"}
+		format.JSONSchema.Name = "response"
+		format.JSONSchema.Schema = schema
+		body.ResponseFormat = format
+	}
+
+	for _, t := range req.Tools {
+		schema, err := schemaMap(t.InputSchema)
+		if err != nil {
+			return nil, fmt.Errorf("invalid input schema for tool %s: %w", t.Name, err)
+		}
+		tool := openAITool{Type: "function"}
+		tool.Function.Name = t.Name
+		tool.Function.Description = t.Description
+		tool.Function.Parameters = schema
+		body.Tools = append(body.Tools, tool)
+	}
+	return body, nil
+}
+
+func (o *OpenAI) Execute(ctx context.Context, req ai.Request) (*ai.Response, error) {
+	start := time.Now()
+
+	if o.apiKey == "" && o.apiURL == ai.OpenAIBaseURL {
+		return nil, fmt.Errorf("%w: set OPENAI_API_KEY", ai.ErrNoAPIKey)
+	}
+
+	if req.HasAttachments() {
+		return nil, fmt.Errorf("%w: %s", ai.ErrAttachmentsNotSupported, ai.BackendOpenAI)
+	}
+
+	body, err := o.buildRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, o.apiURL+"/chat/completions", bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if o.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+o.apiKey)
+	}
+
+	httpResp, err := o.httpClient.Do(httpReq)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("%w: %v", ai.ErrTimeout, ctx.Err())
+		}
+		return nil, fmt.Errorf("openai API error: %w", err)
+	}
+	defer func() { _ = httpResp.Body.Close() }()
+
+	respBody, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if httpResp.StatusCode >= 300 {
+		return nil, openAIError(httpResp, respBody)
+	}
+
+	var resp openAIResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse openai response: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("openai API returned no choices")
+	}
+
+	msg := resp.Choices[0].Message
+	text := msg.Content
+	var toolCalls []ai.ToolCall
+	for _, call := range msg.ToolCalls {
+		toolCalls = append(toolCalls, ai.ToolCall{ID: call.ID, Name: call.Function.Name, Input: json.RawMessage(call.Function.Arguments)})
+	}
+
+	var structuredData any
+	if req.StructuredOutput != nil && len(toolCalls) == 0 {
+		if err := DecodeStructured(text, req.StructuredOutput); err != nil {
+			return nil, withUsage(err, openAIUsageToAI(resp.Usage, resp.ServiceTier))
+		}
+		structuredData = req.StructuredOutput
+		text = ""
+	}
+
+	model := resp.Model
+	if model == "" {
+		model = o.model
+	}
+	// OpenAI keeps reasoning hidden; compatible servers such as xAI return it
+	// in reasoning_content
+	return &ai.Response{
+		Text:           text,
+		Thinking:       msg.ReasoningContent,
+		StructuredData: structuredData,
+		ToolCalls:      toolCalls,
+		Model:          model,
+		Backend:        ai.BackendOpenAI,
+		Usage:          openAIUsageToAI(resp.Usage, resp.ServiceTier),
+		Duration:       time.Since(start),
+		Raw:            resp,
+	}, nil
+}
+
+func openAIMessages(msgs []ai.Message) []openAIMessage {
+	var out []openAIMessage
+	for _, msg := range msgs {
+		m := openAIMessage{Role: string(msg.Role)}
+		for _, block := range msg.Content {
+			switch {
+			case block.Kind == ai.ContentText:
+				m.Content += block.Text
+			case block.Kind == ai.ContentToolUse && block.ToolCall != nil:
+				call := openAIToolCall{ID: block.ToolCall.ID, Type: "function"}
+				call.Function.Name = block.ToolCall.Name
+				call.Function.Arguments = string(block.ToolCall.Input)
+				m.ToolCalls = append(m.ToolCalls, call)
+			case block.Kind == ai.ContentToolResult && block.ToolResult != nil:
+				// each tool result is its own message with the tool role
+				out = append(out, openAIMessage{Role: "tool", ToolCallID: block.ToolResult.CallID, Content: block.ToolResult.Content})
+			}
+		}
+		if m.Content != "" || len(m.ToolCalls) > 0 {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// openAIUsageToAI splits cached prompt tokens and reasoning tokens out of the
+// prompt and completion totals so they are not counted twice. OpenAI calls the
+// standard service tier "default".
+func openAIUsageToAI(u openAIUsage, serviceTier string) ai.Usage {
+	if serviceTier == "default" {
+		serviceTier = pricing.ServiceTierStandard
+	}
+	cached := u.PromptTokensDetails.CachedTokens
+	reasoning := u.CompletionTokensDetails.ReasoningTokens
+	return ai.Usage{
+		InputTokens:     u.PromptTokens - cached,
+		OutputTokens:    u.CompletionTokens - reasoning,
+		ReasoningTokens: reasoning,
+		CacheReadTokens: cached,
+		ServiceTier:     serviceTier,
+	}
+}
+
+func openAIError(resp *http.Response, body []byte) error {
+	var errBody openAIErrorBody
+	_ = json.Unmarshal(body, &errBody)
+
+	message := errBody.Error.Message
+	if message == "" {
+		message = strings.TrimSpace(string(body))
+	}
+	code := ""
+	if errBody.Error.Code != nil {
+		code = fmt.Sprint(errBody.Error.Code)
+	}
+
+	return &ai.ProviderError{
+		Backend:    ai.BackendOpenAI,
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header),
+		Category:   ai.ClassifyError(resp.StatusCode, errBody.Error.Type+" "+code, message),
+		Message:    message,
+	}
+}
@@ -0,0 +1,164 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/flanksource/captain/pkg/ai"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAIDefaults(t *testing.T) {
+	p := NewOpenAI(ai.Config{APIKey: "key"})
+	require.Equal(t, "gpt-5-mini", p.GetModel())
+	require.Equal(t, ai.BackendOpenAI, p.GetBackend())
+
+	backend, err := ai.InferBackend("gpt-4o")
+	require.NoError(t, err)
+	require.Equal(t, ai.BackendOpenAI, backend)
+
+	backend, err = ai.InferBackend("gpt-5-codex")
+	require.NoError(t, err)
+	require.Equal(t, ai.BackendCodexCLI, backend)
+}
+
+func TestOpenAINoAPIKey(t *testing.T) {
+	p := NewOpenAI(ai.Config{Model: "gpt-4o"})
+	_, err := p.Execute(context.Background(), ai.Request{Prompt: "hello"})
+	require.ErrorIs(t, err, ai.ErrNoAPIKey)
+}
+
+func TestOpenAIExecute(t *testing.T) {
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/chat/completions", r.URL.Path)
+		require.Empty(t, r.Header.Get("Authorization"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{
+			"id": "chatcmpl-1",
+			"model": "qwen3-8b",
+			"choices": [{"message": {"role": "assistant", "content": "{\"city\":\"Paris\",\"country\":\"France\"}"}, "finish_reason": "stop"}],
+			"usage": {
+				"prompt_tokens": 20, "completion_tokens": 15,
+				"prompt_tokens_details": {"cached_tokens": 5},
+				"completion_tokens_details": {"reasoning_tokens": 10}
+			}
+		}`))
+	}))
+	defer server.Close()
+
+	type Capital struct {
+		City    string `json:"city"`
+		Country string `json:"country"`
+	}
+
+	// local OpenAI-compatible servers such as vLLM don't need a key
+	p := NewOpenAI(ai.Config{Model: "qwen3-8b", APIURL: server.URL + "/v1/"})
+	var result Capital
+	resp, err := p.Execute(context.Background(), ai.Request{
+		SystemPrompt:     "Answer in JSON",
+		Prompt:           "What is the capital of France?",
+		MaxTokens:        64,
+		StructuredOutput: &result,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "Paris", result.City)
+	require.Equal(t, "France", result.Country)
+	require.Empty(t, resp.Text)
+	require.Equal(t, "qwen3-8b", resp.Model)
+	require.Equal(t, ai.Usage{InputTokens: 15, OutputTokens: 5, ReasoningTokens: 10, CacheReadTokens: 5}, resp.Usage)
+
+	require.EqualValues(t, 64, body["max_tokens"])
+	messages := body["messages"].([]any)
+	require.Len(t, messages, 2)
+	require.Equal(t, "system", messages[0].(map[string]any)["role"])
+	format := body["response_format"].(map[string]any)
+	require.Equal(t, "json_schema", format["type"])
+	schema := format["json_schema"].(map[string]any)["schema"].(map[string]any)
+	require.Contains(t, schema["properties"], "city")
+}
+
+func TestOpenAIToolLoop(t *testing.T) {
+	var requests []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer key", r.Header.Get("Authorization"))
+		var body map[string]any
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		requests = append(requests, body)
+
+		w.Header().Set("Content-Type", "application/json")
+		if len(requests) == 1 {
+			_, _ = w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"","tool_calls":[
+				{"id":"call_1","type":"function","function":{"name":"weather","arguments":"{\"city\":\"Paris\"}"}}]}}],
+				"usage":{"prompt_tokens":10,"completion_tokens":5}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"Sunny in Paris"}}],"usage":{"prompt_tokens":20,"completion_tokens":4}}`))
+	}))
+	defer server.Close()
+
+	registry := ai.NewToolRegistry()
+	registry.Register(ai.Tool{Name: "weather", InputSchema: `{"type":"object","properties":{"city":{"type":"string"}}}`},
+		func(ctx context.Context, input json.RawMessage) (string, error) { return "sunny", nil })
+
+	p := NewOpenAI(ai.Config{Model: "gpt-4o", APIKey: "key", APIURL: server.URL})
+	resp, err := ai.RunToolLoop(context.Background(), p, ai.Request{Prompt: "Weather in Paris?"}, registry)
+	require.NoError(t, err)
+	require.Equal(t, "Sunny in Paris", resp.Text)
+	require.Equal(t, 30, resp.Usage.InputTokens)
+
+	require.Len(t, requests, 2)
+	tools := requests[0]["tools"].([]any)
+	require.Equal(t, "weather", tools[0].(map[string]any)["function"].(map[string]any)["name"])
+
+	messages := requests[1]["messages"].([]any)
+	require.Len(t, messages, 3)
+	assistant := messages[1].(map[string]any)
+	require.Equal(t, "call_1", assistant["tool_calls"].([]any)[0].(map[string]any)["id"])
+	result := messages[2].(map[string]any)
+	require.Equal(t, "tool", result["role"])
+	require.Equal(t, "call_1", result["tool_call_id"])
+	require.Equal(t, "sunny", result["content"])
+}
+
+func TestOpenAIProviderError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"error":{"message":"You exceeded your current quota","type":"insufficient_quota","code":"insufficient_quota"}}`))
+	}))
+	defer server.Close()
+
+	p := NewOpenAI(ai.Config{Model: "gpt-4o", APIKey: "key", APIURL: server.URL})
+	_, err := p.Execute(context.Background(), ai.Request{Prompt: "hello"})
+	perr, ok := ai.AsProviderError(err)
+	require.True(t, ok)
+	require.Equal(t, ai.BackendOpenAI, perr.Backend)
+	require.Equal(t, http.StatusTooManyRequests, perr.StatusCode)
+	require.Equal(t, ai.CategoryQuota, perr.Category)
+	require.Equal(t, "You exceeded your current quota", perr.Message)
+	require.Equal(t, 7.0, perr.RetryAfter.Seconds())
+}
+
+func TestOpenAIIntegration(t *testing.T) {
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	if apiKey == "" {
+		t.Skip("OPENAI_API_KEY not set")
+	}
+
+	p := NewOpenAI(ai.Config{APIKey: apiKey})
+	resp, err := p.Execute(context.Background(), ai.Request{
+		Prompt:    "Reply with exactly: hello",
+		MaxTokens: 256,
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, resp.Text)
+	require.Equal(t, ai.BackendOpenAI, resp.Backend)
+	require.Greater(t, resp.Usage.InputTokens, 0)
+}
@@ -0,0 +1,119 @@
+package provider
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/flanksource/captain/pkg/ai"
+	"github.com/flanksource/captain/pkg/ai/pricing"
+)
+
+// PricingModelID maps a model as named by backend to its ID in the pricing
+// registry, reporting false when no candidate ID is priced.
+func PricingModelID(backend ai.Backend, model string) (string, bool) {
+	match, ok := ResolvePricing(backend, model)
+	return match.ID, ok
+}
+
+// ResolvePricing finds the pricing registry entry of a model as named by
+// backend. Claude Code aliases are expanded with MapClaudeCodeModel, which
+// makes the match an alias, and OpenRouter IDs (anthropic/claude-sonnet-4.5)
+// are preferred over the built-in catalog IDs.
+func ResolvePricing(backend ai.Backend, model string) (pricing.Match, bool) {
+	vendor, name, aliased := pricingName(backend, model)
+	match, ok := pricing.Resolve(vendor, name)
+	if ok && aliased {
+		match.Confidence = pricing.ConfidenceAlias
+	}
+	return match, ok
+}
+
+func pricingCandidates(backend ai.Backend, model string) []string {
+	vendor, name, _ := pricingName(backend, model)
+	return pricing.Candidates(vendor, name)
+}
+
+// pricingName returns the vendor and registry name of model, reporting
+// whether a Claude Code alias was expanded.
+func pricingName(backend ai.Backend, model string) (vendor, name string, aliased bool) {
+	name = strings.ToLower(strings.TrimSpace(model))
+	name = strings.TrimPrefix(name, "models/")
+	if prefix, rest, ok := strings.Cut(name, "/"); ok {
+		vendor, name = prefix, rest
+	}
+	if backend == ai.BackendClaudeCLI || strings.HasPrefix(name, "claude-code-") {
+		mapped := MapClaudeCodeModel(name)
+		aliased = mapped != name
+		name = mapped
+	}
+	if vendor == "" {
+		vendor = modelVendor(backend, name)
+	}
+	return vendor, name, aliased
+}
+
+// modelVendor returns the OpenRouter vendor of a model, judged by its name
+// first since the OpenAI backend also serves grok models.
+func modelVendor(backend ai.Backend, model string) string {
+	if vendor := pricing.ModelVendor(model); vendor != "" {
+		return vendor
+	}
+	switch backend {
+	case ai.BackendAnthropic, ai.BackendClaudeCLI:
+		return "anthropic"
+	case ai.BackendGemini, ai.BackendGeminiCLI:
+		return "google"
+	case ai.BackendOpenAI, ai.BackendCodexCLI:
+		return "openai"
+	}
+	return ""
+}
+
+// CalculateCost prices each line of usage for a model served by backend, at
+// the long-context, cache TTL and service tier rates that apply to it. Local
+// Ollama models are free, so only their token counts are returned.
+func CalculateCost(backend ai.Backend, model string, usage ai.Usage) (ai.Cost, error) {
+	cost := ai.Cost{
+		Model:            model,
+		InputTokens:      usage.InputTokens,
+		OutputTokens:     usage.OutputTokens,
+		ReasoningTokens:  usage.ReasoningTokens,
+		CacheReadTokens:  usage.CacheReadTokens,
+		CacheWriteTokens: usage.CacheWriteTokens,
+		TotalTokens:      usage.TotalTokens(),
+	}
+	if backend == ai.BackendOllama {
+		return cost, nil
+	}
+
+	match, ok := ResolvePricing(backend, model)
+	if !ok {
+		return cost, fmt.Errorf("no pricing for %s model %s (tried %s)",
+			backend, model, strings.Join(pricingCandidates(backend, model), ", "))
+	}
+	result := match.Info.Cost(pricing.Usage{
+		InputTokens:        usage.InputTokens,
+		OutputTokens:       usage.OutputTokens,
+		ReasoningTokens:    usage.ReasoningTokens,
+		CacheReadTokens:    usage.CacheReadTokens,
+		CacheWriteTokens:   usage.CacheWriteTokens,
+		CacheWrite1hTokens: usage.CacheWrite1hTokens,
+		ServiceTier:        usage.ServiceTier,
+	})
+
+	cost.InputCost = result.InputCost
+	cost.OutputCost = result.OutputCost
+	cost.ReasoningCost = result.ReasoningCost
+	cost.CacheReadCost = result.CacheReadCost
+	cost.CacheWriteCost = result.CacheWriteCost
+	return cost, nil
+}
+
+// calculateCostUSD prices usage, returning 0 for models without pricing.
+func calculateCostUSD(backend ai.Backend, model string, usage ai.Usage) float64 {
+	cost, err := CalculateCost(backend, model, usage)
+	if err != nil {
+		return 0
+	}
+	return cost.Total()
+}
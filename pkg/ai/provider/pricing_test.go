@@ -0,0 +1,124 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/flanksource/captain/pkg/ai"
+	"github.com/flanksource/captain/pkg/ai/pricing"
+	"github.com/stretchr/testify/require"
+)
+
+func registerPricing(t *testing.T, models ...pricing.ModelInfo) {
+	t.Helper()
+	pricing.EnsureLoaded()
+	merged := map[string]*pricing.ModelInfo{}
+	for _, m := range models {
+		merged[m.ModelID] = &m
+	}
+	pricing.MergeModels(merged)
+}
+
+func TestPricingModelID(t *testing.T) {
+	registerPricing(t,
+		pricing.ModelInfo{ModelID: "anthropic/claude-sonnet-4.5", InputPrice: 3},
+		pricing.ModelInfo{ModelID: "anthropic/claude-opus-4.1", InputPrice: 15},
+		pricing.ModelInfo{ModelID: "openai/gpt-5", InputPrice: 1.25},
+		pricing.ModelInfo{ModelID: "x-ai/grok-4", InputPrice: 3},
+		pricing.ModelInfo{ModelID: "google/gemini-2.5-flash", InputPrice: 0.3},
+		pricing.ModelInfo{ModelID: "claude-test-9-9", InputPrice: 1},
+	)
+
+	tests := []struct {
+		backend ai.Backend
+		model   string
+		want    string
+	}{
+		{ai.BackendAnthropic, "claude-sonnet-4-5-20250929", "anthropic/claude-sonnet-4.5"},
+		{ai.BackendAnthropic, "claude-sonnet-4-5", "anthropic/claude-sonnet-4.5"},
+		{ai.BackendClaudeCLI, "claude-code-opus-4-1", "anthropic/claude-opus-4.1"},
+		{ai.BackendClaudeCLI, "opus-4-1", "anthropic/claude-opus-4.1"},
+		{ai.BackendOpenAI, "gpt-5", "openai/gpt-5"},
+		{ai.BackendCodexCLI, "gpt-5", "openai/gpt-5"},
+		{ai.BackendOpenAI, "grok-4", "x-ai/grok-4"},
+		{ai.BackendOpenAI, "openai/gpt-5", "openai/gpt-5"},
+		{ai.BackendGemini, "models/gemini-2.5-flash", "google/gemini-2.5-flash"},
+		{ai.BackendGeminiCLI, "gemini-2.5-flash", "google/gemini-2.5-flash"},
+		{ai.BackendAnthropic, "claude-test-9-9-20300101", "claude-test-9-9"},
+	}
+	for _, tt := range tests {
+		got, ok := PricingModelID(tt.backend, tt.model)
+		require.True(t, ok, "%s %s", tt.backend, tt.model)
+		require.Equal(t, tt.want, got, "%s %s", tt.backend, tt.model)
+	}
+
+	_, ok := PricingModelID(ai.BackendOpenAI, "mystery-model")
+	require.False(t, ok)
+
+	for model, want := range map[string]string{
+		"claude-sonnet-4-5":          pricing.ConfidenceExact,
+		"claude-sonnet-4-5-20250929": pricing.ConfidenceAlias,
+		"claude-code-opus-4-1":       pricing.ConfidenceAlias,
+	} {
+		match, ok := ResolvePricing(ai.BackendAnthropic, model)
+		require.True(t, ok, model)
+		require.Equal(t, want, match.Confidence, model)
+	}
+}
+
+func TestCalculateCostLineItems(t *testing.T) {
+	registerPricing(t, pricing.ModelInfo{
+		ModelID: "openai/gpt-linetest", InputPrice: 2, OutputPrice: 10, CacheReadsPrice: 0.5, CacheWritesPrice: 2.5,
+	})
+
+	cost, err := CalculateCost(ai.BackendOpenAI, "gpt-linetest", ai.Usage{
+		InputTokens: 1_000_000, OutputTokens: 100_000, ReasoningTokens: 200_000,
+		CacheReadTokens: 2_000_000, CacheWriteTokens: 400_000,
+	})
+	require.NoError(t, err)
+	require.InDelta(t, 2.0, cost.InputCost, 1e-9)
+	require.InDelta(t, 1.0, cost.OutputCost, 1e-9)
+	require.InDelta(t, 2.0, cost.ReasoningCost, 1e-9)
+	require.InDelta(t, 1.0, cost.CacheReadCost, 1e-9)
+	require.InDelta(t, 1.0, cost.CacheWriteCost, 1e-9)
+	require.InDelta(t, 7.0, cost.Total(), 1e-9)
+	require.Equal(t, 3_700_000, cost.TotalTokens)
+
+	free, err := CalculateCost(ai.BackendOllama, "llama3.2", ai.Usage{InputTokens: 10, OutputTokens: 5})
+	require.NoError(t, err)
+	require.Equal(t, 15, free.TotalTokens)
+	require.Zero(t, free.Total())
+
+	_, err = CalculateCost(ai.BackendOpenAI, "mystery-model", ai.Usage{InputTokens: 10})
+	require.ErrorContains(t, err, "openai/mystery-model")
+}
+
+func TestCalculateCostTiers(t *testing.T) {
+	registerPricing(t, pricing.ModelInfo{
+		ModelID: "anthropic/claude-tiertest", InputPrice: 3, OutputPrice: 15, CacheReadsPrice: 0.3,
+		CacheWritesPrice: 3.75, CacheWrites1hPrice: 6,
+		ContextTiers: []pricing.PriceTier{{AboveTokens: 200_000, InputPrice: 6, OutputPrice: 22.5, CacheWritesPrice: 7.5, CacheWrites1hPrice: 12}},
+		ServiceTiers: map[string]float64{pricing.ServiceTierPriority: 1.5},
+	})
+
+	tests := []struct {
+		name  string
+		usage ai.Usage
+		want  float64
+	}{
+		{"base", ai.Usage{InputTokens: 100_000, OutputTokens: 100_000}, 0.3 + 1.5},
+		{"cache ttl", ai.Usage{InputTokens: 100_000, CacheWriteTokens: 100_000, CacheWrite1hTokens: 50_000}, 0.3 + 0.1875 + 0.3},
+		// cache reads count towards the prompt; the tier keeps the base cache read price
+		{"long context", ai.Usage{InputTokens: 100_000, OutputTokens: 100_000, CacheReadTokens: 150_000}, 0.6 + 2.25 + 0.045},
+		{"long context cache ttl", ai.Usage{InputTokens: 100_000, CacheWriteTokens: 200_000, CacheWrite1hTokens: 100_000}, 0.6 + 0.75 + 1.2},
+		{"batch", ai.Usage{InputTokens: 100_000, OutputTokens: 100_000, ServiceTier: pricing.ServiceTierBatch}, (0.3 + 1.5) / 2},
+		{"priority", ai.Usage{InputTokens: 100_000, OutputTokens: 100_000, ServiceTier: pricing.ServiceTierPriority}, (0.3 + 1.5) * 1.5},
+		{"standard", ai.Usage{InputTokens: 100_000, OutputTokens: 100_000, ServiceTier: pricing.ServiceTierStandard}, 0.3 + 1.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cost, err := CalculateCost(ai.BackendAnthropic, "claude-tiertest", tt.usage)
+			require.NoError(t, err)
+			require.InDelta(t, tt.want, cost.Total(), 1e-9)
+		})
+	}
+}
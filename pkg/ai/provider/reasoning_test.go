@@ -0,0 +1,113 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flanksource/captain/pkg/ai"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnthropicThinking(t *testing.T) {
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"id":"m","type":"message","role":"assistant","model":"claude-sonnet-4-6","content":[
+			{"type":"thinking","thinking":"17 is only divisible by 1 and itself.","signature":"sig"},
+			{"type":"text","text":"Yes"}],"usage":{"input_tokens":20,"output_tokens":40}}`)
+	}))
+	defer server.Close()
+
+	p := NewAnthropic(ai.Config{Model: "claude-sonnet-4-6", APIKey: "key", APIURL: server.URL})
+	resp, err := p.Execute(context.Background(), ai.Request{
+		Prompt:          "Is 17 prime?",
+		MaxTokens:       1000,
+		Temperature:     0.5,
+		ReasoningEffort: ai.EffortLow,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "Yes", resp.Text)
+	require.Equal(t, "17 is only divisible by 1 and itself.", resp.Thinking)
+
+	require.Equal(t, map[string]any{"type": "enabled", "budget_tokens": float64(2048)}, body["thinking"])
+	require.Equal(t, float64(3048), body["max_tokens"])
+	require.NotContains(t, body, "temperature")
+}
+
+func TestOpenAIReasoningEffort(t *testing.T) {
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body = nil
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"Yes"}}],"usage":{"prompt_tokens":10,"completion_tokens":1}}`)
+	}))
+	defer server.Close()
+
+	req := ai.Request{Prompt: "Is 17 prime?", ThinkingBudget: 5000}
+	_, err := NewOpenAI(ai.Config{Model: "grok-4", APIKey: "key", APIURL: server.URL}).Execute(context.Background(), req)
+	require.NoError(t, err)
+	require.Equal(t, "medium", body["reasoning_effort"], "the catalog marks grok-4 as reasoning")
+
+	_, err = NewOpenAI(ai.Config{Model: "llama3.1:8b", APIKey: "key", APIURL: server.URL}).Execute(context.Background(), req)
+	require.NoError(t, err)
+	require.NotContains(t, body, "reasoning_effort", "unknown models of compatible servers may reject it")
+}
+
+func TestGeminiThinking(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"candidates":[{"content":{"role":"model","parts":[
+			{"text":"Checking divisors up to 4.","thought":true},{"text":"Yes"}]}}],
+			"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":1,"thoughtsTokenCount":30}}`)
+	}))
+	defer server.Close()
+
+	p := NewGemini(ai.Config{Model: "gemini-2.5-flash", APIKey: "key", APIURL: server.URL})
+	resp, err := p.Execute(context.Background(), ai.Request{Prompt: "Is 17 prime?", ThinkingBudget: 512})
+	require.NoError(t, err)
+	require.Equal(t, "Yes", resp.Text)
+	require.Equal(t, "Checking divisors up to 4.", resp.Thinking)
+	require.Contains(t, body, `"thinkingConfig":{"includeThoughts":true,"thinkingBudget":512}`)
+}
+
+func TestClaudeCLIThinkingBudget(t *testing.T) {
+	dir := t.TempDir()
+	fakeCLI(t, "claude", `echo "$MAX_THINKING_TOKENS" > `+dir+`/budget
+echo '{"result":"Yes","usage":{"input_tokens":5,"output_tokens":1}}'`)
+
+	_, err := NewClaudeCLI("claude-code-sonnet").Execute(context.Background(), ai.Request{Prompt: "Is 17 prime?", ReasoningEffort: ai.EffortMedium})
+	require.NoError(t, err)
+	budget, err := os.ReadFile(filepath.Join(dir, "budget"))
+	require.NoError(t, err)
+	require.Equal(t, "8192", strings.TrimSpace(string(budget)))
+}
+
+func TestReasoningNotSupported(t *testing.T) {
+	req := ai.Request{Prompt: "hi", ThinkingBudget: 1024}
+	providers := []ai.Provider{
+		NewAnthropic(ai.Config{Model: "claude-3-5-haiku-latest", APIKey: "key"}),
+		NewGemini(ai.Config{Model: "gemini-2.0-flash", APIKey: "key"}),
+		NewOpenAI(ai.Config{Model: "gpt-4o", APIKey: "key"}),
+		NewGeminiCLI(""),
+	}
+	for _, p := range providers {
+		_, err := p.Execute(context.Background(), req)
+		require.ErrorIs(t, err, ai.ErrReasoningNotSupported, p.GetModel())
+	}
+
+	_, err := NewOpenAI(ai.Config{Model: "o3", APIKey: "key"}).Execute(context.Background(), ai.Request{Prompt: "hi", ReasoningEffort: "extreme"})
+	require.ErrorContains(t, err, "invalid reasoning effort")
+}
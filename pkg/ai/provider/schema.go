@@ -4,19 +4,71 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 type JSONSchema struct {
-	Type                 string                `json:"type,omitempty"`
-	Properties           map[string]JSONSchema `json:"properties,omitempty"`
-	Required             []string              `json:"required,omitempty"`
-	Items                *JSONSchema           `json:"items,omitempty"`
-	Description          string                `json:"description,omitempty"`
-	Enum                 []any                 `json:"enum,omitempty"`
-	AdditionalProperties bool                  `json:"additionalProperties,omitempty"`
+	Ref                  string                 `json:"$ref,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	Properties           map[string]JSONSchema  `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	AdditionalProperties *JSONSchema            `json:"additionalProperties,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Enum                 []any                  `json:"enum,omitempty"`
+	Default              any                    `json:"default,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Maximum              *float64               `json:"maximum,omitempty"`
+	MinLength            *int                   `json:"minLength,omitempty"`
+	MaxLength            *int                   `json:"maxLength,omitempty"`
+	MinItems             *int                   `json:"minItems,omitempty"`
+	MaxItems             *int                   `json:"maxItems,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	OneOf                []JSONSchema           `json:"oneOf,omitempty"`
+	Defs                 map[string]*JSONSchema `json:"$defs,omitempty"`
 }
 
+var timeType = reflect.TypeFor[time.Time]()
+
+var (
+	oneOfMu       sync.RWMutex
+	oneOfVariants = map[reflect.Type][]reflect.Type{}
+)
+
+// RegisterOneOf declares the concrete types that may fill fields of interface
+// type I, so that their schema is a oneOf of the variants, e.g.
+// RegisterOneOf[Shape](Circle{}, Square{}). Unregistered interface fields
+// accept any value.
+func RegisterOneOf[I any](variants ...I) {
+	iface := reflect.TypeFor[I]()
+	if iface.Kind() != reflect.Interface {
+		panic(fmt.Sprintf("RegisterOneOf requires an interface type, got %s", iface))
+	}
+	types := make([]reflect.Type, 0, len(variants))
+	for _, v := range variants {
+		types = append(types, reflect.TypeOf(v))
+	}
+	oneOfMu.Lock()
+	defer oneOfMu.Unlock()
+	oneOfVariants[iface] = types
+}
+
+func registeredVariants(t reflect.Type) []reflect.Type {
+	oneOfMu.RLock()
+	defer oneOfMu.RUnlock()
+	return oneOfVariants[t]
+}
+
+// GenerateJSONSchema reflects over the struct behind v. Fields with omitempty
+// are optional, the rest required; `description` and `jsonschema` tags add
+// constraints (see applySchemaTag). Named struct types used more than once,
+// including recursive ones, are emitted once under $defs and referenced with
+// $ref.
 func GenerateJSONSchema(v any) (*JSONSchema, error) {
 	t := reflect.TypeOf(v)
 	if t == nil {
@@ -28,55 +80,194 @@ func GenerateJSONSchema(v any) (*JSONSchema, error) {
 	if t.Kind() != reflect.Struct {
 		return nil, fmt.Errorf("schema generation requires a struct type, got %s", t.Kind())
 	}
-	return buildSchema(t), nil
+	return typeSchema(t)
+}
+
+// typeSchema generates the schema of any type, with t's shared struct types
+// under $defs.
+func typeSchema(t reflect.Type) (*JSONSchema, error) {
+	t = deref(t)
+	g := &schemaGenerator{
+		root:  t,
+		uses:  map[reflect.Type]int{},
+		names: map[reflect.Type]string{},
+		defs:  map[string]*JSONSchema{},
+	}
+	g.countUses(t)
+	schema := g.inline(t)
+	if g.err != nil {
+		return nil, g.err
+	}
+	if len(g.defs) > 0 {
+		schema.Defs = g.defs
+	}
+	return schema, nil
+}
+
+type schemaGenerator struct {
+	root  reflect.Type
+	uses  map[reflect.Type]int
+	names map[reflect.Type]string
+	defs  map[string]*JSONSchema
+	err   error // first invalid jsonschema tag
+}
+
+// schemaField is a JSON property of a struct, with embedded structs flattened
+// the way encoding/json does.
+type schemaField struct {
+	name     string
+	required bool
+	field    reflect.StructField
 }
 
-func buildSchema(t reflect.Type) *JSONSchema {
+func structFields(t reflect.Type) []schemaField {
+	var direct, embedded []schemaField
+	for i := range t.NumField() {
+		field := t.Field(i)
+		jsonTag := field.Tag.Get("json")
+		if jsonTag == "-" {
+			continue
+		}
+
+		fieldName := field.Name
+		isRequired := true
+		parts := strings.Split(jsonTag, ",")
+		if parts[0] != "" {
+			fieldName = parts[0]
+		}
+		for _, part := range parts[1:] {
+			if part == "omitempty" {
+				isRequired = false
+			}
+		}
+
+		if field.Anonymous && parts[0] == "" && deref(field.Type).Kind() == reflect.Struct {
+			embedded = append(embedded, structFields(deref(field.Type))...)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		direct = append(direct, schemaField{name: fieldName, required: isRequired, field: field})
+	}
+
+	// fields declared on the outer struct hide promoted ones
+	fields := direct
+	for _, f := range embedded {
+		if !hasSchemaField(fields, f.name) {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+func hasSchemaField(fields []schemaField, name string) bool {
+	for _, f := range fields {
+		if f.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func deref(t reflect.Type) reflect.Type {
 	for t.Kind() == reflect.Ptr {
 		t = t.Elem()
 	}
+	return t
+}
+
+// countUses records how often each named struct type is reached; types seen
+// twice are shared or recursive and go to $defs.
+func (g *schemaGenerator) countUses(t reflect.Type) {
+	t = deref(t)
+	switch t.Kind() {
+	case reflect.Struct:
+		if t == timeType {
+			return
+		}
+		if t.Name() != "" {
+			g.uses[t]++
+			if g.uses[t] > 1 {
+				return
+			}
+		}
+		for _, f := range structFields(t) {
+			g.countUses(f.field.Type)
+		}
+	case reflect.Slice, reflect.Array, reflect.Map:
+		g.countUses(t.Elem())
+	case reflect.Interface:
+		for _, variant := range registeredVariants(t) {
+			g.countUses(variant)
+		}
+	}
+}
+
+// schema returns a $ref for shared struct types and the inline schema
+// otherwise.
+func (g *schemaGenerator) schema(t reflect.Type) *JSONSchema {
+	t = deref(t)
+	if t.Kind() != reflect.Struct || g.uses[t] < 2 {
+		return g.inline(t)
+	}
+	if t == g.root {
+		return &JSONSchema{Ref: "#"}
+	}
+	name := g.defName(t)
+	if _, ok := g.defs[name]; !ok {
+		// registered before building so recursive fields resolve to the $ref
+		def := &JSONSchema{}
+		g.defs[name] = def
+		*def = *g.inline(t)
+	}
+	return &JSONSchema{Ref: "#/$defs/" + name}
+}
 
+// defName is the type name, qualified by its package when two shared types
+// have the same name.
+func (g *schemaGenerator) defName(t reflect.Type) string {
+	if name, ok := g.names[t]; ok {
+		return name
+	}
+	name := t.Name()
+	for other, taken := range g.names {
+		if taken == name && other != t {
+			pkg := t.PkgPath()
+			name = pkg[strings.LastIndex(pkg, "/")+1:] + "." + t.Name()
+			break
+		}
+	}
+	g.names[t] = name
+	return name
+}
+
+func (g *schemaGenerator) inline(t reflect.Type) *JSONSchema {
+	t = deref(t)
 	schema := &JSONSchema{}
 
 	switch t.Kind() {
 	case reflect.Struct:
+		if t == timeType {
+			return &JSONSchema{Type: "string", Format: "date-time"}
+		}
 		schema.Type = "object"
 		schema.Properties = make(map[string]JSONSchema)
 		var required []string
 
-		for i := range t.NumField() {
-			field := t.Field(i)
-			if !field.IsExported() {
-				continue
-			}
-
-			jsonTag := field.Tag.Get("json")
-			if jsonTag == "-" {
-				continue
+		for _, f := range structFields(t) {
+			fieldSchema := g.schema(f.field.Type)
+			if desc := f.field.Tag.Get("description"); desc != "" {
+				fieldSchema.Description = desc
 			}
-
-			fieldName := field.Name
-			isRequired := true
-
-			if jsonTag != "" {
-				parts := strings.Split(jsonTag, ",")
-				if parts[0] != "" {
-					fieldName = parts[0]
-				}
-				for _, part := range parts[1:] {
-					if part == "omitempty" {
-						isRequired = false
-					}
+			if tag, ok := f.field.Tag.Lookup("jsonschema"); ok {
+				if err := applySchemaTag(fieldSchema, tag); err != nil && g.err == nil {
+					g.err = fmt.Errorf("invalid jsonschema tag on %s.%s: %w", t.Name(), f.field.Name, err)
 				}
 			}
-
-			fieldSchema := buildSchema(field.Type)
-			if desc := field.Tag.Get("description"); desc != "" {
-				fieldSchema.Description = desc
-			}
-			schema.Properties[fieldName] = *fieldSchema
-			if isRequired {
-				required = append(required, fieldName)
+			schema.Properties[f.name] = *fieldSchema
+			if f.required {
+				required = append(required, f.name)
 			}
 		}
 		if len(required) > 0 {
@@ -85,11 +276,11 @@ func buildSchema(t reflect.Type) *JSONSchema {
 
 	case reflect.Slice, reflect.Array:
 		schema.Type = "array"
-		schema.Items = buildSchema(t.Elem())
+		schema.Items = g.schema(t.Elem())
 
 	case reflect.Map:
 		schema.Type = "object"
-		schema.AdditionalProperties = true
+		schema.AdditionalProperties = g.schema(t.Elem())
 
 	case reflect.String:
 		schema.Type = "string"
@@ -105,7 +296,9 @@ func buildSchema(t reflect.Type) *JSONSchema {
 		schema.Type = "boolean"
 
 	case reflect.Interface:
-		return &JSONSchema{}
+		for _, variant := range registeredVariants(t) {
+			schema.OneOf = append(schema.OneOf, *g.schema(variant))
+		}
 
 	default:
 		schema.Type = "string"
@@ -114,6 +307,125 @@ func buildSchema(t reflect.Type) *JSONSchema {
 	return schema
 }
 
+// applySchemaTag applies a `jsonschema:"..."` tag: comma-separated key=value
+// pairs, with `\,` for a literal comma. Keys are description, enum
+// (repeatable), min and max (value bounds for numbers, lengths for strings,
+// item counts for arrays), pattern, format and default. On arrays enum,
+// pattern and format constrain the items.
+func applySchemaTag(schema *JSONSchema, tag string) error {
+	values := schema
+	if schema.Type == "array" && schema.Items != nil {
+		values = schema.Items
+	}
+
+	for _, part := range splitSchemaTag(tag) {
+		key, value, _ := strings.Cut(part, "=")
+		key = strings.TrimSpace(key)
+		switch key {
+		case "":
+		case "description":
+			schema.Description = value
+		case "enum":
+			v, err := parseSchemaValue(values.Type, value)
+			if err != nil {
+				return fmt.Errorf("enum: %w", err)
+			}
+			values.Enum = append(values.Enum, v)
+		case "default":
+			v, err := parseSchemaValue(schema.Type, value)
+			if err != nil {
+				return fmt.Errorf("default: %w", err)
+			}
+			schema.Default = v
+		case "pattern":
+			if _, err := regexp.Compile(value); err != nil {
+				return fmt.Errorf("pattern: %w", err)
+			}
+			values.Pattern = value
+		case "format":
+			values.Format = value
+		case "min", "max":
+			if err := applyBound(schema, key == "min", value); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+		default:
+			return fmt.Errorf("unknown key %q", key)
+		}
+	}
+	return nil
+}
+
+func applyBound(schema *JSONSchema, isMin bool, value string) error {
+	switch schema.Type {
+	case "integer", "number":
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		if isMin {
+			schema.Minimum = &n
+		} else {
+			schema.Maximum = &n
+		}
+		return nil
+	case "string", "array":
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		switch {
+		case schema.Type == "string" && isMin:
+			schema.MinLength = &n
+		case schema.Type == "string":
+			schema.MaxLength = &n
+		case isMin:
+			schema.MinItems = &n
+		default:
+			schema.MaxItems = &n
+		}
+		return nil
+	}
+	return fmt.Errorf("not supported for type %q", schema.Type)
+}
+
+// parseSchemaValue converts a tag value to the JSON type of the field; other
+// types take a JSON literal.
+func parseSchemaValue(schemaType, value string) (any, error) {
+	switch schemaType {
+	case "string":
+		return value, nil
+	case "integer":
+		return strconv.ParseInt(value, 10, 64)
+	case "number":
+		return strconv.ParseFloat(value, 64)
+	case "boolean":
+		return strconv.ParseBool(value)
+	}
+	var v any
+	if err := json.Unmarshal([]byte(value), &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func splitSchemaTag(tag string) []string {
+	var parts []string
+	var current strings.Builder
+	for i := 0; i < len(tag); i++ {
+		switch {
+		case tag[i] == '\\' && i+1 < len(tag) && tag[i+1] == ',':
+			current.WriteByte(',')
+			i++
+		case tag[i] == ',':
+			parts = append(parts, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(tag[i])
+		}
+	}
+	return append(parts, current.String())
+}
+
 func SchemaToJSON(schema *JSONSchema) (string, error) {
 	data, err := json.Marshal(schema)
 	if err != nil {
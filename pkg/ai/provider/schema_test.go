@@ -2,7 +2,16 @@ package provider
 
 import (
 	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/flanksource/captain/pkg/ai"
 )
 
 type testStruct struct {
@@ -71,3 +80,267 @@ func TestSchemaToJSON(t *testing.T) {
 		t.Errorf("Type = %q, want string", decoded.Type)
 	}
 }
+
+type validatedOrder struct {
+	ID     int      `json:"id"`
+	Status string   `json:"status"`
+	Items  []string `json:"items"`
+	Note   string   `json:"note,omitempty"`
+}
+
+func TestValidateJSON(t *testing.T) {
+	schema, err := GenerateJSONSchema(validatedOrder{})
+	if err != nil {
+		t.Fatalf("GenerateJSONSchema: %v", err)
+	}
+	status := schema.Properties["status"]
+	status.Enum = []any{"open", "closed"}
+	schema.Properties["status"] = status
+
+	var doc any
+	if err := json.Unmarshal([]byte(`{"id":1.5,"status":"lost","items":["a",2],"note":null}`), &doc); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, v := range ValidateJSON(schema, doc) {
+		got = append(got, v.String())
+	}
+	want := []string{
+		"/id: expected integer, got number",
+		"/items/1: expected string, got integer",
+		`/status: must be one of "open", "closed"`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("violations =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestDecodeStructured(t *testing.T) {
+	var order validatedOrder
+	if err := DecodeStructured("```json\n{\"id\":7,\"status\":\"open\",\"items\":[\"a\"]}\n```", &order); err != nil {
+		t.Fatalf("DecodeStructured: %v", err)
+	}
+	if order.ID != 7 || order.Status != "open" {
+		t.Errorf("order = %+v", order)
+	}
+
+	err := DecodeStructured(`{"status":"open"}`, &validatedOrder{})
+	if !errors.Is(err, ai.ErrSchemaValidation) {
+		t.Fatalf("expected ErrSchemaValidation, got %v", err)
+	}
+	serr, ok := ai.AsSchemaValidationError(err)
+	if !ok || len(serr.Violations) != 2 {
+		t.Fatalf("expected 2 violations, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "/id: required property is missing; /items: required property is missing") {
+		t.Errorf("error = %v", err)
+	}
+
+	err = DecodeStructured("no json here", &validatedOrder{})
+	if serr, ok := ai.AsSchemaValidationError(err); !ok || serr.Output != "no json here" {
+		t.Errorf("expected a validation error keeping the output, got %v", err)
+	}
+}
+
+func TestDecodeStructuredOneOf(t *testing.T) {
+	RegisterOneOf[goldenShape](goldenCircle{}, goldenSquare{})
+
+	type layout struct {
+		goldenBase
+		Drawing goldenDrawing          `json:"drawing"`
+		Named   map[string]goldenShape `json:"named"`
+		Focus   *goldenDrawing         `json:"focus,omitempty"`
+	}
+	var got layout
+	err := DecodeStructured(`{"id": "l1",
+		"drawing": {"title": "t", "shapes": [{"radius": 1}, {"side": 2}], "any": {"k": 1}},
+		"named": {"sun": {"radius": 3}},
+		"focus": {"title": "f", "shapes": [{"side": 4}]}}`, &got)
+	if err != nil {
+		t.Fatalf("DecodeStructured: %v", err)
+	}
+	want := layout{
+		goldenBase: goldenBase{ID: "l1"},
+		Drawing:    goldenDrawing{Title: "t", Shapes: []goldenShape{goldenCircle{Radius: 1}, goldenSquare{Side: 2}}, Any: map[string]any{"k": float64(1)}},
+		Named:      map[string]goldenShape{"sun": goldenCircle{Radius: 3}},
+		Focus:      &goldenDrawing{Title: "f", Shapes: []goldenShape{goldenSquare{Side: 4}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decoded %+v, want %+v", got, want)
+	}
+
+	err = DecodeStructured(`{"id": "l1", "drawing": {"title": "t", "shapes": [{"edges": 3}]}, "named": {}}`, &layout{})
+	if !errors.Is(err, ai.ErrSchemaValidation) {
+		t.Errorf("expected ErrSchemaValidation for an unknown variant, got %v", err)
+	}
+}
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata/schema")
+
+type goldenTags struct {
+	Name     string   `json:"name" jsonschema:"description=Display name,min=1,max=64,pattern=^[a-z-]+$"`
+	Priority string   `json:"priority" jsonschema:"enum=low,enum=medium,enum=high,default=medium"`
+	Score    float64  `json:"score" jsonschema:"min=0,max=1"`
+	Retries  int      `json:"retries,omitempty" jsonschema:"default=3,max=10"`
+	Labels   []string `json:"labels,omitempty" jsonschema:"enum=bug,enum=feature,max=5"`
+	Summary  string   `json:"summary" jsonschema:"description=One line\\, no trailing period"`
+}
+
+type goldenAddress struct {
+	City    string `json:"city"`
+	Country string `json:"country,omitempty"`
+}
+
+type goldenTree struct {
+	Value    int          `json:"value"`
+	Children []goldenTree `json:"children,omitempty"`
+}
+
+type goldenPerson struct {
+	Name     string         `json:"name"`
+	Home     goldenAddress  `json:"home"`
+	Work     *goldenAddress `json:"work,omitempty" description:"Office address"`
+	Skills   goldenTree     `json:"skills"`
+	Children []goldenPerson `json:"children,omitempty"`
+}
+
+type goldenEvent struct {
+	At     time.Time         `json:"at"`
+	Until  *time.Time        `json:"until,omitempty"`
+	Tags   map[string]string `json:"tags"`
+	Counts map[string]int    `json:"counts,omitempty"`
+	Extra  map[string]any    `json:"extra,omitempty"`
+}
+
+type goldenShape interface{ area() float64 }
+
+type goldenCircle struct {
+	Radius float64 `json:"radius"`
+}
+
+type goldenSquare struct {
+	Side float64 `json:"side"`
+}
+
+func (c goldenCircle) area() float64 { return 3.14159 * c.Radius * c.Radius }
+func (s goldenSquare) area() float64 { return s.Side * s.Side }
+
+type goldenDrawing struct {
+	Title  string        `json:"title"`
+	Shapes []goldenShape `json:"shapes"`
+	Any    any           `json:"any,omitempty"`
+}
+
+type goldenBase struct {
+	ID      string    `json:"id"`
+	Created time.Time `json:"created,omitempty"`
+}
+
+type goldenRequired struct {
+	goldenBase
+	Name     string `json:"name"`
+	Nick     string `json:"nick,omitempty"`
+	Internal string `json:"-"`
+	Untagged bool
+	hidden   string
+}
+
+func TestGenerateJSONSchemaGolden(t *testing.T) {
+	RegisterOneOf[goldenShape](goldenCircle{}, goldenSquare{})
+
+	cases := map[string]any{
+		"tags":          goldenTags{},
+		"defs":          goldenPerson{},
+		"time_and_maps": goldenEvent{},
+		"one_of":        goldenDrawing{},
+		"required":      goldenRequired{},
+	}
+	for name, v := range cases {
+		t.Run(name, func(t *testing.T) {
+			schema, err := GenerateJSONSchema(v)
+			if err != nil {
+				t.Fatalf("GenerateJSONSchema: %v", err)
+			}
+			got, err := json.MarshalIndent(schema, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			path := filepath.Join("testdata", "schema", name+".json")
+			if *updateGolden {
+				if err := os.WriteFile(path, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("%v (run with -update to create it)", err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("schema for %T does not match %s:\n%s", v, path, got)
+			}
+		})
+	}
+}
+
+func TestGenerateJSONSchemaInvalidTag(t *testing.T) {
+	type badBound struct {
+		Enabled bool `json:"enabled" jsonschema:"min=1"`
+	}
+	type badKey struct {
+		Name string `json:"name" jsonschema:"minimum=1"`
+	}
+	for _, v := range []any{badBound{}, badKey{}} {
+		if _, err := GenerateJSONSchema(v); err == nil || !strings.Contains(err.Error(), "invalid jsonschema tag") {
+			t.Errorf("%T: expected an invalid tag error, got %v", v, err)
+		}
+	}
+}
+
+func TestValidateJSONConstraints(t *testing.T) {
+	RegisterOneOf[goldenShape](goldenCircle{}, goldenSquare{})
+
+	type document struct {
+		Tags    goldenTags     `json:"tags"`
+		Person  goldenPerson   `json:"person"`
+		Event   goldenEvent    `json:"event"`
+		Drawing goldenDrawing  `json:"drawing"`
+		Extra   map[string]int `json:"extra"`
+	}
+	schema, err := GenerateJSONSchema(document{})
+	if err != nil {
+		t.Fatalf("GenerateJSONSchema: %v", err)
+	}
+
+	var doc any
+	if err := json.Unmarshal([]byte(`{
+		"tags": {"name": "Bad Name", "priority": "low", "score": 1.5, "labels": ["bug", "chore"], "summary": ""},
+		"person": {"name": "a", "home": {}, "skills": {"value": 1, "children": [{"value": "x"}]},
+			"children": [{"name": "b", "home": {"city": "Paris"}, "skills": {"value": 2}}]},
+		"event": {"at": "yesterday", "tags": {"env": 1}},
+		"drawing": {"title": "t", "shapes": [{"radius": 1}, {"side": 2}, {"edges": 3}]},
+		"extra": {"a": 1, "b": "two"}
+	}`), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, v := range ValidateJSON(schema, doc) {
+		got = append(got, v.String())
+	}
+	want := []string{
+		"/drawing/shapes/2: must match exactly one of 2 schemas, matched 0",
+		"/event/at: must be an RFC 3339 date-time",
+		"/event/tags/env: expected string, got integer",
+		"/extra/b: expected integer, got string",
+		"/person/home/city: required property is missing",
+		"/person/skills/children/0/value: expected integer, got string",
+		"/tags/labels/1: must be one of \"bug\", \"feature\"",
+		"/tags/name: must match pattern ^[a-z-]+$",
+		"/tags/score: must be <= 1",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("violations =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,416 @@
+package provider
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/flanksource/captain/pkg/ai"
+)
+
+// withUsage records usage on the SchemaValidationError in err's chain, the
+// tokens spent on the reply it rejected.
+func withUsage(err error, usage ai.Usage) error {
+	if serr, ok := ai.AsSchemaValidationError(err); ok {
+		serr.Usage = usage
+	}
+	return err
+}
+
+// DecodeStructured extracts the JSON document from a model reply, validates it
+// against the schema generated for v and unmarshals it into v. Any failure is
+// returned as an *ai.SchemaValidationError listing every violation.
+func DecodeStructured(text string, v any) error {
+	schema, err := GenerateJSONSchema(v)
+	if err != nil {
+		return fmt.Errorf("failed to generate schema: %w", err)
+	}
+
+	data := text
+	var doc any
+	if err := json.Unmarshal([]byte(data), &doc); err != nil {
+		data = CleanupJSONResponse(text)
+		if err := json.Unmarshal([]byte(data), &doc); err != nil {
+			return &ai.SchemaValidationError{Output: text, Violations: []ai.SchemaViolation{
+				{Message: fmt.Sprintf("response is not valid JSON: %v", err)},
+			}}
+		}
+	}
+
+	if violations := ValidateJSON(schema, doc); len(violations) > 0 {
+		return &ai.SchemaValidationError{Output: text, Violations: violations}
+	}
+	target := reflect.ValueOf(v)
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		return fmt.Errorf("cannot decode into non-pointer %T", v)
+	}
+	if err := decodeOneOf([]byte(data), target.Elem()); err != nil {
+		return &ai.SchemaValidationError{Output: text, Violations: []ai.SchemaViolation{{Message: err.Error()}}}
+	}
+	return nil
+}
+
+// decodeOneOf unmarshals data into dst. encoding/json cannot fill interface
+// fields, so values of types registered with RegisterOneOf are decoded into
+// the first variant whose schema they match.
+func decodeOneOf(data []byte, dst reflect.Value) error {
+	if !hasOneOf(dst.Type(), map[reflect.Type]bool{}) {
+		return json.Unmarshal(data, dst.Addr().Interface())
+	}
+
+	switch dst.Kind() {
+	case reflect.Interface:
+		if string(data) == "null" {
+			dst.SetZero()
+			return nil
+		}
+		variant, err := matchVariant(data, dst.Type())
+		if err != nil {
+			return err
+		}
+		value := reflect.New(deref(variant))
+		if err := decodeOneOf(data, value.Elem()); err != nil {
+			return err
+		}
+		if variant.Kind() == reflect.Ptr {
+			dst.Set(value)
+		} else {
+			dst.Set(value.Elem())
+		}
+
+	case reflect.Ptr:
+		if string(data) == "null" {
+			dst.SetZero()
+			return nil
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return decodeOneOf(data, dst.Elem())
+
+	case reflect.Struct:
+		// encoding/json fills every other field, skipping the interfaces it
+		// cannot decode; structs embedded unexported were filled by their parent
+		if dst.CanInterface() {
+			var typeErr *json.UnmarshalTypeError
+			if err := json.Unmarshal(data, dst.Addr().Interface()); err != nil && !errors.As(err, &typeErr) {
+				return err
+			}
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return err
+		}
+		t := dst.Type()
+		for i := range t.NumField() {
+			field := t.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			name = cmp.Or(name, field.Name)
+			switch {
+			case name == "-" || !hasOneOf(field.Type, map[reflect.Type]bool{}):
+			case field.Anonymous && field.Tag.Get("json") == "" && field.Type.Kind() == reflect.Struct:
+				if err := decodeOneOf(data, dst.Field(i)); err != nil {
+					return err
+				}
+			case field.IsExported():
+				raw, ok := fields[name]
+				if !ok {
+					continue
+				}
+				if err := decodeOneOf(raw, dst.Field(i)); err != nil {
+					return fmt.Errorf("%s: %w", name, err)
+				}
+			}
+		}
+
+	case reflect.Slice:
+		var items []json.RawMessage
+		if err := json.Unmarshal(data, &items); err != nil {
+			return err
+		}
+		if items == nil {
+			dst.SetZero()
+			return nil
+		}
+		slice := reflect.MakeSlice(dst.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := decodeOneOf(item, slice.Index(i)); err != nil {
+				return fmt.Errorf("[%d]: %w", i, err)
+			}
+		}
+		dst.Set(slice)
+
+	case reflect.Map:
+		var items map[string]json.RawMessage
+		if err := json.Unmarshal(data, &items); err != nil {
+			return err
+		}
+		if items == nil {
+			dst.SetZero()
+			return nil
+		}
+		m := reflect.MakeMapWithSize(dst.Type(), len(items))
+		for key, item := range items {
+			value := reflect.New(dst.Type().Elem()).Elem()
+			if err := decodeOneOf(item, value); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			m.SetMapIndex(reflect.ValueOf(key).Convert(dst.Type().Key()), value)
+		}
+		dst.Set(m)
+
+	default:
+		return fmt.Errorf("cannot decode oneOf values inside %s", dst.Type())
+	}
+	return nil
+}
+
+// matchVariant returns the first type registered for iface whose schema data
+// matches.
+func matchVariant(data []byte, iface reflect.Type) (reflect.Type, error) {
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	for _, variant := range registeredVariants(iface) {
+		schema, err := typeSchema(variant)
+		if err != nil {
+			return nil, err
+		}
+		if len(ValidateJSON(schema, doc)) == 0 {
+			return variant, nil
+		}
+	}
+	return nil, fmt.Errorf("value matches none of the %s variants", iface)
+}
+
+// hasOneOf reports whether t reaches an interface registered with
+// RegisterOneOf, which encoding/json cannot decode into.
+func hasOneOf(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+	switch t.Kind() {
+	case reflect.Interface:
+		return len(registeredVariants(t)) > 0
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return hasOneOf(t.Elem(), seen)
+	case reflect.Struct:
+		for i := range t.NumField() {
+			if field := t.Field(i); field.IsExported() || field.Anonymous {
+				if hasOneOf(field.Type, seen) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// ValidateJSON checks a document decoded with encoding/json against schema and
+// returns every violation, sorted by JSON pointer. Optional properties may be
+// null, matching how omitempty fields decode. $ref is resolved against the
+// $defs of schema.
+func ValidateJSON(schema *JSONSchema, doc any) []ai.SchemaViolation {
+	v := &schemaValidator{root: schema}
+	v.validate(schema, doc, "")
+	sort.SliceStable(v.violations, func(i, j int) bool { return v.violations[i].Pointer < v.violations[j].Pointer })
+	return v.violations
+}
+
+type schemaValidator struct {
+	root       *JSONSchema
+	violations []ai.SchemaViolation
+}
+
+func (v *schemaValidator) fail(pointer, format string, args ...any) {
+	v.violations = append(v.violations, ai.SchemaViolation{Pointer: pointer, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *schemaValidator) resolve(ref string) *JSONSchema {
+	if ref == "#" {
+		return v.root
+	}
+	if name, ok := strings.CutPrefix(ref, "#/$defs/"); ok {
+		return v.root.Defs[name]
+	}
+	return nil
+}
+
+func (v *schemaValidator) validate(schema *JSONSchema, value any, pointer string) {
+	if schema.Ref != "" {
+		resolved := v.resolve(schema.Ref)
+		if resolved == nil {
+			v.fail(pointer, "unresolvable $ref %s", schema.Ref)
+			return
+		}
+		schema = resolved
+	}
+
+	if schema.Type != "" && !matchesType(schema.Type, value) {
+		v.fail(pointer, "expected %s, got %s", schema.Type, jsonType(value))
+		return
+	}
+
+	if len(schema.Enum) > 0 && !inEnum(schema.Enum, value) {
+		v.fail(pointer, "must be one of %s", formatEnum(schema.Enum))
+	}
+
+	if len(schema.OneOf) > 0 {
+		matched := 0
+		for i := range schema.OneOf {
+			alt := &schemaValidator{root: v.root}
+			alt.validate(&schema.OneOf[i], value, pointer)
+			if len(alt.violations) == 0 {
+				matched++
+			}
+		}
+		if matched != 1 {
+			v.fail(pointer, "must match exactly one of %d schemas, matched %d", len(schema.OneOf), matched)
+		}
+	}
+
+	switch val := value.(type) {
+	case map[string]any:
+		for _, name := range schema.Required {
+			if _, ok := val[name]; !ok {
+				v.fail(pointer+"/"+escapePointer(name), "required property is missing")
+			}
+		}
+		for name, child := range val {
+			childPointer := pointer + "/" + escapePointer(name)
+			prop, declared := schema.Properties[name]
+			switch {
+			case !declared && schema.AdditionalProperties != nil:
+				v.validate(schema.AdditionalProperties, child, childPointer)
+			case !declared:
+			case child == nil && !slices.Contains(schema.Required, name):
+			default:
+				v.validate(&prop, child, childPointer)
+			}
+		}
+	case []any:
+		if schema.MinItems != nil && len(val) < *schema.MinItems {
+			v.fail(pointer, "must have at least %d items", *schema.MinItems)
+		}
+		if schema.MaxItems != nil && len(val) > *schema.MaxItems {
+			v.fail(pointer, "must have at most %d items", *schema.MaxItems)
+		}
+		if schema.Items != nil {
+			for i, item := range val {
+				v.validate(schema.Items, item, fmt.Sprintf("%s/%d", pointer, i))
+			}
+		}
+	case string:
+		length := utf8.RuneCountInString(val)
+		if schema.MinLength != nil && length < *schema.MinLength {
+			v.fail(pointer, "must be at least %d characters", *schema.MinLength)
+		}
+		if schema.MaxLength != nil && length > *schema.MaxLength {
+			v.fail(pointer, "must be at most %d characters", *schema.MaxLength)
+		}
+		if schema.Pattern != "" {
+			if re, err := regexp.Compile(schema.Pattern); err == nil && !re.MatchString(val) {
+				v.fail(pointer, "must match pattern %s", schema.Pattern)
+			}
+		}
+		if schema.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, val); err != nil {
+				v.fail(pointer, "must be an RFC 3339 date-time")
+			}
+		}
+	case float64:
+		if schema.Minimum != nil && val < *schema.Minimum {
+			v.fail(pointer, "must be >= %v", *schema.Minimum)
+		}
+		if schema.Maximum != nil && val > *schema.Maximum {
+			v.fail(pointer, "must be <= %v", *schema.Maximum)
+		}
+	}
+}
+
+func matchesType(schemaType string, value any) bool {
+	switch schemaType {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	}
+	return true
+}
+
+func jsonType(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// inEnum compares by JSON encoding, so enum values declared as Go ints match
+// the float64 numbers encoding/json decodes.
+func inEnum(enum []any, value any) bool {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return false
+	}
+	for _, e := range enum {
+		if allowed, err := json.Marshal(e); err == nil && string(allowed) == string(encoded) {
+			return true
+		}
+	}
+	return false
+}
+
+func formatEnum(enum []any) string {
+	values := make([]string, len(enum))
+	for i, e := range enum {
+		data, _ := json.Marshal(e)
+		values[i] = string(data)
+	}
+	return strings.Join(values, ", ")
+}
+
+// escapePointer escapes a property name as a JSON pointer reference token.
+func escapePointer(name string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(name)
+}
@@ -0,0 +1,18 @@
+package provider
+
+import (
+	"context"
+
+	"github.com/flanksource/captain/pkg/ai"
+)
+
+// sendEvent delivers ev unless ctx is cancelled first, reporting whether the
+// event was sent so producers can stop early.
+func sendEvent(ctx context.Context, events chan<- ai.Event, ev ai.Event) bool {
+	select {
+	case events <- ev:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
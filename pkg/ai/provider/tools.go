@@ -0,0 +1,44 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// schemaMap converts a JSON schema value (a *JSONSchema, map or raw JSON) into
+// a generic map so individual keywords can be mapped onto provider types.
+func schemaMap(schema any) (map[string]any, error) {
+	if schema == nil {
+		return map[string]any{"type": "object"}, nil
+	}
+
+	var data []byte
+	switch s := schema.(type) {
+	case json.RawMessage:
+		data = s
+	case []byte:
+		data = s
+	case string:
+		data = []byte(s)
+	default:
+		var err error
+		if data, err = json.Marshal(schema); err != nil {
+			return nil, fmt.Errorf("failed to marshal schema: %w", err)
+		}
+	}
+
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse schema: %w", err)
+	}
+	return m, nil
+}
+
+// toolInput returns the recorded tool call arguments in a form that marshals
+// back to a JSON object.
+func toolInput(input json.RawMessage) any {
+	if len(input) == 0 {
+		return map[string]any{}
+	}
+	return input
+}
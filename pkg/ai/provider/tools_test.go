@@ -0,0 +1,180 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/flanksource/captain/pkg/ai"
+	"github.com/stretchr/testify/require"
+)
+
+type weatherInput struct {
+	City string `json:"city" description:"City name"`
+}
+
+func weatherRegistry(t *testing.T, calls *[]string) *ai.ToolRegistry {
+	schema, err := GenerateJSONSchema(weatherInput{})
+	require.NoError(t, err)
+
+	registry := ai.NewToolRegistry()
+	registry.Register(ai.Tool{Name: "get_weather", Description: "Current weather", InputSchema: schema},
+		func(_ context.Context, input json.RawMessage) (string, error) {
+			var in weatherInput
+			if err := json.Unmarshal(input, &in); err != nil {
+				return "", err
+			}
+			*calls = append(*calls, in.City)
+			return "sunny in " + in.City, nil
+		})
+	return registry
+}
+
+func TestAnthropicRunToolLoop(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(data))
+		w.Header().Set("Content-Type", "application/json")
+		if len(bodies) == 1 {
+			_, _ = fmt.Fprint(w, `{"id":"m1","type":"message","role":"assistant","model":"claude-sonnet-4-6","stop_reason":"tool_use",
+				"content":[{"type":"text","text":"Checking."},{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{"city":"Paris"}}],
+				"usage":{"input_tokens":20,"output_tokens":10}}`)
+			return
+		}
+		_, _ = fmt.Fprint(w, `{"id":"m2","type":"message","role":"assistant","model":"claude-sonnet-4-6","stop_reason":"end_turn",
+			"content":[{"type":"text","text":"It is sunny in Paris."}],"usage":{"input_tokens":40,"output_tokens":8}}`)
+	}))
+	defer server.Close()
+
+	var calls []string
+	p := NewAnthropic(ai.Config{Model: "claude-sonnet-4-6", APIKey: "key", APIURL: server.URL})
+	resp, err := ai.RunToolLoop(context.Background(), p, ai.Request{Prompt: "Weather in Paris?"}, weatherRegistry(t, &calls))
+	require.NoError(t, err)
+
+	require.Equal(t, "It is sunny in Paris.", resp.Text)
+	require.Equal(t, []string{"Paris"}, calls)
+	require.Equal(t, 60, resp.Usage.InputTokens)
+	require.Equal(t, 18, resp.Usage.OutputTokens)
+
+	require.Len(t, bodies, 2)
+	var first struct {
+		Tools []struct {
+			Name        string         `json:"name"`
+			InputSchema map[string]any `json:"input_schema"`
+		} `json:"tools"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(bodies[0]), &first))
+	require.Len(t, first.Tools, 1)
+	require.Equal(t, "get_weather", first.Tools[0].Name)
+	require.Equal(t, []any{"city"}, first.Tools[0].InputSchema["required"])
+
+	require.Contains(t, bodies[1], `{"id":"toolu_1","input":{"city":"Paris"},"name":"get_weather","type":"tool_use"}`)
+	require.Contains(t, bodies[1], `"tool_use_id":"toolu_1"`)
+	require.Contains(t, bodies[1], "sunny in Paris")
+}
+
+func TestAnthropicRunToolLoopWithThinking(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(data))
+		w.Header().Set("Content-Type", "application/json")
+		if len(bodies) == 1 {
+			_, _ = fmt.Fprint(w, `{"id":"m1","type":"message","role":"assistant","model":"claude-sonnet-4-6","stop_reason":"tool_use",
+				"content":[{"type":"thinking","thinking":"I need the weather.","signature":"sig-1"},{"type":"redacted_thinking","data":"opaque"},
+				{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{"city":"Paris"}}],
+				"usage":{"input_tokens":20,"output_tokens":10}}`)
+			return
+		}
+		_, _ = fmt.Fprint(w, `{"id":"m2","type":"message","role":"assistant","model":"claude-sonnet-4-6","stop_reason":"end_turn",
+			"content":[{"type":"text","text":"It is sunny in Paris."}],"usage":{"input_tokens":40,"output_tokens":8}}`)
+	}))
+	defer server.Close()
+
+	var calls []string
+	p := NewAnthropic(ai.Config{Model: "claude-sonnet-4-6", APIKey: "key", APIURL: server.URL})
+	resp, err := ai.RunToolLoop(context.Background(), p, ai.Request{Prompt: "Weather in Paris?", ThinkingBudget: 2048}, weatherRegistry(t, &calls))
+	require.NoError(t, err)
+	require.Equal(t, "It is sunny in Paris.", resp.Text)
+	require.Len(t, bodies, 2)
+
+	// the tool_use turn is replayed with its thinking blocks ahead of the call
+	var second struct {
+		Messages []struct {
+			Role    string           `json:"role"`
+			Content []map[string]any `json:"content"`
+		} `json:"messages"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(bodies[1]), &second))
+	require.Len(t, second.Messages, 3)
+	assistant := second.Messages[1]
+	require.Equal(t, "assistant", assistant.Role)
+	require.Len(t, assistant.Content, 3)
+	require.Equal(t, map[string]any{"type": "thinking", "thinking": "I need the weather.", "signature": "sig-1"}, assistant.Content[0])
+	require.Equal(t, map[string]any{"type": "redacted_thinking", "data": "opaque"}, assistant.Content[1])
+	require.Equal(t, "tool_use", assistant.Content[2]["type"])
+}
+
+func TestGeminiRunToolLoop(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.True(t, strings.Contains(r.URL.Path, ":generateContent"), r.URL.Path)
+		data, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(data))
+		w.Header().Set("Content-Type", "application/json")
+		if len(bodies) == 1 {
+			_, _ = fmt.Fprint(w, `{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"get_weather","args":{"city":"Paris"}}}]}}],
+				"usageMetadata":{"promptTokenCount":20,"candidatesTokenCount":10}}`)
+			return
+		}
+		_, _ = fmt.Fprint(w, `{"candidates":[{"content":{"role":"model","parts":[{"text":"It is sunny in Paris."}]}}],
+			"usageMetadata":{"promptTokenCount":40,"candidatesTokenCount":8}}`)
+	}))
+	defer server.Close()
+
+	var calls []string
+	p := NewGemini(ai.Config{Model: "gemini-2.5-flash", APIKey: "key", APIURL: server.URL})
+	resp, err := ai.RunToolLoop(context.Background(), p, ai.Request{Prompt: "Weather in Paris?"}, weatherRegistry(t, &calls))
+	require.NoError(t, err)
+
+	require.Equal(t, "It is sunny in Paris.", resp.Text)
+	require.Equal(t, []string{"Paris"}, calls)
+	require.Equal(t, 60, resp.Usage.InputTokens)
+	require.Equal(t, 18, resp.Usage.OutputTokens)
+
+	require.Len(t, bodies, 2)
+	require.Contains(t, bodies[0], `"functionDeclarations"`)
+	require.Contains(t, bodies[0], `"get_weather"`)
+	require.Contains(t, bodies[1], `"functionCall"`)
+	require.Contains(t, bodies[1], `"functionResponse"`)
+	require.Contains(t, bodies[1], "sunny in Paris")
+}
+
+func TestRunToolLoopLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"id":"m","type":"message","role":"assistant","model":"claude-sonnet-4-6","stop_reason":"tool_use",
+			"content":[{"type":"tool_use","id":"toolu_1","name":"unknown","input":{}}],"usage":{"input_tokens":1,"output_tokens":1}}`)
+	}))
+	defer server.Close()
+
+	registry := ai.NewToolRegistry()
+	registry.MaxTurns = 2
+	p := NewAnthropic(ai.Config{Model: "claude-sonnet-4-6", APIKey: "key", APIURL: server.URL})
+	_, err := ai.RunToolLoop(context.Background(), p, ai.Request{Prompt: "loop"}, registry)
+	require.ErrorIs(t, err, ai.ErrToolLoopLimit)
+}
+
+func TestCLIProvidersRejectTools(t *testing.T) {
+	req := ai.Request{Prompt: "hi", Tools: []ai.Tool{{Name: "noop"}}}
+	for _, p := range []ai.Provider{NewClaudeCLI("sonnet"), NewCodexCLI(""), NewGeminiCLI("")} {
+		_, err := p.Execute(context.Background(), req)
+		require.ErrorIs(t, err, ai.ErrToolsNotSupported, p.GetBackend())
+	}
+}
@@ -0,0 +1,75 @@
+package ai
+
+import "fmt"
+
+// ReasoningEffort is a coarse thinking level for providers that take one
+// instead of a token budget.
+type ReasoningEffort string
+
+const (
+	EffortLow    ReasoningEffort = "low"
+	EffortMedium ReasoningEffort = "medium"
+	EffortHigh   ReasoningEffort = "high"
+)
+
+// effortBudgets maps each effort to the thinking budget sent to providers
+// that only take a budget.
+var effortBudgets = map[ReasoningEffort]int{
+	EffortLow:    2048,
+	EffortMedium: 8192,
+	EffortHigh:   24576,
+}
+
+func ParseReasoningEffort(s string) (ReasoningEffort, error) {
+	effort := ReasoningEffort(s)
+	if _, ok := effortBudgets[effort]; !ok && s != "" {
+		return "", fmt.Errorf("invalid reasoning effort %q (low, medium, high)", s)
+	}
+	return effort, nil
+}
+
+// WantsReasoning reports whether the request asks for a thinking budget or a
+// reasoning effort.
+func (r Request) WantsReasoning() bool {
+	return r.ThinkingBudget > 0 || r.ReasoningEffort != ""
+}
+
+// ThinkingTokens returns the thinking budget, derived from ReasoningEffort
+// when no explicit budget is set, or 0 when reasoning was not requested.
+func (r Request) ThinkingTokens() int {
+	if r.ThinkingBudget > 0 {
+		return r.ThinkingBudget
+	}
+	return effortBudgets[r.ReasoningEffort]
+}
+
+// Effort returns ReasoningEffort, derived from ThinkingBudget when no effort is
+// set, or "" when reasoning was not requested.
+func (r Request) Effort() ReasoningEffort {
+	if r.ReasoningEffort != "" || r.ThinkingBudget <= 0 {
+		return r.ReasoningEffort
+	}
+	switch {
+	case r.ThinkingBudget <= effortBudgets[EffortLow]:
+		return EffortLow
+	case r.ThinkingBudget <= effortBudgets[EffortMedium]:
+		return EffortMedium
+	default:
+		return EffortHigh
+	}
+}
+
+// CheckReasoning rejects a thinking budget or reasoning effort for models the
+// catalog marks as non-reasoning. Models missing from the catalog are allowed.
+func CheckReasoning(model string, req Request) error {
+	if !req.WantsReasoning() {
+		return nil
+	}
+	if _, err := ParseReasoningEffort(string(req.ReasoningEffort)); err != nil {
+		return err
+	}
+	if def, ok := LookupModel(model); ok && !def.Reasoning {
+		return fmt.Errorf("%w: %s", ErrReasoningNotSupported, model)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package ai
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReasoningTranslation(t *testing.T) {
+	tests := []struct {
+		req        Request
+		wantTokens int
+		wantEffort ReasoningEffort
+	}{
+		{req: Request{}, wantTokens: 0, wantEffort: ""},
+		{req: Request{ReasoningEffort: EffortMedium}, wantTokens: 8192, wantEffort: EffortMedium},
+		{req: Request{ThinkingBudget: 1000}, wantTokens: 1000, wantEffort: EffortLow},
+		{req: Request{ThinkingBudget: 5000}, wantTokens: 5000, wantEffort: EffortMedium},
+		{req: Request{ThinkingBudget: 30000}, wantTokens: 30000, wantEffort: EffortHigh},
+		{req: Request{ThinkingBudget: 4000, ReasoningEffort: EffortHigh}, wantTokens: 4000, wantEffort: EffortHigh},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.wantTokens, tt.req.ThinkingTokens(), "%+v", tt.req)
+		assert.Equal(t, tt.wantEffort, tt.req.Effort(), "%+v", tt.req)
+		assert.Equal(t, tt.wantTokens > 0, tt.req.WantsReasoning(), "%+v", tt.req)
+	}
+}
+
+func TestCheckReasoning(t *testing.T) {
+	tests := []struct {
+		name    string
+		model   string
+		req     Request
+		wantErr error
+	}{
+		{name: "no reasoning requested", model: "claude-3-5-haiku-20241022", req: Request{}},
+		{name: "reasoning model", model: "claude-sonnet-4-6", req: Request{ReasoningEffort: EffortHigh}},
+		{name: "model missing from the catalog", model: "my-local-model", req: Request{ThinkingBudget: 1024}},
+		{name: "non-reasoning model", model: "claude-3-5-haiku-20241022", req: Request{ThinkingBudget: 1024},
+			wantErr: ErrReasoningNotSupported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckReasoning(tt.model, tt.req)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+
+	err := CheckReasoning("claude-sonnet-4-6", Request{ReasoningEffort: "extreme"})
+	assert.ErrorContains(t, err, `invalid reasoning effort "extreme"`)
+}
@@ -0,0 +1,72 @@
+package session
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/flanksource/captain/pkg/ai"
+)
+
+type BudgetWindow string
+
+const (
+	Daily   BudgetWindow = "daily"
+	Weekly  BudgetWindow = "weekly"
+	Monthly BudgetWindow = "monthly"
+)
+
+// Start returns the start of the window containing t, in t's location. Weeks
+// start on Monday.
+func (w BudgetWindow) Start(t time.Time) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	switch w {
+	case Weekly:
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case Monthly:
+		return day.AddDate(0, 0, 1-day.Day())
+	}
+	return day
+}
+
+// Budget caps the ledger spend within a calendar window.
+type Budget struct {
+	Window   BudgetWindow
+	LimitUSD float64
+}
+
+// BudgetsFromConfig returns the window budgets set in cfg.
+func BudgetsFromConfig(cfg ai.Config) []Budget {
+	var budgets []Budget
+	for _, b := range []Budget{
+		{Window: Daily, LimitUSD: cfg.DailyBudgetUSD},
+		{Window: Weekly, LimitUSD: cfg.WeeklyBudgetUSD},
+		{Window: Monthly, LimitUSD: cfg.MonthlyBudgetUSD},
+	} {
+		if b.LimitUSD > 0 {
+			budgets = append(budgets, b)
+		}
+	}
+	return budgets
+}
+
+// CheckBudgets returns an error wrapping ai.ErrBudgetExceeded when the ledger
+// spend of the session's project has reached the limit of any of its budget
+// windows. Sessions without a project are checked against the spend of every
+// project. Processes sharing the ledger may each start one request before the
+// limit is seen, so a budget can be overshot by that much.
+func (s *Session) CheckBudgets(now time.Time) error {
+	if s.Ledger == nil {
+		return nil
+	}
+	for _, b := range s.Budgets {
+		spent, err := s.Ledger.Spent(s.ProjectName, b.Window.Start(now))
+		if err != nil {
+			return err
+		}
+		if spent >= b.LimitUSD {
+			return fmt.Errorf("%w: spent $%.4f of $%.4f %s budget",
+				ai.ErrBudgetExceeded, spent, b.LimitUSD, b.Window)
+		}
+	}
+	return nil
+}
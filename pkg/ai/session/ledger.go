@@ -0,0 +1,153 @@
+package session
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/flanksource/captain/pkg/ai"
+	_ "modernc.org/sqlite"
+)
+
+// DefaultLedgerPath returns ~/.local/share/captain/spend.db, honouring
+// XDG_DATA_HOME.
+func DefaultLedgerPath() string {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			home = os.TempDir()
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, "captain", "spend.db")
+}
+
+// Ledger persists every cost a Session records, so spend and budgets carry
+// across processes and days. It is a SQLite database in WAL mode; concurrent
+// processes append to it safely.
+type Ledger struct {
+	db   *sql.DB
+	path string
+}
+
+type LedgerEntry struct {
+	RecordedAt time.Time
+	SessionID  string
+	Project    string
+	Cost       ai.Cost
+}
+
+const ledgerSchema = `
+CREATE TABLE IF NOT EXISTS spend (
+	id                 INTEGER PRIMARY KEY AUTOINCREMENT,
+	recorded_at        INTEGER NOT NULL,
+	session_id         TEXT NOT NULL,
+	project            TEXT NOT NULL,
+	model              TEXT NOT NULL,
+	input_tokens       INTEGER NOT NULL,
+	output_tokens      INTEGER NOT NULL,
+	reasoning_tokens   INTEGER NOT NULL,
+	cache_read_tokens  INTEGER NOT NULL,
+	cache_write_tokens INTEGER NOT NULL,
+	total_tokens       INTEGER NOT NULL,
+	input_cost         REAL NOT NULL,
+	output_cost        REAL NOT NULL,
+	reasoning_cost     REAL NOT NULL,
+	cache_read_cost    REAL NOT NULL,
+	cache_write_cost   REAL NOT NULL,
+	total_cost         REAL NOT NULL
+);
+CREATE INDEX IF NOT EXISTS spend_recorded ON spend(recorded_at);
+CREATE INDEX IF NOT EXISTS spend_project ON spend(project, recorded_at);
+`
+
+// OpenLedger opens (creating if needed) the ledger database at path. An empty
+// path uses DefaultLedgerPath.
+func OpenLedger(path string) (*Ledger, error) {
+	if path == "" {
+		path = DefaultLedgerPath()
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create ledger directory: %w", err)
+	}
+
+	db, err := sql.Open("sqlite", SQLiteDSN(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ledger %s: %w", path, err)
+	}
+	if _, err := db.Exec(ledgerSchema); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to initialise ledger %s: %w", path, err)
+	}
+	return &Ledger{db: db, path: path}, nil
+}
+
+// SQLiteDSN is the URI of the SQLite database at path in WAL mode, for the
+// pure-Go "sqlite" driver. The path is escaped so names containing ? or #
+// open the right file.
+func SQLiteDSN(path string) string {
+	return "file:" + (&url.URL{Path: path}).EscapedPath() + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+}
+
+func (l *Ledger) Path() string { return l.path }
+func (l *Ledger) Close() error { return l.db.Close() }
+
+func (l *Ledger) Record(sessionID, project string, cost ai.Cost, at time.Time) error {
+	_, err := l.db.Exec(`INSERT INTO spend (recorded_at, session_id, project, model,
+		input_tokens, output_tokens, reasoning_tokens, cache_read_tokens, cache_write_tokens, total_tokens,
+		input_cost, output_cost, reasoning_cost, cache_read_cost, cache_write_cost, total_cost)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		at.UnixNano(), sessionID, project, cost.Model,
+		cost.InputTokens, cost.OutputTokens, cost.ReasoningTokens, cost.CacheReadTokens, cost.CacheWriteTokens, cost.TotalTokens,
+		cost.InputCost, cost.OutputCost, cost.ReasoningCost, cost.CacheReadCost, cost.CacheWriteCost, cost.Total())
+	if err != nil {
+		return fmt.Errorf("failed to record spend: %w", err)
+	}
+	return nil
+}
+
+// Spent returns the spend recorded for project at or after since. An empty
+// project sums every project.
+func (l *Ledger) Spent(project string, since time.Time) (float64, error) {
+	var total float64
+	err := l.db.QueryRow(`SELECT COALESCE(SUM(total_cost), 0) FROM spend
+		WHERE recorded_at >= ? AND (? = '' OR project = ?)`,
+		since.UnixNano(), project, project).Scan(&total)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read spend: %w", err)
+	}
+	return total, nil
+}
+
+// Entries returns the entries recorded for project at or after since, oldest
+// first. An empty project returns every project.
+func (l *Ledger) Entries(project string, since time.Time) ([]LedgerEntry, error) {
+	rows, err := l.db.Query(`SELECT recorded_at, session_id, project, model,
+		input_tokens, output_tokens, reasoning_tokens, cache_read_tokens, cache_write_tokens, total_tokens,
+		input_cost, output_cost, reasoning_cost, cache_read_cost, cache_write_cost
+		FROM spend WHERE recorded_at >= ? AND (? = '' OR project = ?) ORDER BY recorded_at`,
+		since.UnixNano(), project, project)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spend: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var entries []LedgerEntry
+	for rows.Next() {
+		var e LedgerEntry
+		var recorded int64
+		c := &e.Cost
+		if err := rows.Scan(&recorded, &e.SessionID, &e.Project, &c.Model,
+			&c.InputTokens, &c.OutputTokens, &c.ReasoningTokens, &c.CacheReadTokens, &c.CacheWriteTokens, &c.TotalTokens,
+			&c.InputCost, &c.OutputCost, &c.ReasoningCost, &c.CacheReadCost, &c.CacheWriteCost); err != nil {
+			return nil, fmt.Errorf("failed to read spend: %w", err)
+		}
+		e.RecordedAt = time.Unix(0, recorded)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
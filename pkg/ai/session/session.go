@@ -2,14 +2,19 @@ package session
 
 import (
 	"sync"
+	"time"
 
 	"github.com/flanksource/captain/pkg/ai"
+	"github.com/flanksource/commons/logger"
 )
 
 type Session struct {
 	ID          string
 	ProjectName string
 	Costs       ai.Costs
+	Batches     []Batch
+	Ledger      *Ledger  // nil = costs are only kept in memory
+	Budgets     []Budget // checked against Ledger
 	mu          sync.RWMutex
 }
 
@@ -20,10 +25,18 @@ func New(id, projectName string) *Session {
 	}
 }
 
+// AddCost records cost in memory and, when the session has a Ledger, on
+// disk under the session ID and project name.
 func (s *Session) AddCost(cost ai.Cost) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
 	s.Costs = append(s.Costs, cost)
+	s.mu.Unlock()
+
+	if s.Ledger != nil {
+		if err := s.Ledger.Record(s.ID, s.ProjectName, cost, time.Now()); err != nil {
+			logger.Warnf("%v", err)
+		}
+	}
 }
 
 func (s *Session) TotalCost() float64 {
@@ -39,3 +52,30 @@ func (s *Session) GetCosts() ai.Costs {
 	copy(result, s.Costs)
 	return result
 }
+
+// Batch is the cost total of one ai.ExecuteBatch call. Its requests are also
+// recorded individually in Costs.
+type Batch struct {
+	ID       string // provider batch ID, empty for local batches
+	Backend  ai.Backend
+	Model    string
+	Native   bool
+	Requests int
+	Failed   int
+	Duration time.Duration
+	Cost     ai.Cost
+}
+
+func (s *Session) AddBatch(batch Batch) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Batches = append(s.Batches, batch)
+}
+
+func (s *Session) GetBatches() []Batch {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]Batch, len(s.Batches))
+	copy(result, s.Batches)
+	return result
+}
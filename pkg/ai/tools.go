@@ -0,0 +1,103 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+const DefaultMaxToolTurns = 10
+
+// ToolHandler executes a tool call. The returned string is sent back to the
+// model as the tool result; an error is reported to the model as a failed
+// call rather than aborting the loop.
+type ToolHandler func(ctx context.Context, input json.RawMessage) (string, error)
+
+// ToolRegistry holds tool declarations together with the Go handlers that
+// implement them.
+type ToolRegistry struct {
+	tools    []Tool
+	handlers map[string]ToolHandler
+	MaxTurns int // 0 = DefaultMaxToolTurns
+}
+
+func NewToolRegistry() *ToolRegistry {
+	return &ToolRegistry{handlers: make(map[string]ToolHandler)}
+}
+
+// Register adds a tool, replacing any existing tool with the same name.
+func (r *ToolRegistry) Register(tool Tool, handler ToolHandler) {
+	if _, exists := r.handlers[tool.Name]; exists {
+		for i := range r.tools {
+			if r.tools[i].Name == tool.Name {
+				r.tools[i] = tool
+			}
+		}
+	} else {
+		r.tools = append(r.tools, tool)
+	}
+	r.handlers[tool.Name] = handler
+}
+
+func (r *ToolRegistry) Tools() []Tool {
+	tools := make([]Tool, len(r.tools))
+	copy(tools, r.tools)
+	return tools
+}
+
+// Call runs the handler for call and converts the outcome into a ToolResult.
+func (r *ToolRegistry) Call(ctx context.Context, call ToolCall) ToolResult {
+	result := ToolResult{CallID: call.ID, Name: call.Name}
+	handler, ok := r.handlers[call.Name]
+	if !ok {
+		result.Content = fmt.Sprintf("unknown tool %q", call.Name)
+		result.IsError = true
+		return result
+	}
+	output, err := handler(ctx, call.Input)
+	if err != nil {
+		result.Content = err.Error()
+		result.IsError = true
+		return result
+	}
+	result.Content = output
+	return result
+}
+
+// RunToolLoop executes req with the registry's tools, runs every tool call the
+// model makes and feeds the results back until the model replies without
+// calling a tool. The final response carries the usage of all turns.
+func RunToolLoop(ctx context.Context, p Provider, req Request, registry *ToolRegistry) (*Response, error) {
+	maxTurns := registry.MaxTurns
+	if maxTurns <= 0 {
+		maxTurns = DefaultMaxToolTurns
+	}
+
+	req.Tools = registry.Tools()
+	req.Messages = req.AllMessages()
+	req.Prompt = ""
+
+	var usage Usage
+	for range maxTurns {
+		resp, err := p.Execute(ctx, req)
+		if err != nil {
+			return resp, err
+		}
+		usage = usage.Add(resp.Usage)
+		if len(resp.ToolCalls) == 0 {
+			resp.Usage = usage
+			return resp, nil
+		}
+
+		results := make([]ToolResult, 0, len(resp.ToolCalls))
+		for _, call := range resp.ToolCalls {
+			if err := ctx.Err(); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrTimeout, err)
+			}
+			results = append(results, registry.Call(ctx, call))
+		}
+		req.Messages = append(req.Messages, resp.Message(), ToolResultMessage(results...))
+	}
+
+	return nil, fmt.Errorf("%w (%d)", ErrToolLoopLimit, maxTurns)
+}
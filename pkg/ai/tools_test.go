@@ -0,0 +1,85 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func weatherTools() *ToolRegistry {
+	registry := NewToolRegistry()
+	registry.Register(Tool{Name: "weather"}, func(ctx context.Context, input json.RawMessage) (string, error) {
+		var args struct {
+			City string `json:"city"`
+		}
+		if err := json.Unmarshal(input, &args); err != nil {
+			return "", err
+		}
+		if args.City == "" {
+			return "", errors.New("city is required")
+		}
+		return "sunny in " + args.City, nil
+	})
+	return registry
+}
+
+func TestRunToolLoop(t *testing.T) {
+	p := &scriptedProvider{replies: []*Response{
+		{
+			ToolCalls: []ToolCall{
+				{ID: "1", Name: "weather", Input: json.RawMessage(`{"city":"Paris"}`)},
+				{ID: "2", Name: "weather", Input: json.RawMessage(`{}`)},
+				{ID: "3", Name: "traffic", Input: json.RawMessage(`{}`)},
+			},
+			Usage: Usage{InputTokens: 10, OutputTokens: 5},
+		},
+		{Text: "It is sunny in Paris", Usage: Usage{InputTokens: 20, OutputTokens: 7}},
+	}}
+
+	resp, err := RunToolLoop(context.Background(), p, Request{Prompt: "Weather in Paris?"}, weatherTools())
+	require.NoError(t, err)
+	assert.Equal(t, "It is sunny in Paris", resp.Text)
+	assert.Equal(t, Usage{InputTokens: 30, OutputTokens: 12}, resp.Usage, "usage of every turn")
+
+	require.Len(t, p.requests, 2)
+	assert.Equal(t, []Tool{{Name: "weather"}}, p.requests[0].Tools)
+	followUp := p.requests[1].Messages
+	require.Len(t, followUp, 3)
+	assert.Equal(t, "Weather in Paris?", followUp[0].Text())
+	assert.Equal(t, RoleAssistant, followUp[1].Role)
+
+	var results []ToolResult
+	for _, block := range followUp[2].Content {
+		results = append(results, *block.ToolResult)
+	}
+	assert.Equal(t, []ToolResult{
+		{CallID: "1", Name: "weather", Content: "sunny in Paris"},
+		{CallID: "2", Name: "weather", Content: "city is required", IsError: true},
+		{CallID: "3", Name: "traffic", Content: `unknown tool "traffic"`, IsError: true},
+	}, results)
+}
+
+func TestRunToolLoopLimit(t *testing.T) {
+	call := &Response{ToolCalls: []ToolCall{{ID: "1", Name: "weather", Input: json.RawMessage(`{"city":"Paris"}`)}}}
+	p := &scriptedProvider{replies: []*Response{call, call, call}}
+	registry := weatherTools()
+	registry.MaxTurns = 2
+
+	_, err := RunToolLoop(context.Background(), p, Request{Prompt: "Weather?"}, registry)
+	require.ErrorIs(t, err, ErrToolLoopLimit)
+	assert.Len(t, p.requests, 2)
+}
+
+func TestToolRegistryRegisterReplaces(t *testing.T) {
+	registry := weatherTools()
+	registry.Register(Tool{Name: "weather", Description: "v2"}, func(ctx context.Context, input json.RawMessage) (string, error) {
+		return "rainy", nil
+	})
+
+	assert.Equal(t, []Tool{{Name: "weather", Description: "v2"}}, registry.Tools())
+	assert.Equal(t, "rainy", registry.Call(context.Background(), ToolCall{Name: "weather"}).Content)
+}
@@ -1,42 +1,189 @@
 package ai
 
 import (
+	"cmp"
+	"encoding/json"
 	"net/http"
 	"time"
 )
 
 type Request struct {
 	SystemPrompt     string
-	Prompt           string
+	Messages         []Message    // prior conversation turns, sent before Prompt
+	Prompt           string       // appended as the final user turn when non-empty
+	Attachments      []Attachment // sent with Prompt in the final user turn
 	MaxTokens        int
 	Temperature      float64
+	ThinkingBudget   int               // tokens the model may spend thinking, 0 = provider default
+	ReasoningEffort  ReasoningEffort   // low, medium or high; empty = provider default
 	StructuredOutput any               // nil = text mode, non-nil = JSON schema target
+	Tools            []Tool            // tools the model may call
 	Metadata         map[string]string // arbitrary caller metadata
 }
 
+// AllMessages returns the conversation to send: Messages followed by Prompt as
+// a user turn.
+func (r Request) AllMessages() []Message {
+	msgs := make([]Message, 0, len(r.Messages)+1)
+	msgs = append(msgs, r.Messages...)
+	if r.Prompt != "" || len(r.Attachments) > 0 {
+		msgs = append(msgs, AttachmentMessage(r.Prompt, r.Attachments...))
+	}
+	return msgs
+}
+
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleAssistant Role = "assistant"
+)
+
+type ContentKind string
+
+const (
+	ContentText       ContentKind = "text"
+	ContentToolUse    ContentKind = "tool_use"
+	ContentToolResult ContentKind = "tool_result"
+	ContentAttachment ContentKind = "attachment"
+	ContentThinking   ContentKind = "thinking"
+)
+
+type ContentBlock struct {
+	Kind       ContentKind
+	Text       string
+	ToolCall   *ToolCall   // when Kind == ContentToolUse
+	ToolResult *ToolResult // when Kind == ContentToolResult
+	Attachment *Attachment // when Kind == ContentAttachment
+	Thinking   *Thinking   // when Kind == ContentThinking
+}
+
+// Tool declares a function the model may call. InputSchema is the JSON schema
+// of the input object, e.g. from provider.GenerateJSONSchema.
+type Tool struct {
+	Name        string
+	Description string
+	InputSchema any
+}
+
+type ToolCall struct {
+	ID    string
+	Name  string
+	Input json.RawMessage
+}
+
+// Thinking is a reasoning block the backend signed. Anthropic requires it to
+// be sent back unchanged ahead of the tool calls it led to.
+type Thinking struct {
+	Text      string
+	Signature string
+	Redacted  string // encrypted reasoning of a redacted block, instead of Text
+}
+
+type ToolResult struct {
+	CallID  string
+	Name    string
+	Content string
+	IsError bool
+}
+
+type Message struct {
+	Role    Role
+	Content []ContentBlock
+}
+
+func UserMessage(text string) Message {
+	return Message{Role: RoleUser, Content: []ContentBlock{{Kind: ContentText, Text: text}}}
+}
+
+func AssistantMessage(text string) Message {
+	return Message{Role: RoleAssistant, Content: []ContentBlock{{Kind: ContentText, Text: text}}}
+}
+
+// ToolResultMessage returns a user turn answering the given tool calls.
+func ToolResultMessage(results ...ToolResult) Message {
+	msg := Message{Role: RoleUser}
+	for _, result := range results {
+		msg.Content = append(msg.Content, ContentBlock{Kind: ContentToolResult, ToolResult: &result})
+	}
+	return msg
+}
+
+// Text returns the concatenated text blocks of the message.
+func (m Message) Text() string {
+	var text string
+	for _, block := range m.Content {
+		if block.Kind == ContentText {
+			text += block.Text
+		}
+	}
+	return text
+}
+
 type Response struct {
 	Text           string
+	Thinking       string // reasoning text returned by the model, when exposed
 	StructuredData any
+	ToolCalls      []ToolCall // tools the model asked to call, in order
+	ThinkingBlocks []Thinking // signed reasoning to replay with the turn, in order
 	Model          string
 	Backend        Backend
 	Usage          Usage
 	Duration       time.Duration
 	CacheHit       bool
+	Attempts       []Attempt // failed attempts on other providers before this response
 	Raw            any
 }
 
+// Attempt records a provider that failed before a fallback answered.
+type Attempt struct {
+	Backend Backend
+	Model   string
+	Error   string
+}
+
+// Message returns the assistant turn for the response, including any
+// thinking blocks and tool calls, so it can be appended to a conversation.
+func (r Response) Message() Message {
+	msg := Message{Role: RoleAssistant}
+	for _, thinking := range r.ThinkingBlocks {
+		msg.Content = append(msg.Content, ContentBlock{Kind: ContentThinking, Thinking: &thinking})
+	}
+	if r.Text != "" {
+		msg.Content = append(msg.Content, ContentBlock{Kind: ContentText, Text: r.Text})
+	}
+	for _, call := range r.ToolCalls {
+		msg.Content = append(msg.Content, ContentBlock{Kind: ContentToolUse, ToolCall: &call})
+	}
+	return msg
+}
+
 type Usage struct {
-	InputTokens      int
-	OutputTokens     int
-	ReasoningTokens  int
-	CacheReadTokens  int
-	CacheWriteTokens int
+	InputTokens        int
+	OutputTokens       int
+	ReasoningTokens    int
+	CacheReadTokens    int
+	CacheWriteTokens   int
+	CacheWrite1hTokens int    // part of CacheWriteTokens written with a 1 hour TTL
+	ServiceTier        string // tier the backend served the request on, e.g. batch or priority
 }
 
 func (u Usage) TotalTokens() int {
 	return u.InputTokens + u.OutputTokens + u.ReasoningTokens + u.CacheReadTokens + u.CacheWriteTokens
 }
 
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		InputTokens:        u.InputTokens + other.InputTokens,
+		OutputTokens:       u.OutputTokens + other.OutputTokens,
+		ReasoningTokens:    u.ReasoningTokens + other.ReasoningTokens,
+		CacheReadTokens:    u.CacheReadTokens + other.CacheReadTokens,
+		CacheWriteTokens:   u.CacheWriteTokens + other.CacheWriteTokens,
+		CacheWrite1hTokens: u.CacheWrite1hTokens + other.CacheWrite1hTokens,
+		ServiceTier:        cmp.Or(other.ServiceTier, u.ServiceTier),
+	}
+}
+
 type EventKind string
 
 const (
@@ -61,25 +208,41 @@ type Event struct {
 	Error     string // when Kind == EventError
 }
 
+// Cost prices each line of a response's usage. Token counts are disjoint:
+// InputTokens excludes cached input and OutputTokens excludes reasoning.
 type Cost struct {
-	Model        string
-	InputTokens  int
-	OutputTokens int
-	TotalTokens  int
-	InputCost    float64
-	OutputCost   float64
+	Model            string
+	InputTokens      int
+	OutputTokens     int
+	ReasoningTokens  int
+	CacheReadTokens  int
+	CacheWriteTokens int
+	TotalTokens      int
+	InputCost        float64
+	OutputCost       float64
+	ReasoningCost    float64
+	CacheReadCost    float64
+	CacheWriteCost   float64
 }
 
-func (c Cost) Total() float64 { return c.InputCost + c.OutputCost }
+func (c Cost) Total() float64 {
+	return c.InputCost + c.OutputCost + c.ReasoningCost + c.CacheReadCost + c.CacheWriteCost
+}
 
 func (c Cost) Add(other Cost) Cost {
 	return Cost{
-		Model:        c.Model,
-		InputTokens:  c.InputTokens + other.InputTokens,
-		OutputTokens: c.OutputTokens + other.OutputTokens,
-		TotalTokens:  c.TotalTokens + other.TotalTokens,
-		InputCost:    c.InputCost + other.InputCost,
-		OutputCost:   c.OutputCost + other.OutputCost,
+		Model:            c.Model,
+		InputTokens:      c.InputTokens + other.InputTokens,
+		OutputTokens:     c.OutputTokens + other.OutputTokens,
+		ReasoningTokens:  c.ReasoningTokens + other.ReasoningTokens,
+		CacheReadTokens:  c.CacheReadTokens + other.CacheReadTokens,
+		CacheWriteTokens: c.CacheWriteTokens + other.CacheWriteTokens,
+		TotalTokens:      c.TotalTokens + other.TotalTokens,
+		InputCost:        c.InputCost + other.InputCost,
+		OutputCost:       c.OutputCost + other.OutputCost,
+		ReasoningCost:    c.ReasoningCost + other.ReasoningCost,
+		CacheReadCost:    c.CacheReadCost + other.CacheReadCost,
+		CacheWriteCost:   c.CacheWriteCost + other.CacheWriteCost,
 	}
 }
 
@@ -103,18 +266,26 @@ func (c Costs) ByModel() map[string]Cost {
 
 type Config struct {
 	Model         string
-	Backend       Backend       // empty = infer from model
-	APIKey        string        // empty = env lookup
+	Backend       Backend // empty = infer from model
+	APIKey        string  // empty = env lookup
 	APIURL        string
-	HTTPClient    *http.Client  // nil = default client
+	HTTPClient    *http.Client // nil = default client
 	MaxTokens     int
 	Temperature   float64
-	CacheDBPath   string
-	CacheTTL      time.Duration
+	CacheDBPath   string        // empty = no persistent cache
+	CacheTTL      time.Duration // 0 = entries never expire
+	CacheMaxSize  int64         // bytes, 0 = middleware.DefaultCacheMaxSize
 	NoCache       bool
 	MaxConcurrent int
+	SchemaRepairs int // repair turns for invalid structured output, 0 = middleware.DefaultSchemaRepairs, -1 = none
 	Debug         bool
 	SessionID     string
 	ProjectName   string
-	BudgetUSD     float64 // 0 = no budget
+	BudgetUSD     float64 // per process, 0 = no budget
+	LedgerPath    string  // empty = spend is not persisted
+	// calendar window budgets checked against the ledger spend of ProjectName,
+	// 0 = no budget
+	DailyBudgetUSD   float64
+	WeeklyBudgetUSD  float64
+	MonthlyBudgetUSD float64
 }
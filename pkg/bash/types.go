@@ -60,6 +60,9 @@ type PathClassification struct {
 type HookInput struct {
 	SessionID      string          `json:"session_id"`
 	TranscriptPath string          `json:"transcript_path,omitempty"`
+	CWD            string          `json:"cwd,omitempty"`
+	HookEventName  string          `json:"hook_event_name,omitempty"`
+	PermissionMode string          `json:"permission_mode,omitempty"`
 	ToolName       string          `json:"tool_name,omitempty"`
 	ToolInput      json.RawMessage `json:"tool_input,omitempty"`
 	ToolOutput     json.RawMessage `json:"tool_output,omitempty"`
@@ -74,8 +77,10 @@ type HookOutput struct {
 
 // HookSpecificOutput contains permission-related hook results
 type HookSpecificOutput struct {
-	PermissionDecision string `json:"permissionDecision,omitempty"`
-	Reason             string `json:"reason,omitempty"`
+	HookEventName            string `json:"hookEventName,omitempty"`
+	PermissionDecision       string `json:"permissionDecision,omitempty"`
+	PermissionDecisionReason string `json:"permissionDecisionReason,omitempty"`
+	Reason                   string `json:"reason,omitempty"`
 }
 
 // BashToolInput represents the input for Bash tool
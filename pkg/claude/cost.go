@@ -1,6 +1,11 @@
 package claude
 
-import "strings"
+import (
+	"slices"
+	"strings"
+
+	"github.com/flanksource/captain/pkg/ai/pricing"
+)
 
 type ModelFamily string
 
@@ -11,36 +16,6 @@ const (
 	ModelFamilyUnknown ModelFamily = "unknown"
 )
 
-type ModelPricing struct {
-	InputPerMTok      float64
-	OutputPerMTok     float64
-	CacheWritePerMTok float64
-	CacheReadPerMTok  float64
-}
-
-// PricingTable maps model families to their per-million-token pricing in USD.
-// Source: https://docs.anthropic.com/en/docs/about-claude/models
-var PricingTable = map[ModelFamily]ModelPricing{
-	ModelFamilyOpus4: {
-		InputPerMTok:      15.0,
-		OutputPerMTok:     75.0,
-		CacheWritePerMTok: 18.75,
-		CacheReadPerMTok:  1.50,
-	},
-	ModelFamilySonnet4: {
-		InputPerMTok:      3.0,
-		OutputPerMTok:     15.0,
-		CacheWritePerMTok: 3.75,
-		CacheReadPerMTok:  0.30,
-	},
-	ModelFamilyHaiku4: {
-		InputPerMTok:      0.80,
-		OutputPerMTok:     4.0,
-		CacheWritePerMTok: 1.0,
-		CacheReadPerMTok:  0.08,
-	},
-}
-
 func ClassifyModel(model string) ModelFamily {
 	m := strings.ToLower(model)
 	switch {
@@ -55,41 +30,169 @@ func ClassifyModel(model string) ModelFamily {
 	}
 }
 
-func CalculateCost(usage *Usage, model string) float64 {
+// Pricing confidence of a TokenSummary that has messages which could not be
+// priced, in addition to pricing.ConfidenceExact and ConfidenceAlias.
+const (
+	ConfidencePartial  = "partial"
+	ConfidenceUnpriced = "unpriced"
+)
+
+// MessageCost is the price of a single message.
+type MessageCost struct {
+	Cost       float64
+	PricingID  string // registry ID, empty when the model has no pricing
+	Source     string // pricing source of the registry entry
+	Confidence string // pricing.ConfidenceExact or ConfidenceAlias
+}
+
+func (c MessageCost) Priced() bool { return c.PricingID != "" }
+
+// PriceMessage prices a single message with the shared pricing registry, at
+// the long-context, cache TTL and service tier (batch, priority) rates
+// recorded in its usage.
+func PriceMessage(usage *Usage, model string) MessageCost {
 	if usage == nil {
-		return 0
+		return MessageCost{}
 	}
-	family := ClassifyModel(model)
-	pricing, ok := PricingTable[family]
+	return priceUsage(usage.pricingUsage(), model)
+}
+
+func priceUsage(usage pricing.Usage, model string) MessageCost {
+	match, ok := pricing.Resolve("", model)
 	if !ok {
-		pricing = PricingTable[ModelFamilySonnet4]
+		return MessageCost{}
+	}
+	return MessageCost{
+		Cost:       match.Info.Cost(usage).TotalCost,
+		PricingID:  match.ID,
+		Source:     match.Info.Source,
+		Confidence: match.Confidence,
+	}
+}
+
+// CalculateCost prices a single message, returning 0 for models without
+// pricing.
+func CalculateCost(usage *Usage, model string) float64 {
+	return PriceMessage(usage, model).Cost
+}
+
+func (u *Usage) pricingUsage() pricing.Usage {
+	result := pricing.Usage{
+		InputTokens:      u.InputTokens,
+		OutputTokens:     u.OutputTokens,
+		CacheReadTokens:  u.CacheReadInputTokens,
+		CacheWriteTokens: u.CacheCreationInputTokens,
+		ServiceTier:      u.ServiceTier,
 	}
-	return float64(usage.InputTokens)*pricing.InputPerMTok/1e6 +
-		float64(usage.OutputTokens)*pricing.OutputPerMTok/1e6 +
-		float64(usage.CacheCreationInputTokens)*pricing.CacheWritePerMTok/1e6 +
-		float64(usage.CacheReadInputTokens)*pricing.CacheReadPerMTok/1e6
+	if u.CacheCreation != nil {
+		result.CacheWrite1hTokens = u.CacheCreation.Ephemeral1hInputTokens
+	}
+	return result
 }
 
 // TokenSummary aggregates token counts and cost across multiple messages.
 type TokenSummary struct {
-	InputTokens       int     `json:"inputTokens" pretty:"label=Input"`
-	OutputTokens      int     `json:"outputTokens" pretty:"label=Output"`
-	CacheWriteTokens  int     `json:"cacheWriteTokens" pretty:"label=Cache Write"`
-	CacheReadTokens   int     `json:"cacheReadTokens" pretty:"label=Cache Read"`
-	TotalCost         float64 `json:"totalCost"`
+	InputTokens      int     `json:"inputTokens" pretty:"label=Input"`
+	OutputTokens     int     `json:"outputTokens" pretty:"label=Output"`
+	CacheWriteTokens int     `json:"cacheWriteTokens" pretty:"label=Cache Write"`
+	CacheReadTokens  int     `json:"cacheReadTokens" pretty:"label=Cache Read"`
+	TotalCost        float64 `json:"totalCost"`
+	// PricingSource is the source that priced the messages, or "mixed".
+	PricingSource string `json:"pricingSource,omitempty" pretty:"label=Pricing Source"`
+	// Confidence is the lowest confidence of the priced messages.
+	Confidence       string   `json:"confidence,omitempty" pretty:"label=Confidence"`
+	UnpricedMessages int      `json:"unpricedMessages,omitempty"`
+	UnpricedModels   []string `json:"unpricedModels,omitempty"`
 }
 
 func (s *TokenSummary) Add(usage *Usage, model string) {
 	if usage == nil {
 		return
 	}
+	s.AddUsage(usage.pricingUsage(), model)
+}
+
+// AddUsage adds the usage of a single message of any agent, priced with the
+// shared pricing registry. Reasoning tokens are counted as output.
+func (s *TokenSummary) AddUsage(usage pricing.Usage, model string) {
 	s.InputTokens += usage.InputTokens
-	s.OutputTokens += usage.OutputTokens
-	s.CacheWriteTokens += usage.CacheCreationInputTokens
-	s.CacheReadTokens += usage.CacheReadInputTokens
-	s.TotalCost += CalculateCost(usage, model)
+	s.OutputTokens += usage.OutputTokens + usage.ReasoningTokens
+	s.CacheWriteTokens += usage.CacheWriteTokens
+	s.CacheReadTokens += usage.CacheReadTokens
+	if usage.PromptTokens()+usage.OutputTokens+usage.ReasoningTokens == 0 {
+		// synthetic messages written by the agent itself cost nothing
+		return
+	}
+
+	cost := priceUsage(usage, model)
+	if !cost.Priced() {
+		s.UnpricedMessages++
+		s.UnpricedModels = addModel(s.UnpricedModels, model)
+		return
+	}
+	s.TotalCost += cost.Cost
+	s.PricingSource = mergeSource(s.PricingSource, cost.Source)
+	s.Confidence = lowerConfidence(s.Confidence, cost.Confidence)
+}
+
+// Merge adds the tokens, cost and pricing coverage of other to s.
+func (s *TokenSummary) Merge(other TokenSummary) {
+	s.InputTokens += other.InputTokens
+	s.OutputTokens += other.OutputTokens
+	s.CacheWriteTokens += other.CacheWriteTokens
+	s.CacheReadTokens += other.CacheReadTokens
+	s.TotalCost += other.TotalCost
+	s.UnpricedMessages += other.UnpricedMessages
+	for _, model := range other.UnpricedModels {
+		s.UnpricedModels = addModel(s.UnpricedModels, model)
+	}
+	if other.PricingSource != "" {
+		s.PricingSource = mergeSource(s.PricingSource, other.PricingSource)
+	}
+	if other.Confidence != "" {
+		s.Confidence = lowerConfidence(s.Confidence, other.Confidence)
+	}
+}
+
+// Coverage returns Confidence, or partial/unpriced when some or all of the
+// messages could not be priced.
+func (s *TokenSummary) Coverage() string {
+	switch {
+	case s.UnpricedMessages == 0:
+		return s.Confidence
+	case s.Confidence == "":
+		return ConfidenceUnpriced
+	default:
+		return ConfidencePartial
+	}
 }
 
 func (s *TokenSummary) TotalTokens() int {
 	return s.InputTokens + s.OutputTokens + s.CacheWriteTokens + s.CacheReadTokens
 }
+
+func mergeSource(a, b string) string {
+	if a == "" || a == b {
+		return b
+	}
+	return "mixed"
+}
+
+func lowerConfidence(a, b string) string {
+	if a == "" || b == pricing.ConfidenceAlias {
+		return b
+	}
+	return a
+}
+
+func addModel(models []string, model string) []string {
+	if model == "" {
+		model = "(unknown)"
+	}
+	if slices.Contains(models, model) {
+		return models
+	}
+	models = append(models, model)
+	slices.Sort(models)
+	return models
+}
@@ -0,0 +1,266 @@
+package claude
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/flanksource/captain/pkg/ai/history"
+	"github.com/flanksource/captain/pkg/ai/pricing"
+	"github.com/flanksource/commons/logger"
+)
+
+// Agents whose session logs ParseCosts reads.
+const (
+	AgentClaude = "claude"
+	AgentCodex  = "codex"
+	AgentGemini = "gemini"
+)
+
+// ParseCosts aggregates the token usage and cost of Claude Code, Codex and
+// Gemini CLI sessions. Unless searchAll is set, only sessions of the project
+// containing currentDir are included.
+func ParseCosts(currentDir string, searchAll bool, since *time.Time) ([]SessionCost, error) {
+	result, err := parseClaudeCosts(currentDir, searchAll, since)
+	if err != nil {
+		return nil, err
+	}
+
+	// Gemini files chats under a hash of the project directory, so name the
+	// projects the other agents worked in
+	projects := projectNames{}
+	projects.add(currentDir)
+
+	codex, err := parseCodexCosts(currentDir, searchAll, since, projects)
+	if err != nil {
+		logger.Warnf("Failed to read codex sessions: %v", err)
+	}
+	result = append(result, codex...)
+
+	gemini, err := parseGeminiCosts(currentDir, searchAll, since, projects)
+	if err != nil {
+		logger.Warnf("Failed to read gemini sessions: %v", err)
+	}
+	return append(result, gemini...), nil
+}
+
+func parseCodexCosts(currentDir string, searchAll bool, since *time.Time, projects projectNames) ([]SessionCost, error) {
+	files, err := history.FindCodexSessionFiles()
+	if err != nil {
+		return nil, err
+	}
+	currentRoot := FindProjectRoot(currentDir)
+
+	var result []SessionCost
+	for _, file := range files {
+		if since != nil {
+			if info, err := os.Stat(file); err == nil && info.ModTime().Before(*since) {
+				continue
+			}
+		}
+		sc, cwd, err := readCodexCost(file, since)
+		if err != nil {
+			logger.Debugf("Error reading codex session %s: %v", file, err)
+			continue
+		}
+		if sc == nil {
+			continue
+		}
+		root := FindProjectRoot(cwd)
+		if !searchAll && currentDir != "" && root != currentRoot {
+			continue
+		}
+		sc.Project = projects.add(cwd)
+		result = append(result, *sc)
+	}
+	return result, nil
+}
+
+// readCodexCost sums the token_count events of a codex rollout file. Each
+// event carries the running session total, so usage is the growth of that
+// total; the first event of a resumed session counts only its last turn.
+func readCodexCost(path string, since *time.Time) (*SessionCost, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() { _ = file.Close() }()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+
+	var (
+		sc    *SessionCost
+		id    string
+		cwd   string
+		model string
+		prev  *history.CodexTokenUsage
+	)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		event, err := history.ParseCodexLine(line)
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case event.Type == "session_meta":
+			id, cwd = event.Payload.ID, event.Payload.CWD
+		case event.Type == "turn_context" && event.Payload.Model != "":
+			model = event.Payload.Model
+		case event.Type == "event_msg" && event.Payload.Type == "token_count" && event.Payload.Info != nil:
+			total := event.Payload.Info.TotalTokenUsage
+			usage := event.Payload.Info.LastTokenUsage
+			if prev != nil {
+				if total.TotalTokens == prev.TotalTokens {
+					// repeated for rate limit updates
+					continue
+				}
+				if total.TotalTokens > prev.TotalTokens {
+					usage = subCodexUsage(total, *prev)
+				}
+			}
+			prev = &total
+
+			ts := event.Time()
+			if ts == nil || (since != nil && ts.Before(*since)) {
+				continue
+			}
+			if sc == nil {
+				sc = &SessionCost{SessionID: id, Agent: AgentCodex, Start: *ts, End: *ts}
+			}
+			if ts.Before(sc.Start) {
+				sc.Start = *ts
+			}
+			if ts.After(sc.End) {
+				sc.End = *ts
+			}
+			sc.Model = model
+			sc.addUsage(*ts, usage.PricingUsage(), model)
+		}
+	}
+	return sc, cwd, scanner.Err()
+}
+
+func subCodexUsage(a, b history.CodexTokenUsage) history.CodexTokenUsage {
+	return history.CodexTokenUsage{
+		InputTokens:           a.InputTokens - b.InputTokens,
+		CachedInputTokens:     a.CachedInputTokens - b.CachedInputTokens,
+		OutputTokens:          a.OutputTokens - b.OutputTokens,
+		ReasoningOutputTokens: a.ReasoningOutputTokens - b.ReasoningOutputTokens,
+		TotalTokens:           a.TotalTokens - b.TotalTokens,
+	}
+}
+
+func parseGeminiCosts(currentDir string, searchAll bool, since *time.Time, projects projectNames) ([]SessionCost, error) {
+	var files []string
+	if searchAll || currentDir == "" {
+		all, err := history.FindGeminiSessionFiles("")
+		if err != nil {
+			return nil, err
+		}
+		files = all
+	} else {
+		seen := map[string]bool{}
+		for _, dir := range []string{currentDir, FindProjectRoot(currentDir)} {
+			hash := history.GeminiProjectHash(dir)
+			if seen[hash] {
+				continue
+			}
+			seen[hash] = true
+			matches, err := history.FindGeminiSessionFiles(hash)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, matches...)
+		}
+	}
+
+	var result []SessionCost
+	for _, file := range files {
+		session, err := history.ReadGeminiSession(file)
+		if err != nil {
+			logger.Debugf("Error reading gemini session %s: %v", file, err)
+			continue
+		}
+		if sc := geminiCost(session, since, projects); sc != nil {
+			result = append(result, *sc)
+		}
+	}
+	return result, nil
+}
+
+func geminiCost(session *history.GeminiSession, since *time.Time, projects projectNames) *SessionCost {
+	var sc *SessionCost
+	for _, msg := range session.Messages {
+		if msg.Type != "gemini" || msg.Tokens == nil {
+			continue
+		}
+		ts := msg.Time()
+		if ts == nil || (since != nil && ts.Before(*since)) {
+			continue
+		}
+		if sc == nil {
+			sc = &SessionCost{
+				SessionID: session.SessionID,
+				Agent:     AgentGemini,
+				Project:   projects.name(session.ProjectHash),
+				Start:     *ts,
+				End:       *ts,
+			}
+		}
+		if ts.Before(sc.Start) {
+			sc.Start = *ts
+		}
+		if ts.After(sc.End) {
+			sc.End = *ts
+		}
+		if msg.Model != "" {
+			sc.Model = msg.Model
+		}
+		sc.addUsage(*ts, geminiUsage(*msg.Tokens), msg.Model)
+	}
+	return sc
+}
+
+// geminiUsage splits cached tokens out of the prompt count, which includes
+// them, and bills tool use prompts as input and thoughts as output.
+func geminiUsage(t history.GeminiTokens) pricing.Usage {
+	return pricing.Usage{
+		InputTokens:     t.Input - t.Cached + t.Tool,
+		OutputTokens:    t.Output,
+		ReasoningTokens: t.Thoughts,
+		CacheReadTokens: t.Cached,
+	}
+}
+
+// projectNames maps the Gemini project hash of a directory to the name of the
+// project containing it.
+type projectNames map[string]string
+
+// add records dir and its project root, returning the project name.
+func (p projectNames) add(dir string) string {
+	if dir == "" {
+		return ""
+	}
+	root := FindProjectRoot(dir)
+	name := filepath.Base(root)
+	p[history.GeminiProjectHash(dir)] = name
+	p[history.GeminiProjectHash(root)] = name
+	return name
+}
+
+func (p projectNames) name(hash string) string {
+	if name, ok := p[hash]; ok {
+		return name
+	}
+	if len(hash) > 8 {
+		hash = hash[:8]
+	}
+	return "gemini-" + hash
+}
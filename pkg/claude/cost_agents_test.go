@@ -0,0 +1,87 @@
+package claude
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flanksource/captain/pkg/ai/history"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, path string, lines ...string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644))
+}
+
+func TestParseCostsAcrossAgents(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	project := filepath.Join(home, "src", "captain")
+	require.NoError(t, os.MkdirAll(filepath.Join(project, ".git"), 0o755))
+
+	writeFile(t, filepath.Join(home, ".claude", "projects", NormalizePath(project), "s1.jsonl"),
+		`{"type":"assistant","sessionId":"s1","timestamp":"2026-10-16T10:00:00Z","message":{"role":"assistant","model":"claude-sonnet-4-6","usage":{"input_tokens":100000,"output_tokens":10000}}}`)
+
+	// token_count events carry the running total; the repeat is a rate limit update
+	writeFile(t, filepath.Join(home, ".codex", "sessions", "2026", "10", "16", "rollout-c1.jsonl"),
+		`{"timestamp":"2026-10-16T11:00:00Z","type":"session_meta","payload":{"id":"c1","cwd":"`+project+`"}}`,
+		`{"timestamp":"2026-10-16T11:00:01Z","type":"turn_context","payload":{"model":"gpt-5"}}`,
+		`{"timestamp":"2026-10-16T11:00:02Z","type":"event_msg","payload":{"type":"token_count","info":{"total_token_usage":{"input_tokens":100000,"cached_input_tokens":40000,"output_tokens":10000,"reasoning_output_tokens":4000,"total_tokens":110000},"last_token_usage":{"input_tokens":100000,"cached_input_tokens":40000,"output_tokens":10000,"reasoning_output_tokens":4000,"total_tokens":110000}}}}`,
+		`{"timestamp":"2026-10-16T11:00:03Z","type":"event_msg","payload":{"type":"token_count","info":{"total_token_usage":{"input_tokens":100000,"cached_input_tokens":40000,"output_tokens":10000,"reasoning_output_tokens":4000,"total_tokens":110000},"last_token_usage":{"input_tokens":100000,"cached_input_tokens":40000,"output_tokens":10000,"reasoning_output_tokens":4000,"total_tokens":110000}}}}`,
+		`{"timestamp":"2026-10-16T11:05:00Z","type":"event_msg","payload":{"type":"token_count","info":{"total_token_usage":{"input_tokens":300000,"cached_input_tokens":140000,"output_tokens":30000,"reasoning_output_tokens":4000,"total_tokens":330000},"last_token_usage":{"input_tokens":200000,"cached_input_tokens":100000,"output_tokens":20000,"reasoning_output_tokens":0,"total_tokens":220000}}}}`)
+
+	writeFile(t, filepath.Join(home, ".gemini", "tmp", history.GeminiProjectHash(project), "chats", "session-2026-10-16T12-00-g1.json"),
+		`{"sessionId":"g1","projectHash":"`+history.GeminiProjectHash(project)+`","messages":[`+
+			`{"id":"1","timestamp":"2026-10-16T12:00:00Z","type":"user","content":"hi"},`+
+			`{"id":"2","timestamp":"2026-10-16T12:00:05Z","type":"gemini","model":"gemini-2.5-flash","tokens":{"input":100000,"output":10000,"cached":20000,"thoughts":5000,"tool":0,"total":115000}}`+
+			`]}`)
+
+	since := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	sessions, err := ParseCosts(project, false, &since)
+	require.NoError(t, err)
+	require.Len(t, sessions, 3)
+
+	byAgent := map[string]SessionCost{}
+	for _, s := range sessions {
+		byAgent[s.Agent] = s
+		assert.Equal(t, "captain", s.Project, s.Agent)
+	}
+
+	claude := byAgent[AgentClaude]
+	assert.Equal(t, "s1", claude.SessionID)
+	assert.InDelta(t, 0.3+0.15, claude.Tokens.TotalCost, 1e-9)
+
+	codex := byAgent[AgentCodex]
+	assert.Equal(t, "c1", codex.SessionID)
+	assert.Equal(t, "gpt-5", codex.Model)
+	assert.Equal(t, 2, codex.Messages)
+	assert.Equal(t, 160000, codex.Tokens.InputTokens)
+	assert.Equal(t, 140000, codex.Tokens.CacheReadTokens)
+	assert.Equal(t, 30000, codex.Tokens.OutputTokens)
+	// 160k * $1.25 + 140k * $0.125 + 30k * $10
+	assert.InDelta(t, 0.2+0.0175+0.3, codex.Tokens.TotalCost, 1e-9)
+
+	gemini := byAgent[AgentGemini]
+	assert.Equal(t, "g1", gemini.SessionID)
+	assert.Equal(t, "gemini-2.5-flash", gemini.Model)
+	assert.Equal(t, 80000, gemini.Tokens.InputTokens)
+	assert.Equal(t, 20000, gemini.Tokens.CacheReadTokens)
+	assert.Equal(t, 15000, gemini.Tokens.OutputTokens)
+	assert.Equal(t, "exact", gemini.Tokens.Coverage())
+
+	// sessions of other projects are left out unless searching all
+	other := filepath.Join(home, "src", "other")
+	require.NoError(t, os.MkdirAll(filepath.Join(other, ".git"), 0o755))
+	sessions, err = ParseCosts(other, false, &since)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+
+	sessions, err = ParseCosts(other, true, &since)
+	require.NoError(t, err)
+	assert.Len(t, sessions, 3)
+}
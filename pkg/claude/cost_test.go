@@ -1,11 +1,19 @@
 package claude
 
 import (
+	"os"
 	"testing"
 
+	"github.com/flanksource/captain/pkg/ai/pricing"
 	"github.com/stretchr/testify/assert"
 )
 
+func TestMain(m *testing.M) {
+	// price with the embedded snapshot only, so results do not follow live prices
+	pricing.SetSources(&pricing.SnapshotSource{})
+	os.Exit(m.Run())
+}
+
 func TestClassifyModel(t *testing.T) {
 	tests := []struct {
 		model    string
@@ -41,16 +49,37 @@ func TestCalculateCost(t *testing.T) {
 			expected: 0,
 		},
 		{
-			name: "opus 1M input + 1M output",
+			name: "opus 4.1 1M input + 1M output",
 			usage: &Usage{
 				InputTokens:  1_000_000,
 				OutputTokens: 1_000_000,
 			},
-			model:    "claude-opus-4-6",
+			model:    "claude-opus-4-1-20250805",
 			expected: 15.0 + 75.0, // $90
 		},
+		{
+			name: "opus 4.6 is priced by its exact ID",
+			usage: &Usage{
+				InputTokens:  100_000,
+				OutputTokens: 100_000,
+			},
+			model:    "claude-opus-4-6",
+			expected: 0.5 + 2.5, // $5/$25, not the $15/$75 of older Opus models
+		},
 		{
 			name: "sonnet with cache",
+			usage: &Usage{
+				InputTokens:              50_000,
+				OutputTokens:             10_000,
+				CacheCreationInputTokens: 20_000,
+				CacheReadInputTokens:     30_000,
+			},
+			model: "claude-sonnet-4-6",
+			// 50k * 3.0 + 10k * 15.0 + 20k * 3.75 + 30k * 0.30
+			expected: 0.15 + 0.15 + 0.075 + 0.009,
+		},
+		{
+			name: "sonnet long context with cache",
 			usage: &Usage{
 				InputTokens:              500_000,
 				OutputTokens:             100_000,
@@ -58,8 +87,30 @@ func TestCalculateCost(t *testing.T) {
 				CacheReadInputTokens:     300_000,
 			},
 			model: "claude-sonnet-4-6",
-			// 0.5M * 3.0 + 0.1M * 15.0 + 0.2M * 3.75 + 0.3M * 0.30
-			expected: 1.5 + 1.5 + 0.75 + 0.09,
+			// a 1M token prompt exceeds 200k, so every line is at the long-context rate:
+			// 0.5M * 6.0 + 0.1M * 22.5 + 0.2M * 7.5 + 0.3M * 0.60
+			expected: 3.0 + 2.25 + 1.5 + 0.18,
+		},
+		{
+			name: "sonnet 1h cache writes",
+			usage: &Usage{
+				InputTokens:              10_000,
+				CacheCreationInputTokens: 100_000,
+				CacheCreation:            &CacheCreation{Ephemeral5mInputTokens: 40_000, Ephemeral1hInputTokens: 60_000},
+			},
+			model: "claude-sonnet-4-6",
+			// 10k * 3.0 + 40k * 3.75 + 60k * 6.0
+			expected: 0.03 + 0.15 + 0.36,
+		},
+		{
+			name: "batch tier is half price",
+			usage: &Usage{
+				InputTokens:  1_000_000,
+				OutputTokens: 1_000_000,
+				ServiceTier:  "batch",
+			},
+			model:    "claude-opus-4-1",
+			expected: (15.0 + 75.0) / 2,
 		},
 		{
 			name: "haiku basic",
@@ -68,16 +119,16 @@ func TestCalculateCost(t *testing.T) {
 				OutputTokens: 50_000,
 			},
 			model:    "claude-haiku-4-5-20251001",
-			expected: 0.08 + 0.20, // $0.28
+			expected: 0.10 + 0.25, // $0.35
 		},
 		{
-			name: "unknown model falls back to sonnet pricing",
+			name: "unknown model is not priced",
 			usage: &Usage{
-				InputTokens:  1_000_000,
-				OutputTokens: 1_000_000,
+				InputTokens:  100_000,
+				OutputTokens: 100_000,
 			},
 			model:    "unknown-model",
-			expected: 3.0 + 15.0, // $18
+			expected: 0,
 		},
 	}
 
@@ -115,3 +166,46 @@ func TestTokenSummary_Add(t *testing.T) {
 	s.Add(nil, "claude-sonnet-4-6")
 	assert.Equal(t, 500, s.InputTokens)
 }
+
+func TestPriceMessage(t *testing.T) {
+	usage := &Usage{InputTokens: 1000}
+
+	cost := PriceMessage(usage, "claude-sonnet-4-6")
+	assert.Equal(t, "anthropic/claude-sonnet-4.6", cost.PricingID)
+	assert.Equal(t, pricing.SourceSnapshot, cost.Source)
+	assert.Equal(t, pricing.ConfidenceExact, cost.Confidence)
+
+	cost = PriceMessage(usage, "claude-sonnet-4-5-20250929")
+	assert.Equal(t, "anthropic/claude-sonnet-4.5", cost.PricingID)
+	assert.Equal(t, pricing.ConfidenceAlias, cost.Confidence)
+
+	assert.False(t, PriceMessage(usage, "mystery-model").Priced())
+}
+
+func TestTokenSummaryCoverage(t *testing.T) {
+	var s TokenSummary
+	s.Add(&Usage{InputTokens: 1000}, "claude-sonnet-4-6")
+	assert.Equal(t, pricing.ConfidenceExact, s.Coverage())
+	assert.Equal(t, pricing.SourceSnapshot, s.PricingSource)
+
+	s.Add(&Usage{InputTokens: 1000}, "claude-sonnet-4-5-20250929")
+	assert.Equal(t, pricing.ConfidenceAlias, s.Coverage())
+
+	// synthetic messages have no usage and need no pricing
+	s.Add(&Usage{}, "<synthetic>")
+	assert.Equal(t, pricing.ConfidenceAlias, s.Coverage())
+
+	s.Add(&Usage{InputTokens: 1000}, "mystery-model")
+	assert.Equal(t, ConfidencePartial, s.Coverage())
+	assert.Equal(t, 1, s.UnpricedMessages)
+	assert.Equal(t, []string{"mystery-model"}, s.UnpricedModels)
+
+	var unpriced TokenSummary
+	unpriced.Add(&Usage{InputTokens: 1000}, "other-model")
+	assert.Equal(t, ConfidenceUnpriced, unpriced.Coverage())
+
+	unpriced.Merge(s)
+	assert.Equal(t, ConfidencePartial, unpriced.Coverage())
+	assert.Equal(t, []string{"mystery-model", "other-model"}, unpriced.UnpricedModels)
+	assert.Equal(t, 2, unpriced.UnpricedMessages)
+}
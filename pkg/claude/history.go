@@ -64,6 +64,7 @@ func (m *Message) UnmarshalJSON(data []byte) error {
 type ContentBlock struct {
 	Type      ContentType     `json:"type"`
 	Text      string          `json:"text,omitempty"`
+	Thinking  string          `json:"thinking,omitempty"`
 	ID        string          `json:"id,omitempty"`
 	Name      string          `json:"name,omitempty"`
 	Input     json.RawMessage `json:"input,omitempty"`
@@ -39,14 +39,50 @@ func ReadHistory(r io.Reader) ([]HistoryEntry, error) {
 	return entries, scanner.Err()
 }
 
-// streamJSONLine represents a line in Claude Code's stream-json format
-type streamJSONLine struct {
-	Type      string          `json:"type"`
-	Subtype   string          `json:"subtype,omitempty"`
-	SessionID string          `json:"session_id,omitempty"`
-	UUID      string          `json:"uuid,omitempty"`
-	Message   json.RawMessage `json:"message,omitempty"`
-	Timestamp string          `json:"timestamp,omitempty"`
+// StreamJSONLine represents a line in Claude Code's stream-json format.
+// System init lines carry Model, result lines carry the cost and usage totals.
+type StreamJSONLine struct {
+	Type         string          `json:"type"`
+	Subtype      string          `json:"subtype,omitempty"`
+	SessionID    string          `json:"session_id,omitempty"`
+	UUID         string          `json:"uuid,omitempty"`
+	Message      json.RawMessage `json:"message,omitempty"`
+	Timestamp    string          `json:"timestamp,omitempty"`
+	Model        string          `json:"model,omitempty"`
+	Result       string          `json:"result,omitempty"`
+	IsError      bool            `json:"is_error,omitempty"`
+	NumTurns     int             `json:"num_turns,omitempty"`
+	DurationMS   float64         `json:"duration_ms,omitempty"`
+	CostUSD      float64         `json:"cost_usd,omitempty"`
+	TotalCostUSD float64         `json:"total_cost_usd,omitempty"`
+	Usage        *Usage          `json:"usage,omitempty"`
+}
+
+// DecodeStreamJSONLine parses a single stream-json line
+func DecodeStreamJSONLine(line []byte) (StreamJSONLine, error) {
+	var sj StreamJSONLine
+	err := json.Unmarshal(line, &sj)
+	return sj, err
+}
+
+// AssistantMessage decodes the message of an assistant line
+func (l StreamJSONLine) AssistantMessage() (*Message, bool) {
+	if l.Type != "assistant" || len(l.Message) == 0 {
+		return nil, false
+	}
+	var msg Message
+	if err := json.Unmarshal(l.Message, &msg); err != nil {
+		return nil, false
+	}
+	return &msg, true
+}
+
+// Cost returns the reported session cost, preferring total_cost_usd
+func (l StreamJSONLine) Cost() float64 {
+	if l.TotalCostUSD > 0 {
+		return l.TotalCostUSD
+	}
+	return l.CostUSD
 }
 
 // ReadStreamJSON reads Claude Code stream-json JSONL, extracting assistant messages into HistoryEntry objects
@@ -61,17 +97,13 @@ func ReadStreamJSON(r io.Reader) ([]HistoryEntry, error) {
 			continue
 		}
 
-		var sj streamJSONLine
-		if err := json.Unmarshal(line, &sj); err != nil {
+		sj, err := DecodeStreamJSONLine(line)
+		if err != nil {
 			continue // skip unparseable lines
 		}
 
-		if sj.Type != "assistant" || len(sj.Message) == 0 {
-			continue
-		}
-
-		var msg Message
-		if err := json.Unmarshal(sj.Message, &msg); err != nil {
+		msg, ok := sj.AssistantMessage()
+		if !ok {
 			continue
 		}
 
@@ -79,7 +111,7 @@ func ReadStreamJSON(r io.Reader) ([]HistoryEntry, error) {
 			SessionID: sj.SessionID,
 			UUID:      sj.UUID,
 			Timestamp: sj.Timestamp,
-			Message:   msg,
+			Message:   *msg,
 		})
 	}
 
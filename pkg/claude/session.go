@@ -1,10 +1,13 @@
 package claude
 
 import (
+	"cmp"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
+
+	"github.com/flanksource/captain/pkg/ai/pricing"
 )
 
 // GetClaudeHome returns the path to the Claude Code home directory (~/.claude)
@@ -237,6 +240,7 @@ func ParseHistory(currentDir string, searchAll bool, filter Filter) (*ParseResul
 
 type SessionCost struct {
 	SessionID string       `json:"sessionId"`
+	Agent     string       `json:"agent"`
 	Project   string       `json:"project"`
 	Model     string       `json:"model"`
 	Tier      string       `json:"tier"`
@@ -245,9 +249,27 @@ type SessionCost struct {
 	Tokens    TokenSummary `json:"tokens"`
 	Messages  int          `json:"messages"`
 	Files     []string     `json:"files,omitempty"`
+	// Charges are the costs of the session's messages, for splitting its
+	// spend by time and model.
+	Charges []Charge `json:"-"`
+}
+
+// Charge is the cost of a single message.
+type Charge struct {
+	Time  time.Time
+	Model string
+	Cost  float64
+}
+
+// addUsage prices a message of model sent at ts into the session.
+func (sc *SessionCost) addUsage(ts time.Time, usage pricing.Usage, model string) {
+	before := sc.Tokens.TotalCost
+	sc.Tokens.AddUsage(usage, model)
+	sc.Charges = append(sc.Charges, Charge{Time: ts, Model: cmp.Or(model, sc.Model), Cost: sc.Tokens.TotalCost - before})
+	sc.Messages++
 }
 
-func ParseCosts(currentDir string, searchAll bool, since *time.Time) ([]SessionCost, error) {
+func parseClaudeCosts(currentDir string, searchAll bool, since *time.Time) ([]SessionCost, error) {
 	sessionFiles, err := FindSessionFiles(GetProjectsDir(), currentDir, searchAll)
 	if err != nil {
 		return nil, err
@@ -302,6 +324,7 @@ func ParseCosts(currentDir string, searchAll bool, since *time.Time) ([]SessionC
 			if !ok {
 				sc = &SessionCost{
 					SessionID: entry.SessionID,
+					Agent:     AgentClaude,
 					Project:   project,
 					Start:     ts,
 					End:       ts,
@@ -325,8 +348,7 @@ func ParseCosts(currentDir string, searchAll bool, since *time.Time) ([]SessionC
 				sc.Tier = tier
 			}
 
-			sc.Tokens.Add(entry.Message.Usage, model)
-			sc.Messages++
+			sc.addUsage(ts, entry.Message.Usage.pricingUsage(), model)
 		}
 	}
 
@@ -52,6 +52,7 @@ type ContentType string
 
 const (
 	ContentTypeText       ContentType = "text"
+	ContentTypeThinking   ContentType = "thinking"
 	ContentTypeToolUse    ContentType = "tool_use"
 	ContentTypeToolResult ContentType = "tool_result"
 )
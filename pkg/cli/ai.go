@@ -8,25 +8,41 @@ import (
 	"github.com/flanksource/captain/pkg/ai"
 	"github.com/flanksource/captain/pkg/ai/middleware"
 	"github.com/flanksource/captain/pkg/ai/provider"
+	"github.com/flanksource/captain/pkg/ai/session"
 	"github.com/flanksource/commons/logger"
 )
 
 type AIPromptOptions struct {
 	Model       string        `flag:"model" help:"Model name (e.g. claude-code-sonnet, gemini-2.0-flash)" short:"m" required:"true"`
+	Fallback    []string      `flag:"fallback" help:"Models to try in order when the previous one fails (repeatable)"`
 	Prompt      string        `flag:"prompt" help:"Prompt text" short:"p" required:"true" stdin:"true"`
 	System      string        `flag:"system" help:"System prompt" short:"s"`
+	Attach      []string      `flag:"attach" help:"Attach an image, PDF or text file (repeatable)" short:"a"`
 	MaxTokens   int           `flag:"max-tokens" help:"Maximum output tokens" default:"4096"`
 	Temperature float64       `flag:"temperature" help:"Sampling temperature" default:"0"`
+	Thinking    int           `flag:"thinking-budget" help:"Tokens the model may spend thinking (reasoning models only)"`
+	Effort      string        `flag:"effort" help:"Reasoning effort: low, medium or high (reasoning models only)"`
 	Timeout     time.Duration `flag:"timeout" help:"Request timeout" default:"120s"`
+	NoCache     bool          `flag:"no-cache" help:"Bypass the response cache"`
+	CacheTTL    time.Duration `flag:"cache-ttl" help:"How long cached responses stay valid" default:"24h"`
+	CacheDB     string        `flag:"cache-db" help:"Response cache database (default ~/.cache/captain/ai-cache.db)"`
+	SpendDB     string        `flag:"spend-db" help:"Spend ledger database (default ~/.local/share/captain/spend.db)"`
+	Project     string        `flag:"project" help:"Project the spend is recorded under (default: current project)"`
+	Session     string        `flag:"session" help:"Session ID the spend is recorded under"`
+	Daily       float64       `flag:"daily-budget" help:"Refuse to run once the project has spent this many USD today"`
+	Weekly      float64       `flag:"weekly-budget" help:"Refuse to run once the project has spent this many USD this week"`
+	Monthly     float64       `flag:"monthly-budget" help:"Refuse to run once the project has spent this many USD this month"`
 }
 
 type AIPromptResult struct {
 	Text     string `json:"text" pretty:"label=Response"`
+	Thinking string `json:"thinking,omitempty" pretty:"label=Thinking"`
 	Model    string `json:"model" pretty:"label=Model"`
 	Backend  string `json:"backend" pretty:"label=Backend"`
 	Input    int    `json:"inputTokens" pretty:"label=Input Tokens"`
 	Output   int    `json:"outputTokens" pretty:"label=Output Tokens"`
 	Duration string `json:"duration" pretty:"label=Duration"`
+	Cached   bool   `json:"cached,omitempty" pretty:"label=Cached"`
 }
 
 func RunAIPrompt(opts AIPromptOptions) (any, error) {
@@ -34,26 +50,70 @@ func RunAIPrompt(opts AIPromptOptions) (any, error) {
 		return nil, fmt.Errorf("prompt text required (use --prompt or pipe via stdin)")
 	}
 
-	cfg := ai.Config{Model: opts.Model}
+	effort, err := ai.ParseReasoningEffort(opts.Effort)
+	if err != nil {
+		return nil, fmt.Errorf("--effort: %w", err)
+	}
+
+	var attachments []ai.Attachment
+	for _, path := range opts.Attach {
+		attachment, err := ai.LoadAttachment(path)
+		if err != nil {
+			return nil, fmt.Errorf("--attach %s: %w", path, err)
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	cfg := ai.Config{
+		Model:            opts.Model,
+		CacheDBPath:      opts.CacheDB,
+		CacheTTL:         opts.CacheTTL,
+		NoCache:          opts.NoCache,
+		LedgerPath:       opts.SpendDB,
+		SessionID:        opts.Session,
+		ProjectName:      opts.Project,
+		DailyBudgetUSD:   opts.Daily,
+		WeeklyBudgetUSD:  opts.Weekly,
+		MonthlyBudgetUSD: opts.Monthly,
+	}
+	if cfg.CacheDBPath == "" {
+		cfg.CacheDBPath = middleware.DefaultCacheDBPath()
+	}
+	if cfg.LedgerPath == "" {
+		cfg.LedgerPath = session.DefaultLedgerPath()
+	}
+	if cfg.ProjectName == "" {
+		cfg.ProjectName = currentProjectName()
+	}
+	if cfg.SessionID == "" {
+		cfg.SessionID = fmt.Sprintf("prompt-%d", time.Now().UnixNano())
+	}
 	if logger.IsDebugEnabled() {
 		cfg.HTTPClient = provider.NewLoggingHTTPClient()
 	}
-	p, err := ai.NewProvider(cfg)
-	if err != nil {
-		return nil, err
+	configs := []ai.Config{cfg}
+	for _, model := range opts.Fallback {
+		fallback := cfg
+		fallback.Model = model
+		configs = append(configs, fallback)
 	}
-	if p, err = middleware.Wrap(p, middleware.WithLogging()); err != nil {
+	p, err := middleware.NewFallbackProvider(configs, middleware.WithLogging())
+	if err != nil {
 		return nil, err
 	}
+	defer func() { _ = middleware.Close(p) }()
 
 	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
 	defer cancel()
 
 	resp, err := p.Execute(ctx, ai.Request{
-		SystemPrompt: opts.System,
-		Prompt:       opts.Prompt,
-		MaxTokens:    opts.MaxTokens,
-		Temperature:  opts.Temperature,
+		SystemPrompt:    opts.System,
+		Prompt:          opts.Prompt,
+		Attachments:     attachments,
+		MaxTokens:       opts.MaxTokens,
+		Temperature:     opts.Temperature,
+		ThinkingBudget:  opts.Thinking,
+		ReasoningEffort: effort,
 	})
 	if err != nil {
 		return nil, err
@@ -61,11 +121,13 @@ func RunAIPrompt(opts AIPromptOptions) (any, error) {
 
 	return AIPromptResult{
 		Text:     resp.Text,
+		Thinking: resp.Thinking,
 		Model:    resp.Model,
 		Backend:  string(resp.Backend),
 		Input:    resp.Usage.InputTokens,
 		Output:   resp.Usage.OutputTokens,
 		Duration: resp.Duration.Round(time.Millisecond).String(),
+		Cached:   resp.CacheHit,
 	}, nil
 }
 
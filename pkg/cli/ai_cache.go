@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/flanksource/captain/pkg/ai/middleware"
+	"github.com/flanksource/captain/pkg/claude"
+)
+
+type AICacheListOptions struct {
+	DB    string `flag:"db" help:"Response cache database (default ~/.cache/captain/ai-cache.db)"`
+	Limit int    `flag:"limit" help:"Maximum entries to show" default:"50" short:"l"`
+}
+
+type AICacheStatsOptions struct {
+	DB string `flag:"db" help:"Response cache database (default ~/.cache/captain/ai-cache.db)"`
+}
+
+type AICachePurgeOptions struct {
+	DB      string `flag:"db" help:"Response cache database (default ~/.cache/captain/ai-cache.db)"`
+	Expired bool   `flag:"expired" help:"Only remove expired entries"`
+}
+
+type AICacheRow struct {
+	Key      string `json:"key" pretty:"label=Key,table"`
+	Size     string `json:"size" pretty:"label=Size,table"`
+	Hits     int64  `json:"hits" pretty:"label=Hits,table"`
+	Created  string `json:"created" pretty:"label=Created,table"`
+	LastUsed string `json:"lastUsed" pretty:"label=Last Used,table"`
+	Expires  string `json:"expires" pretty:"label=Expires,table"`
+	Preview  string `json:"preview" pretty:"label=Preview,width=50,table"`
+}
+
+type AICacheListResult struct {
+	Total int          `json:"total" pretty:"label=Entries"`
+	Rows  []AICacheRow `json:"rows"`
+}
+
+type AICacheStatsResult struct {
+	Path    string `json:"path" pretty:"label=Database"`
+	Entries int64  `json:"entries" pretty:"label=Entries"`
+	Expired int64  `json:"expired" pretty:"label=Expired"`
+	Size    string `json:"size" pretty:"label=Size"`
+	MaxSize string `json:"maxSize" pretty:"label=Max Size"`
+	Hits    int64  `json:"hits" pretty:"label=Hits"`
+	Misses  int64  `json:"misses" pretty:"label=Misses"`
+	HitRate string `json:"hitRate" pretty:"label=Hit Rate"`
+}
+
+type AICachePurgeResult struct {
+	Path    string `json:"path" pretty:"label=Database"`
+	Removed int64  `json:"removed" pretty:"label=Removed"`
+}
+
+func RunAICacheList(opts AICacheListOptions) (any, error) {
+	cache, err := middleware.NewSQLiteCache(opts.DB, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = cache.Close() }()
+
+	entries, err := cache.List(opts.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]AICacheRow, 0, len(entries))
+	for _, e := range entries {
+		expires := "never"
+		if !e.ExpiresAt.IsZero() {
+			expires = e.ExpiresAt.Format(time.DateTime)
+		}
+		rows = append(rows, AICacheRow{
+			Key:      e.Key[:min(12, len(e.Key))],
+			Size:     formatBytes(e.Size),
+			Hits:     e.Hits,
+			Created:  claude.FormatTimeAgo(&e.CreatedAt),
+			LastUsed: claude.FormatTimeAgo(&e.AccessedAt),
+			Expires:  expires,
+			Preview:  strings.Join(strings.Fields(e.Preview), " "),
+		})
+	}
+	return AICacheListResult{Total: len(rows), Rows: rows}, nil
+}
+
+func RunAICacheStats(opts AICacheStatsOptions) (any, error) {
+	cache, err := middleware.NewSQLiteCache(opts.DB, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = cache.Close() }()
+
+	stats, err := cache.Stats()
+	if err != nil {
+		return nil, err
+	}
+	return AICacheStatsResult{
+		Path:    stats.Path,
+		Entries: stats.Entries,
+		Expired: stats.Expired,
+		Size:    formatBytes(stats.Size),
+		MaxSize: formatBytes(stats.MaxSize),
+		Hits:    stats.Hits,
+		Misses:  stats.Misses,
+		HitRate: fmt.Sprintf("%.1f%%", stats.HitRate()*100),
+	}, nil
+}
+
+func RunAICachePurge(opts AICachePurgeOptions) (any, error) {
+	cache, err := middleware.NewSQLiteCache(opts.DB, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = cache.Close() }()
+
+	removed, err := cache.Purge(opts.Expired)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := cache.Stats()
+	if err != nil {
+		return nil, err
+	}
+	return AICachePurgeResult{Path: stats.Path, Removed: removed}, nil
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1fG", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fM", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1fK", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%dB", n)
+	}
+}
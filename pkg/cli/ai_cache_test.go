@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/flanksource/captain/pkg/ai/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAICacheCommands(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+	cache, err := middleware.NewSQLiteCache(path, 0)
+	require.NoError(t, err)
+	cache.Set("0123456789abcdef", "hello\nworld", 0)
+	cache.Set("fedcba9876543210", "stale", 20*time.Millisecond)
+	_, _ = cache.Get("0123456789abcdef")
+	require.NoError(t, cache.Close())
+	time.Sleep(50 * time.Millisecond)
+
+	result, err := RunAICacheList(AICacheListOptions{DB: path, Limit: 10})
+	require.NoError(t, err)
+	list := result.(AICacheListResult)
+	require.Equal(t, 2, list.Total)
+	assert.Equal(t, "0123456789ab", list.Rows[0].Key)
+	assert.Equal(t, "hello world", list.Rows[0].Preview)
+	assert.Equal(t, "never", list.Rows[0].Expires)
+
+	result, err = RunAICacheStats(AICacheStatsOptions{DB: path})
+	require.NoError(t, err)
+	stats := result.(AICacheStatsResult)
+	assert.Equal(t, int64(2), stats.Entries)
+	assert.Equal(t, int64(1), stats.Expired)
+	assert.Equal(t, "100.0%", stats.HitRate)
+
+	result, err = RunAICachePurge(AICachePurgeOptions{DB: path, Expired: true})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result.(AICachePurgeResult).Removed)
+
+	result, err = RunAICachePurge(AICachePurgeOptions{DB: path})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result.(AICachePurgeResult).Removed)
+}
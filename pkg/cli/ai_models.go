@@ -1,16 +1,21 @@
 package cli
 
 import (
+	"context"
 	"fmt"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/flanksource/captain/pkg/ai"
 	"github.com/flanksource/captain/pkg/ai/pricing"
+	"github.com/flanksource/captain/pkg/ai/provider"
+	"github.com/flanksource/commons/logger"
 )
 
 type AIModelsOptions struct {
 	Filter  string `flag:"filter" help:"Filter models by name substring" short:"f"`
-	Backend string `flag:"backend" help:"Filter by backend (anthropic, gemini, codex-cli, claude-cli, gemini-cli)" short:"b"`
+	Backend string `flag:"backend" help:"Filter by backend (anthropic, gemini, openai, ollama, codex-cli, claude-cli, gemini-cli)" short:"b"`
 	Limit   int    `flag:"limit" help:"Maximum models to show" default:"50" short:"l"`
 	All     bool   `flag:"all" help:"Include all OpenRouter models (not just built-in)" short:"a"`
 }
@@ -41,13 +46,13 @@ func RunAIModels(opts AIModelsOptions) (any, error) {
 	return runDefaultModels(opts)
 }
 
-// runDefaultModels shows the built-in model catalog
+// runDefaultModels shows the built-in model catalog and locally pulled models
 func runDefaultModels(opts AIModelsOptions) (any, error) {
-	defaults := ai.DefaultModels()
-
 	filterLower := strings.ToLower(opts.Filter)
 	backendFilter := ai.Backend(opts.Backend)
 
+	defaults := slices.Concat(ai.DefaultModels(), discoverModels(backendFilter))
+
 	rows := make([]AIModelRow, 0)
 	for _, m := range defaults {
 		if backendFilter != "" && m.Backend != backendFilter {
@@ -85,6 +90,23 @@ func runDefaultModels(opts AIModelsOptions) (any, error) {
 	return AIModelsResult{Total: len(rows), Rows: rows}, nil
 }
 
+// discoverModels asks local backends for the models they serve. Unreachable
+// servers are skipped so the built-in catalog is still listed.
+func discoverModels(backend ai.Backend) []ai.ModelDef {
+	if backend != "" && backend != ai.BackendOllama {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	models, err := provider.NewOllama(ai.Config{}).ListModels(ctx)
+	if err != nil {
+		logger.Debugf("Skipping ollama model discovery: %v", err)
+		return nil
+	}
+	return models
+}
+
 // runAllModels shows all models from the pricing registry (OpenRouter + defaults)
 func runAllModels(opts AIModelsOptions) (any, error) {
 	models := pricing.ListModels(opts.Filter)
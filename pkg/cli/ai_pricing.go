@@ -0,0 +1,174 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/flanksource/captain/pkg/ai"
+	"github.com/flanksource/captain/pkg/ai/pricing"
+)
+
+type AIPricingShowOptions struct {
+	Filter string `flag:"filter" help:"Filter models by ID substring" short:"f"`
+	Source string `flag:"source" help:"Only show models priced by this source: catalog, snapshot, openrouter, user" short:"s"`
+	Limit  int    `flag:"limit" help:"Maximum models to show" default:"50" short:"l"`
+}
+
+type AIPricingRefreshOptions struct {
+	Output string `flag:"output" help:"Also write the fetched prices to this snapshot file" short:"o"`
+}
+
+type AIPricingDiffOptions struct {
+	From string `flag:"from" help:"Old prices: snapshot, openrouter, user or a snapshot file" default:"snapshot"`
+	To   string `flag:"to" help:"New prices: snapshot, openrouter, user or a snapshot file" default:"openrouter"`
+}
+
+type AIPricingRow struct {
+	Model      string `json:"model" pretty:"label=Model,width=45,table"`
+	Input      string `json:"input" pretty:"label=Input/1M,table"`
+	Output     string `json:"output" pretty:"label=Output/1M,table"`
+	CacheRead  string `json:"cacheRead" pretty:"label=Cache Read/1M,table"`
+	CacheWrite string `json:"cacheWrite" pretty:"label=Cache Write/1M,table"`
+	Context    string `json:"context" pretty:"label=Context,table"`
+	Source     string `json:"source" pretty:"label=Source,table"`
+}
+
+type AIPricingShowResult struct {
+	Sources string         `json:"sources" pretty:"label=Precedence"`
+	Errors  []string       `json:"errors,omitempty" pretty:"label=Errors"`
+	Total   int            `json:"total" pretty:"label=Models"`
+	Rows    []AIPricingRow `json:"rows"`
+}
+
+type AIPriceChangeRow struct {
+	Model  string `json:"model" pretty:"label=Model,width=45,table"`
+	Change string `json:"change" pretty:"label=Change,table"`
+	Field  string `json:"field,omitempty" pretty:"label=Price,table"`
+	Old    string `json:"old,omitempty" pretty:"label=Old/1M,table"`
+	New    string `json:"new,omitempty" pretty:"label=New/1M,table"`
+	Delta  string `json:"delta,omitempty" pretty:"label=Delta,table"`
+}
+
+type AIPricingDiffResult struct {
+	From    string             `json:"from" pretty:"label=From"`
+	To      string             `json:"to" pretty:"label=To"`
+	Changes int                `json:"changes" pretty:"label=Changes"`
+	Rows    []AIPriceChangeRow `json:"rows"`
+}
+
+func RunAIPricingShow(opts AIPricingShowOptions) (any, error) {
+	// registers the built-in catalog
+	_ = ai.DefaultModels()
+	models := pricing.ListModels(opts.Filter)
+
+	var names []string
+	for _, src := range pricing.DefaultSources() {
+		names = append(names, src.Name())
+	}
+	result := AIPricingShowResult{Sources: pricing.SourceCatalog + " < " + strings.Join(names, " < ")}
+	for name, err := range pricing.SourceErrors() {
+		result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", name, err))
+	}
+
+	for _, m := range models {
+		if opts.Source != "" && m.Source != opts.Source {
+			continue
+		}
+		result.Total++
+		if opts.Limit > 0 && len(result.Rows) >= opts.Limit {
+			continue
+		}
+		result.Rows = append(result.Rows, AIPricingRow{
+			Model:      m.ModelID,
+			Input:      formatPrice(m.InputPrice),
+			Output:     formatPrice(m.OutputPrice),
+			CacheRead:  formatPrice(m.CacheReadsPrice),
+			CacheWrite: formatPrice(m.CacheWritesPrice),
+			Context:    formatContext(m.ContextWindow),
+			Source:     m.Source,
+		})
+	}
+	return result, nil
+}
+
+// RunAIPricingRefresh fetches OpenRouter prices into the disk cache and
+// reports what changed since the previous fetch, or since the embedded
+// snapshot on the first run.
+func RunAIPricingRefresh(opts AIPricingRefreshOptions) (any, error) {
+	from := "openrouter cache"
+	previous, err := pricing.CachedOpenRouterPricing()
+	if err != nil || previous == nil {
+		from = pricing.SourceSnapshot
+		if previous, err = (&pricing.SnapshotSource{}).Snapshot(); err != nil {
+			return nil, err
+		}
+	}
+
+	models, err := (&pricing.OpenRouterSource{}).Fetch(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if opts.Output != "" {
+		snapshot := &pricing.PricingCache{Timestamp: time.Now().UTC(), Models: models}
+		if err := pricing.WriteSnapshot(opts.Output, snapshot); err != nil {
+			return nil, fmt.Errorf("failed to write snapshot: %w", err)
+		}
+	}
+	return diffResult(from, pricing.SourceOpenRouter, previous.Models, models), nil
+}
+
+func RunAIPricingDiff(opts AIPricingDiffOptions) (any, error) {
+	from, err := loadPrices(opts.From)
+	if err != nil {
+		return nil, fmt.Errorf("--from: %w", err)
+	}
+	to, err := loadPrices(opts.To)
+	if err != nil {
+		return nil, fmt.Errorf("--to: %w", err)
+	}
+	return diffResult(opts.From, opts.To, from, to), nil
+}
+
+// loadPrices loads a named source without consulting the network, or the
+// snapshot file at name.
+func loadPrices(name string) (map[string]*pricing.ModelInfo, error) {
+	switch name {
+	case pricing.SourceSnapshot:
+		return (&pricing.SnapshotSource{}).Load(context.Background())
+	case pricing.SourceUser:
+		return (&pricing.FileSource{}).Load(context.Background())
+	case pricing.SourceOpenRouter:
+		cache, err := pricing.CachedOpenRouterPricing()
+		if err != nil {
+			return nil, err
+		}
+		if cache == nil {
+			return nil, fmt.Errorf("no OpenRouter prices cached, run `captain ai pricing refresh`")
+		}
+		return cache.Models, nil
+	}
+	if _, err := os.Stat(name); err != nil {
+		return nil, fmt.Errorf("unknown pricing source %q (snapshot, openrouter, user or a snapshot file)", name)
+	}
+	return (&pricing.SnapshotSource{Path: name}).Load(context.Background())
+}
+
+func diffResult(fromName, toName string, from, to map[string]*pricing.ModelInfo) AIPricingDiffResult {
+	changes := pricing.Diff(from, to)
+	result := AIPricingDiffResult{From: fromName, To: toName, Changes: len(changes), Rows: make([]AIPriceChangeRow, 0, len(changes))}
+	for _, c := range changes {
+		row := AIPriceChangeRow{Model: c.Model, Change: c.Kind, Field: c.Field}
+		if c.Kind == "changed" {
+			row.Old = formatPrice(c.Old)
+			row.New = formatPrice(c.New)
+			if c.Old > 0 {
+				row.Delta = fmt.Sprintf("%+.1f%%", (c.New-c.Old)/c.Old*100)
+			}
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	return result
+}
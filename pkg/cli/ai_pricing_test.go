@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/flanksource/captain/pkg/ai/pricing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeSnapshot(t *testing.T, models map[string]*pricing.ModelInfo) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	require.NoError(t, pricing.WriteSnapshot(path, &pricing.PricingCache{Timestamp: time.Now(), Models: models}))
+	return path
+}
+
+func TestPricingSourcePrecedence(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	defer pricing.SetSources(&pricing.SnapshotSource{})
+
+	snapshot := writeSnapshot(t, map[string]*pricing.ModelInfo{
+		"test/precedence": {InputPrice: 1, OutputPrice: 2, CacheReadsPrice: 0.1, ContextWindow: 1000},
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"data":[{"id":"test/precedence","pricing":{"prompt":"0.000003","completion":"0.000015"},"context_length":200000}]}`)
+	}))
+	defer server.Close()
+
+	user := filepath.Join(t.TempDir(), "pricing.yaml")
+	require.NoError(t, os.WriteFile(user, []byte(`models:
+  test/precedence:
+    input: 2.5
+    tiers:
+      - above: 200000
+        input: 5
+    service_tiers:
+      priority: 2
+`), 0o644))
+
+	pricing.SetSources(&pricing.SnapshotSource{Path: snapshot}, &pricing.OpenRouterSource{URL: server.URL}, &pricing.FileSource{Path: user})
+	pricing.EnsureLoaded()
+
+	info, ok := pricing.GetModelInfo("test/precedence")
+	require.True(t, ok)
+	assert.Equal(t, pricing.SourceUser, info.Source)
+	assert.Equal(t, 2.5, info.InputPrice, "user file overrides OpenRouter")
+	assert.InDelta(t, 15.0, info.OutputPrice, 1e-9, "OpenRouter overrides the snapshot")
+	assert.Equal(t, 0.1, info.CacheReadsPrice, "unset fields keep the snapshot price")
+	assert.Equal(t, 200000, info.ContextWindow)
+	assert.Equal(t, []pricing.PriceTier{{AboveTokens: 200000, InputPrice: 5}}, info.ContextTiers)
+	assert.Equal(t, 2.0, info.ServiceTierMultiplier(pricing.ServiceTierPriority))
+	assert.Equal(t, 0.5, info.ServiceTierMultiplier(pricing.ServiceTierBatch))
+	assert.Empty(t, pricing.SourceErrors())
+}
+
+func TestAIPricingShowLimit(t *testing.T) {
+	defer pricing.SetSources(&pricing.SnapshotSource{})
+	pricing.SetSources(&pricing.SnapshotSource{Path: writeSnapshot(t, map[string]*pricing.ModelInfo{
+		"test/limit-a": {InputPrice: 1},
+		"test/limit-b": {InputPrice: 2},
+		"test/limit-c": {InputPrice: 3},
+	})})
+
+	out, err := RunAIPricingShow(AIPricingShowOptions{Filter: "test/limit", Limit: 2})
+	require.NoError(t, err)
+	result := out.(AIPricingShowResult)
+	assert.Len(t, result.Rows, 2)
+	assert.Equal(t, 3, result.Total, "the total counts the models --limit hides")
+}
+
+func TestOpenRouterSourceRetriesAfterTimeout(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	defer pricing.SetSources(&pricing.SnapshotSource{})
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"data":[{"id":"test/slow","pricing":{"prompt":"0.000001","completion":"0.000002"}}]}`)
+	}))
+	defer server.Close()
+
+	src := &pricing.OpenRouterSource{URL: server.URL, Timeout: 50 * time.Millisecond}
+	pricing.SetSources(src)
+	pricing.EnsureLoaded()
+	require.Contains(t, pricing.SourceErrors(), pricing.SourceOpenRouter)
+
+	// the failure is not remembered: the next load reaches the API again
+	models, err := src.Load(context.Background())
+	require.NoError(t, err)
+	assert.InDelta(t, 1.0, models["test/slow"].InputPrice, 1e-9)
+
+	cached, err := pricing.CachedOpenRouterPricing()
+	require.NoError(t, err)
+	require.NotNil(t, cached)
+	assert.Contains(t, cached.Models, "test/slow")
+}
+
+func TestAIPricingDiff(t *testing.T) {
+	from := writeSnapshot(t, map[string]*pricing.ModelInfo{
+		"test/same":    {InputPrice: 1, OutputPrice: 2},
+		"test/cheaper": {InputPrice: 4, OutputPrice: 8},
+		"test/gone":    {InputPrice: 1},
+	})
+	to := writeSnapshot(t, map[string]*pricing.ModelInfo{
+		"test/same":    {InputPrice: 1, OutputPrice: 2},
+		"test/cheaper": {InputPrice: 3, OutputPrice: 8},
+		"test/new":     {InputPrice: 1},
+	})
+
+	out, err := RunAIPricingDiff(AIPricingDiffOptions{From: from, To: to})
+	require.NoError(t, err)
+	result := out.(AIPricingDiffResult)
+	require.Equal(t, 3, result.Changes)
+	assert.Equal(t, AIPriceChangeRow{Model: "test/cheaper", Change: "changed", Field: "input", Old: "$4.00", New: "$3.00", Delta: "-25.0%"}, result.Rows[0])
+	assert.Equal(t, AIPriceChangeRow{Model: "test/gone", Change: "removed"}, result.Rows[1])
+	assert.Equal(t, AIPriceChangeRow{Model: "test/new", Change: "added"}, result.Rows[2])
+
+	_, err = RunAIPricingDiff(AIPricingDiffOptions{From: "nowhere", To: to})
+	assert.ErrorContains(t, err, "unknown pricing source")
+}
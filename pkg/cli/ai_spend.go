@@ -0,0 +1,156 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flanksource/captain/pkg/ai"
+	"github.com/flanksource/captain/pkg/ai/session"
+	"github.com/flanksource/captain/pkg/claude"
+)
+
+type AISpendOptions struct {
+	DB      string    `flag:"db" help:"Spend ledger database (default ~/.local/share/captain/spend.db)"`
+	Since   time.Time `flag:"since" help:"Only include spend after this time" default:"now-30d" short:"s"`
+	Project string    `flag:"project" help:"Only include this project" short:"p"`
+	GroupBy string    `flag:"group-by" help:"Comma-separated grouping: project, model, day, session" default:"project,model,day" short:"g"`
+}
+
+type AISpendRow struct {
+	Day      string `json:"day,omitempty" pretty:"label=Day,table"`
+	Project  string `json:"project,omitempty" pretty:"label=Project,table"`
+	Model    string `json:"model,omitempty" pretty:"label=Model,table"`
+	Session  string `json:"session,omitempty" pretty:"label=Session,table"`
+	Requests int    `json:"requests" pretty:"label=Requests,table"`
+	Input    string `json:"input" pretty:"label=Input,table"`
+	Output   string `json:"output" pretty:"label=Output,table"`
+	Cost     string `json:"cost" pretty:"label=Cost,table"`
+}
+
+type AISpendResult struct {
+	Path      string       `json:"path" pretty:"label=Ledger"`
+	Today     string       `json:"today" pretty:"label=Today"`
+	ThisWeek  string       `json:"thisWeek" pretty:"label=This Week"`
+	ThisMonth string       `json:"thisMonth" pretty:"label=This Month"`
+	Total     string       `json:"total" pretty:"label=Total"`
+	Rows      []AISpendRow `json:"rows"`
+}
+
+var spendGroups = map[string]bool{"project": true, "model": true, "day": true, "session": true}
+
+func RunAISpend(opts AISpendOptions) (any, error) {
+	groupBy := map[string]bool{}
+	for _, g := range strings.Split(opts.GroupBy, ",") {
+		g = strings.TrimSpace(g)
+		if g == "" {
+			continue
+		}
+		if !spendGroups[g] {
+			return nil, fmt.Errorf("--group-by: unknown grouping %q (project, model, day, session)", g)
+		}
+		groupBy[g] = true
+	}
+
+	ledger, err := session.OpenLedger(opts.DB)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = ledger.Close() }()
+
+	result := AISpendResult{Path: ledger.Path()}
+	now := time.Now()
+	for _, w := range []struct {
+		window session.BudgetWindow
+		into   *string
+	}{
+		{session.Daily, &result.Today},
+		{session.Weekly, &result.ThisWeek},
+		{session.Monthly, &result.ThisMonth},
+	} {
+		spent, err := ledger.Spent(opts.Project, w.window.Start(now))
+		if err != nil {
+			return nil, err
+		}
+		*w.into = formatCost(spent)
+	}
+
+	entries, err := ledger.Entries(opts.Project, opts.Since)
+	if err != nil {
+		return nil, err
+	}
+
+	type group struct {
+		row   AISpendRow
+		cost  ai.Cost
+		count int
+	}
+	groups := map[AISpendRow]*group{}
+	var total float64
+	for _, e := range entries {
+		total += e.Cost.Total()
+
+		var key AISpendRow
+		if groupBy["day"] {
+			key.Day = e.RecordedAt.Format(time.DateOnly)
+		}
+		if groupBy["project"] {
+			key.Project = e.Project
+		}
+		if groupBy["model"] {
+			key.Model = e.Cost.Model
+		}
+		if groupBy["session"] {
+			key.Session = e.SessionID
+		}
+
+		g, ok := groups[key]
+		if !ok {
+			g = &group{row: key}
+			groups[key] = g
+		}
+		g.cost = g.cost.Add(e.Cost)
+		g.count++
+	}
+	result.Total = formatCost(total)
+
+	sorted := make([]*group, 0, len(groups))
+	for _, g := range groups {
+		sorted = append(sorted, g)
+	}
+	// newest day first, then the most expensive groups
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.row.Day != b.row.Day {
+			return a.row.Day > b.row.Day
+		}
+		return a.cost.Total() > b.cost.Total()
+	})
+
+	result.Rows = make([]AISpendRow, 0, len(sorted))
+	for _, g := range sorted {
+		row := g.row
+		row.Requests = g.count
+		row.Input = formatTokens(g.cost.InputTokens)
+		row.Output = formatTokens(g.cost.OutputTokens)
+		row.Cost = formatCost(g.cost.Total())
+		result.Rows = append(result.Rows, row)
+	}
+	return result, nil
+}
+
+// currentProjectName names the project containing the working directory, as
+// `captain info` does, falling back to the directory name.
+func currentProjectName() string {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	if root := claude.FindProjectRoot(cwd); root != "" {
+		return filepath.Base(root)
+	}
+	return filepath.Base(cwd)
+}
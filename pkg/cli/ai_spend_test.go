@@ -0,0 +1,158 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/flanksource/captain/pkg/ai"
+	"github.com/flanksource/captain/pkg/ai/middleware"
+	"github.com/flanksource/captain/pkg/ai/pricing"
+	"github.com/flanksource/captain/pkg/ai/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	// price with the embedded snapshot only, so tests neither reach OpenRouter
+	// nor read the user pricing file
+	pricing.SetSources(&pricing.SnapshotSource{})
+	os.Exit(m.Run())
+}
+
+// registerTestPricing prices claude-sonnet-4-6 at $2/$4 per million tokens.
+func registerTestPricing() {
+	pricing.EnsureLoaded()
+	pricing.MergeModels(map[string]*pricing.ModelInfo{
+		"anthropic/claude-sonnet-4.6": {ModelID: "anthropic/claude-sonnet-4.6", InputPrice: 2, OutputPrice: 4},
+	})
+}
+
+func TestLedgerBudgetAcrossProcesses(t *testing.T) {
+	registerTestPricing()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"id":"m","type":"message","role":"assistant","model":"claude-sonnet-4-6",
+			"content":[{"type":"text","text":"ok"}],"usage":{"input_tokens":1000000,"output_tokens":0}}`)
+	}))
+	defer server.Close()
+
+	cfg := ai.Config{
+		Model: "claude-sonnet-4-6", APIKey: "key", APIURL: server.URL, NoCache: true,
+		LedgerPath: filepath.Join(t.TempDir(), "spend.db"), ProjectName: "captain", DailyBudgetUSD: 3,
+	}
+
+	// each provider stands in for a separate captain process sharing the ledger
+	for i, want := range []error{nil, nil, ai.ErrBudgetExceeded} {
+		cfg.SessionID = fmt.Sprintf("run-%d", i)
+		p, err := middleware.NewProvider(cfg)
+		require.NoError(t, err)
+		_, err = p.Execute(context.Background(), ai.Request{Prompt: "hi"})
+		if want == nil {
+			require.NoError(t, err)
+		} else {
+			require.ErrorIs(t, err, want)
+		}
+	}
+
+	// other projects have their own daily budget
+	cfg.ProjectName = "other"
+	p, err := middleware.NewProvider(cfg)
+	require.NoError(t, err)
+	_, err = p.Execute(context.Background(), ai.Request{Prompt: "hi"})
+	require.NoError(t, err)
+
+	ledger, err := session.OpenLedger(cfg.LedgerPath)
+	require.NoError(t, err)
+	defer func() { _ = ledger.Close() }()
+	spent, err := ledger.Spent("captain", session.Daily.Start(time.Now()))
+	require.NoError(t, err)
+	assert.InDelta(t, 4.0, spent, 1e-9)
+}
+
+func TestLedgerConcurrentWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spend.db")
+	var wg sync.WaitGroup
+	for w := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ledger, err := session.OpenLedger(path)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer func() { _ = ledger.Close() }()
+			for range 25 {
+				assert.NoError(t, ledger.Record(fmt.Sprintf("s%d", w), "captain",
+					ai.Cost{Model: "claude-sonnet-4-6", InputCost: 0.01}, time.Now()))
+			}
+		}()
+	}
+	wg.Wait()
+
+	ledger, err := session.OpenLedger(path)
+	require.NoError(t, err)
+	defer func() { _ = ledger.Close() }()
+	spent, err := ledger.Spent("", time.Time{})
+	require.NoError(t, err)
+	assert.InDelta(t, 1.0, spent, 1e-9)
+}
+
+func TestBudgetWindowStart(t *testing.T) {
+	// Thursday
+	now := time.Date(2026, 10, 15, 14, 30, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC), session.Daily.Start(now))
+	assert.Equal(t, time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC), session.Weekly.Start(now))
+	assert.Equal(t, time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), session.Monthly.Start(now))
+
+	sunday := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC), session.Weekly.Start(sunday))
+}
+
+func TestAISpend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spend.db")
+	ledger, err := session.OpenLedger(path)
+	require.NoError(t, err)
+	now := time.Now()
+	yesterday := now.AddDate(0, 0, -1)
+	for _, e := range []session.LedgerEntry{
+		{RecordedAt: now, SessionID: "a", Project: "captain", Cost: ai.Cost{Model: "claude-sonnet-4-6", InputTokens: 1000, InputCost: 1}},
+		{RecordedAt: now, SessionID: "b", Project: "captain", Cost: ai.Cost{Model: "claude-sonnet-4-6", InputTokens: 500, OutputCost: 0.5}},
+		{RecordedAt: now, SessionID: "c", Project: "other", Cost: ai.Cost{Model: "gpt-5", InputCost: 2}},
+		{RecordedAt: yesterday, SessionID: "d", Project: "captain", Cost: ai.Cost{Model: "claude-sonnet-4-6", InputCost: 4}},
+		{RecordedAt: now.AddDate(0, -3, 0), SessionID: "e", Project: "captain", Cost: ai.Cost{Model: "claude-sonnet-4-6", InputCost: 8}},
+	} {
+		require.NoError(t, ledger.Record(e.SessionID, e.Project, e.Cost, e.RecordedAt))
+	}
+	require.NoError(t, ledger.Close())
+
+	result, err := RunAISpend(AISpendOptions{DB: path, Since: now.AddDate(0, 0, -30), GroupBy: "project,model,day"})
+	require.NoError(t, err)
+	spend := result.(AISpendResult)
+	assert.Equal(t, "$7.50", spend.Total)
+	assert.Equal(t, "$3.50", spend.Today)
+
+	require.Len(t, spend.Rows, 3)
+	assert.Equal(t, AISpendRow{Day: now.Format(time.DateOnly), Project: "other", Model: "gpt-5",
+		Requests: 1, Input: "0", Output: "0", Cost: "$2.00"}, spend.Rows[0])
+	assert.Equal(t, "captain", spend.Rows[1].Project)
+	assert.Equal(t, 2, spend.Rows[1].Requests)
+	assert.Equal(t, "1.5K", spend.Rows[1].Input)
+	assert.Equal(t, "$1.50", spend.Rows[1].Cost)
+	assert.Equal(t, yesterday.Format(time.DateOnly), spend.Rows[2].Day)
+
+	result, err = RunAISpend(AISpendOptions{DB: path, Project: "captain", GroupBy: "model"})
+	require.NoError(t, err)
+	spend = result.(AISpendResult)
+	require.Len(t, spend.Rows, 1)
+	assert.Equal(t, "$13.50", spend.Rows[0].Cost)
+
+	_, err = RunAISpend(AISpendOptions{DB: path, GroupBy: "tier"})
+	require.ErrorContains(t, err, "unknown grouping")
+}
@@ -0,0 +1,42 @@
+package cli
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/flanksource/captain/pkg/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAIModelsListsOllamaModels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags":
+			_, _ = w.Write([]byte(`{"models":[{"name":"llama3.2:latest"}]}`))
+		case "/api/show":
+			_, _ = w.Write([]byte(`{"model_info":{"llama.context_length":131072}}`))
+		}
+	}))
+	defer server.Close()
+	t.Setenv("OLLAMA_HOST", server.URL)
+
+	result, err := RunAIModels(AIModelsOptions{Backend: "ollama", Limit: 50})
+	require.NoError(t, err)
+	rows := result.(AIModelsResult).Rows
+	require.Len(t, rows, 1)
+	assert.Equal(t, "ollama/llama3.2:latest", rows[0].Model)
+	assert.Equal(t, "ollama", rows[0].Backend)
+	assert.Equal(t, "131K", rows[0].Context)
+}
+
+func TestAIPromptAttachRejectsUnsupportedFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bundle.zip")
+	require.NoError(t, os.WriteFile(path, []byte("PK\x03\x04\x14\x00"), 0o644))
+
+	_, err := RunAIPrompt(AIPromptOptions{Model: "claude-sonnet-4-6", Prompt: "describe", Attach: []string{path}, NoCache: true})
+	require.ErrorIs(t, err, ai.ErrUnsupportedAttachment)
+}
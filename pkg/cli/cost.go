@@ -5,18 +5,28 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"time"
 
+	"github.com/flanksource/captain/pkg/ai/pricing"
 	"github.com/flanksource/captain/pkg/claude"
+	"github.com/flanksource/commons/logger"
 )
 
 type CostOptions struct {
 	Since   time.Time `flag:"since" help:"Only include sessions after this time" default:"now-7d" short:"s"`
 	All     bool      `flag:"all" help:"Search all projects" short:"a"`
-	GroupBy string    `flag:"group-by" help:"Group results: session, project, model, day, dir, file" default:"session" short:"g"`
+	GroupBy string    `flag:"group-by" help:"Group results: session, project, agent, model, day, dir, file" default:"session" short:"g"`
+	Agent   string    `flag:"agent" help:"Only include these agents: claude, codex, gemini (comma separated)"`
+
+	Budget        float64 `flag:"budget" help:"Exit with status 2 when spend in the budget period exceeds this many USD"`
+	BudgetPeriod  string  `flag:"budget-period" help:"Budget period: day, week, month" default:"month"`
+	BudgetBy      string  `flag:"budget-by" help:"Apply the budget to each project or model instead of the total"`
+	BudgetSummary string  `flag:"budget-summary" help:"Write the budget check as JSON to this file, e.g. for chat notifications"`
 }
 
 type CostRow struct {
+	Agent      string `json:"agent" pretty:"label=Agent,table"`
 	Project    string `json:"project" pretty:"label=Project,table"`
 	Model      string `json:"model" pretty:"label=Model,table"`
 	Tier       string `json:"tier" pretty:"label=Tier,table"`
@@ -26,13 +36,19 @@ type CostRow struct {
 	CacheWrite string `json:"cacheWrite" pretty:"label=Cache Write,table"`
 	Msgs       int    `json:"msgs" pretty:"label=Msgs,table"`
 	APICost    string `json:"apiCost" pretty:"label=API Cost,table"`
+	Source     string `json:"source" pretty:"label=Pricing,table"`
+	Confidence string `json:"confidence" pretty:"label=Confidence,table"`
 	Time       string `json:"time" pretty:"label=Time,table"`
+	Budget     string `json:"budget,omitempty" pretty:"label=Budget,table"`
 }
 
 type CostResult struct {
-	TotalAPICost string    `json:"totalApiCost" pretty:"label=Total API Cost (equivalent)"`
-	TotalTokens  string    `json:"totalTokens" pretty:"label=Total Tokens"`
-	Rows         []CostRow `json:"rows"`
+	TotalAPICost string      `json:"totalApiCost" pretty:"label=Total API Cost (equivalent)"`
+	TotalTokens  string      `json:"totalTokens" pretty:"label=Total Tokens"`
+	BudgetStatus string      `json:"-" pretty:"label=Budget"`
+	Budget       *CostBudget `json:"budget,omitempty" pretty:"-"`
+	Warnings     []string    `json:"warnings,omitempty" pretty:"label=Warnings"`
+	Rows         []CostRow   `json:"rows"`
 }
 
 func RunCost(opts CostOptions) (any, error) {
@@ -46,6 +62,16 @@ func RunCost(opts CostOptions) (any, error) {
 		return nil, err
 	}
 
+	if opts.Agent != "" {
+		sessions = filterAgents(sessions, strings.Split(opts.Agent, ","))
+	}
+
+	var budget *CostBudget
+	if opts.Budget > 0 {
+		if budget, err = checkBudget(cwd, opts, sessions, time.Now()); err != nil {
+			return nil, err
+		}
+	}
 	grouped := groupSessions(sessions, opts.GroupBy)
 
 	sort.Slice(grouped, func(i, j int) bool {
@@ -55,13 +81,10 @@ func RunCost(opts CostOptions) (any, error) {
 	var total claude.TokenSummary
 	rows := make([]CostRow, 0, len(grouped))
 	for _, s := range grouped {
-		total.InputTokens += s.Tokens.InputTokens
-		total.OutputTokens += s.Tokens.OutputTokens
-		total.CacheWriteTokens += s.Tokens.CacheWriteTokens
-		total.CacheReadTokens += s.Tokens.CacheReadTokens
-		total.TotalCost += s.Tokens.TotalCost
+		total.Merge(s.Tokens)
 
 		rows = append(rows, CostRow{
+			Agent:      s.Agent,
 			Project:    s.Project,
 			Model:      s.Model,
 			Tier:       s.Tier,
@@ -70,16 +93,77 @@ func RunCost(opts CostOptions) (any, error) {
 			CacheRead:  formatTokens(s.Tokens.CacheReadTokens),
 			CacheWrite: formatTokens(s.Tokens.CacheWriteTokens),
 			Msgs:       s.Messages,
-			APICost:    formatCost(s.Tokens.TotalCost),
+			APICost:    formatSummaryCost(s.Tokens),
+			Source:     s.Tokens.PricingSource,
+			Confidence: s.Tokens.Coverage(),
 			Time:       claude.FormatTimeAgo(&s.End),
+			Budget:     budgetMark(budget, s, opts.GroupBy),
 		})
 	}
 
-	return CostResult{
-		TotalAPICost: formatCost(total.TotalCost),
+	result := CostResult{
+		TotalAPICost: formatSummaryCost(total),
 		TotalTokens:  formatTokens(total.TotalTokens()),
 		Rows:         rows,
-	}, nil
+	}
+	// grouping by dir or file repeats sessions, so count from the sessions
+	var coverage claude.TokenSummary
+	for _, s := range sessions {
+		coverage.Merge(s.Tokens)
+	}
+	if coverage.UnpricedMessages > 0 {
+		warning := fmt.Sprintf("%d messages of %s have no pricing and are excluded from the cost; add them to %s",
+			coverage.UnpricedMessages, strings.Join(coverage.UnpricedModels, ", "), pricing.DefaultUserPricingPath())
+		logger.Warnf("%s", warning)
+		result.Warnings = append(result.Warnings, warning)
+	}
+
+	if budget != nil {
+		result.Budget = budget
+		result.BudgetStatus = budget.Message
+		if opts.BudgetSummary != "" {
+			if err := writeBudgetSummary(opts.BudgetSummary, budget); err != nil {
+				return nil, err
+			}
+		}
+		if budget.Breached {
+			logger.Warnf("Budget exceeded: %s", budget.Message)
+			return result, &BudgetExceededError{Message: budget.Message, ExitCode: ExitBudgetExceeded}
+		}
+	}
+	return result, nil
+}
+
+func budgetMark(budget *CostBudget, s claude.SessionCost, groupBy string) string {
+	if budget != nil && budget.over(s, groupBy) {
+		return "OVER"
+	}
+	return ""
+}
+
+// formatSummaryCost shows the cost of s, marking a cost that leaves out
+// unpriced messages with a trailing "+" instead of reporting it as complete.
+func formatSummaryCost(s claude.TokenSummary) string {
+	switch s.Coverage() {
+	case claude.ConfidenceUnpriced:
+		return "-"
+	case claude.ConfidencePartial:
+		return formatCost(s.TotalCost) + "+"
+	}
+	return formatCost(s.TotalCost)
+}
+
+func filterAgents(sessions []claude.SessionCost, agents []string) []claude.SessionCost {
+	var result []claude.SessionCost
+	for _, s := range sessions {
+		for _, agent := range agents {
+			if strings.TrimSpace(agent) == s.Agent {
+				result = append(result, s)
+				break
+			}
+		}
+	}
+	return result
 }
 
 func groupSessions(sessions []claude.SessionCost, groupBy string) []claude.SessionCost {
@@ -100,6 +184,8 @@ func groupSessions(sessions []claude.SessionCost, groupBy string) []claude.Sessi
 		switch groupBy {
 		case "project":
 			key = groupKey(s.Project)
+		case "agent":
+			key = groupKey(s.Agent)
 		case "model":
 			key = groupKey(s.Model)
 		case "day":
@@ -144,6 +230,7 @@ func groupByPath(sessions []claude.SessionCost, mode string) []claude.SessionCos
 		for _, key := range keys {
 			split := claude.SessionCost{
 				SessionID: s.SessionID,
+				Agent:     s.Agent,
 				Project:   key,
 				Model:     s.Model,
 				Tier:      s.Tier,
@@ -156,6 +243,10 @@ func groupByPath(sessions []claude.SessionCost, mode string) []claude.SessionCos
 					CacheWriteTokens: int(float64(s.Tokens.CacheWriteTokens) * fraction),
 					CacheReadTokens:  int(float64(s.Tokens.CacheReadTokens) * fraction),
 					TotalCost:        s.Tokens.TotalCost * fraction,
+					PricingSource:    s.Tokens.PricingSource,
+					Confidence:       s.Tokens.Confidence,
+					UnpricedMessages: s.Tokens.UnpricedMessages,
+					UnpricedModels:   s.Tokens.UnpricedModels,
 				},
 			}
 
@@ -193,11 +284,7 @@ func uniquePaths(files []string, mode string) []string {
 }
 
 func mergeInto(g *claude.SessionCost, s claude.SessionCost) {
-	g.Tokens.InputTokens += s.Tokens.InputTokens
-	g.Tokens.OutputTokens += s.Tokens.OutputTokens
-	g.Tokens.CacheWriteTokens += s.Tokens.CacheWriteTokens
-	g.Tokens.CacheReadTokens += s.Tokens.CacheReadTokens
-	g.Tokens.TotalCost += s.Tokens.TotalCost
+	g.Tokens.Merge(s.Tokens)
 	g.Messages += s.Messages
 	if s.Start.Before(g.Start) {
 		g.Start = s.Start
@@ -208,6 +295,9 @@ func mergeInto(g *claude.SessionCost, s claude.SessionCost) {
 	if g.Model != s.Model {
 		g.Model = "mixed"
 	}
+	if g.Agent != s.Agent {
+		g.Agent = "mixed"
+	}
 	if s.Tier != "" {
 		g.Tier = s.Tier
 	}
@@ -0,0 +1,219 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flanksource/captain/pkg/ai/session"
+	"github.com/flanksource/captain/pkg/claude"
+)
+
+// ExitBudgetExceeded is the status captain exits with when `captain cost`
+// finds spend over its --budget, so cron jobs fail without parsing output.
+const ExitBudgetExceeded = 2
+
+// runRateDays is the trailing window the month-end forecast extrapolates.
+const runRateDays = 7
+
+var budgetPeriods = map[string]session.BudgetWindow{
+	"day":   session.Daily,
+	"week":  session.Weekly,
+	"month": session.Monthly,
+}
+
+// BudgetExceededError is returned by RunCost, together with the report, when
+// spend is over --budget. ExitCode is the status captain exits with.
+type BudgetExceededError struct {
+	Message  string
+	ExitCode int
+}
+
+func (e *BudgetExceededError) Error() string {
+	return "budget exceeded: " + e.Message
+}
+
+// CostBudget is the machine-readable outcome of a --budget check.
+type CostBudget struct {
+	Period      string            `json:"period"`
+	Since       time.Time         `json:"since"`
+	By          string            `json:"by,omitempty"`
+	Limit       float64           `json:"limit"`
+	Spent       float64           `json:"spent"`
+	MonthToDate float64           `json:"monthToDate"`
+	RunRate     float64           `json:"dailyRunRate"`
+	Forecast    float64           `json:"forecastMonthEnd"`
+	Breached    bool              `json:"breached"`
+	Scopes      []CostBudgetScope `json:"scopes"`
+	Message     string            `json:"message"`
+}
+
+// CostBudgetScope is the spend of one project, model, or of everything when
+// the budget is not split.
+type CostBudgetScope struct {
+	Name     string  `json:"name,omitempty"`
+	Spent    float64 `json:"spent"`
+	Percent  float64 `json:"percent"`
+	Forecast float64 `json:"forecastMonthEnd"`
+	Over     bool    `json:"over"`
+}
+
+// over reports whether row s, grouped by groupBy, spent within the budget
+// period of a scope that is over budget. A split budget only marks rows that
+// each belong to a single scope: sessions and projects for a project budget,
+// models for a model budget.
+func (b *CostBudget) over(s claude.SessionCost, groupBy string) bool {
+	if s.End.Before(b.Since) {
+		return false
+	}
+	var name string
+	switch {
+	case b.By == "":
+	case b.By == "project" && (groupBy == "project" || groupBy == "session"):
+		name = s.Project
+	case b.By == "model" && groupBy == "model":
+		name = s.Model
+	default:
+		return false
+	}
+	for _, scope := range b.Scopes {
+		if scope.Over && scope.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// budgetScope is the scope a charge of session s counts towards.
+func budgetScope(s claude.SessionCost, c claude.Charge, by string) string {
+	switch by {
+	case "project":
+		return s.Project
+	case "model":
+		return c.Model
+	}
+	return ""
+}
+
+// checkBudget compares the spend of the current budget period against
+// opts.Budget and forecasts month-end spend from the trailing run-rate.
+// sessions are those RunCost parsed since opts.Since, reused when they reach
+// back far enough.
+func checkBudget(cwd string, opts CostOptions, sessions []claude.SessionCost, now time.Time) (*CostBudget, error) {
+	window, ok := budgetPeriods[opts.BudgetPeriod]
+	if !ok {
+		return nil, fmt.Errorf("--budget-period: unknown period %q (day, week, month)", opts.BudgetPeriod)
+	}
+	if opts.BudgetBy != "" && opts.BudgetBy != "project" && opts.BudgetBy != "model" {
+		return nil, fmt.Errorf("--budget-by: unknown scope %q (project, model)", opts.BudgetBy)
+	}
+
+	start := window.Start(now)
+	monthStart := session.Monthly.Start(now)
+	trailingStart := now.AddDate(0, 0, -runRateDays)
+	earliest := start
+	for _, t := range []time.Time{monthStart, trailingStart} {
+		if t.Before(earliest) {
+			earliest = t
+		}
+	}
+
+	if opts.Since.After(earliest) {
+		var err error
+		if sessions, err = claude.ParseCosts(cwd, opts.All, &earliest); err != nil {
+			return nil, err
+		}
+		if opts.Agent != "" {
+			sessions = filterAgents(sessions, strings.Split(opts.Agent, ","))
+		}
+	}
+
+	// sessions straddle the window starts, so split their spend message by
+	// message
+	spent, monthToDate, trailing := map[string]float64{}, map[string]float64{}, map[string]float64{}
+	for _, s := range sessions {
+		for _, c := range s.Charges {
+			name := budgetScope(s, c, opts.BudgetBy)
+			for _, w := range []struct {
+				since time.Time
+				into  map[string]float64
+			}{{start, spent}, {monthStart, monthToDate}, {trailingStart, trailing}} {
+				if !c.Time.Before(w.since) {
+					w.into[name] += c.Cost
+				}
+			}
+		}
+	}
+	remainingDays := monthStart.AddDate(0, 1, 0).Sub(now).Hours() / 24
+
+	budget := &CostBudget{Period: string(window), Since: start, By: opts.BudgetBy, Limit: opts.Budget}
+	names := map[string]bool{}
+	for _, m := range []map[string]float64{spent, monthToDate, trailing} {
+		for name := range m {
+			names[name] = true
+		}
+	}
+	for name := range names {
+		scope := CostBudgetScope{
+			Name:     name,
+			Spent:    spent[name],
+			Percent:  spent[name] / opts.Budget * 100,
+			Forecast: monthToDate[name] + trailing[name]/runRateDays*remainingDays,
+			Over:     spent[name] > opts.Budget,
+		}
+		budget.Spent += scope.Spent
+		budget.MonthToDate += monthToDate[name]
+		budget.RunRate += trailing[name] / runRateDays
+		budget.Forecast += scope.Forecast
+		budget.Breached = budget.Breached || scope.Over
+		budget.Scopes = append(budget.Scopes, scope)
+	}
+	sort.Slice(budget.Scopes, func(i, j int) bool {
+		a, b := budget.Scopes[i], budget.Scopes[j]
+		if a.Spent != b.Spent {
+			return a.Spent > b.Spent
+		}
+		return a.Name < b.Name
+	})
+	budget.Message = budget.message()
+	return budget, nil
+}
+
+// message summarises the check in one line, for chat notifications.
+func (b *CostBudget) message() string {
+	if b.By == "" {
+		status := "within"
+		if b.Breached {
+			status = "over"
+		}
+		return fmt.Sprintf("%s of %s %s budget spent (%s), forecast %s by month end",
+			formatCost(b.Spent), formatCost(b.Limit), b.Period, status, formatCost(b.Forecast))
+	}
+
+	var over []string
+	for _, s := range b.Scopes {
+		if s.Over {
+			over = append(over, fmt.Sprintf("%s %s", s.Name, formatCost(s.Spent)))
+		}
+	}
+	if len(over) == 0 {
+		return fmt.Sprintf("every %s within its %s %s budget, %s spent, forecast %s by month end",
+			b.By, formatCost(b.Limit), b.Period, formatCost(b.Spent), formatCost(b.Forecast))
+	}
+	return fmt.Sprintf("%d %s(s) over the %s %s budget: %s; forecast %s by month end",
+		len(over), b.By, formatCost(b.Limit), b.Period, strings.Join(over, ", "), formatCost(b.Forecast))
+}
+
+func writeBudgetSummary(path string, b *CostBudget) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write budget summary: %w", err)
+	}
+	return nil
+}
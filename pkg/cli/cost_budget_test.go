@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flanksource/captain/pkg/ai/pricing"
+	"github.com/flanksource/captain/pkg/claude"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeClaudeSession appends to a Claude Code session of project one
+// assistant message of 100K input tokens of model per timestamp.
+func writeClaudeSession(t *testing.T, home, project, id, model string, times ...time.Time) {
+	t.Helper()
+	dir := filepath.Join(home, "src", project)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, ".git"), 0o755))
+
+	var lines []string
+	for _, ts := range times {
+		lines = append(lines, fmt.Sprintf(`{"type":"assistant","sessionId":%q,"timestamp":%q,"message":{"role":"assistant","model":%q,"usage":{"input_tokens":100000,"output_tokens":0}}}`,
+			id, ts.UTC().Format(time.RFC3339), model))
+	}
+	path := filepath.Join(home, ".claude", "projects", claude.NormalizePath(dir), id+".jsonl")
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = f.WriteString(strings.Join(lines, "\n") + "\n")
+	require.NoError(t, err)
+}
+
+func TestCostBudget(t *testing.T) {
+	registerTestPricing()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	now := time.Now().Add(-time.Minute)
+	writeClaudeSession(t, home, "captain", "a", "claude-sonnet-4-6", now, now, now, now, now)
+	writeClaudeSession(t, home, "other", "b", "claude-sonnet-4-6", now)
+	opts := CostOptions{Since: now.AddDate(0, 0, -7), All: true, GroupBy: "session", BudgetPeriod: "month"}
+
+	opts.Budget = 5
+	out, err := RunCost(opts)
+	require.NoError(t, err)
+	result := out.(CostResult)
+	require.NotNil(t, result.Budget)
+	assert.False(t, result.Budget.Breached)
+	assert.InDelta(t, 1.2, result.Budget.Spent, 1e-9)
+	assert.InDelta(t, 1.2/7, result.Budget.RunRate, 1e-9)
+	assert.GreaterOrEqual(t, result.Budget.Forecast, result.Budget.MonthToDate)
+	for _, row := range result.Rows {
+		assert.Empty(t, row.Budget)
+	}
+
+	opts.Budget = 0.5
+	opts.BudgetBy = "project"
+	opts.BudgetSummary = filepath.Join(t.TempDir(), "budget.json")
+	out, err = RunCost(opts)
+	var exceeded *BudgetExceededError
+	require.ErrorAs(t, err, &exceeded)
+	assert.Equal(t, ExitBudgetExceeded, exceeded.ExitCode)
+	result = out.(CostResult)
+	assert.True(t, result.Budget.Breached, "the report is returned with the error")
+	require.Len(t, result.Budget.Scopes, 2)
+	assert.Equal(t, CostBudgetScope{Name: "captain", Spent: 1, Percent: 200, Forecast: result.Budget.Scopes[0].Forecast, Over: true}, result.Budget.Scopes[0])
+	assert.False(t, result.Budget.Scopes[1].Over)
+	assert.Equal(t, "1 project(s) over the $0.50 monthly budget: captain $1.00; forecast "+formatCost(result.Budget.Forecast)+" by month end", result.BudgetStatus)
+
+	marked := map[string]string{}
+	for _, row := range result.Rows {
+		marked[row.Project] = row.Budget
+	}
+	assert.Equal(t, map[string]string{"captain": "OVER", "other": ""}, marked)
+
+	data, err := os.ReadFile(opts.BudgetSummary)
+	require.NoError(t, err)
+	var summary CostBudget
+	require.NoError(t, json.Unmarshal(data, &summary))
+	assert.True(t, summary.Breached)
+	assert.Equal(t, "monthly", summary.Period)
+	assert.Equal(t, result.Budget.Message, summary.Message)
+
+	opts.BudgetPeriod = "year"
+	_, err = RunCost(opts)
+	assert.ErrorContains(t, err, "unknown period")
+}
+
+func TestCostBudgetSplitsSessionsByMessage(t *testing.T) {
+	registerTestPricing()
+	pricing.MergeModels(map[string]*pricing.ModelInfo{
+		"anthropic/claude-haiku-4.5": {ModelID: "anthropic/claude-haiku-4.5", InputPrice: 1},
+	})
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	// one session mixing models, and straddling the start of the day
+	now := time.Now().Add(-time.Minute)
+	writeClaudeSession(t, home, "captain", "a", "claude-sonnet-4-6", now, now, now)
+	writeClaudeSession(t, home, "captain", "a", "claude-haiku-4-5", now)
+	writeClaudeSession(t, home, "captain", "a", "claude-sonnet-4-6", now.AddDate(0, 0, -3))
+	opts := CostOptions{Since: now.AddDate(0, 0, -7), All: true, Budget: 0.5, BudgetPeriod: "day", BudgetBy: "model"}
+
+	marks := func(groupBy string) map[string]string {
+		opts.GroupBy = groupBy
+		out, err := RunCost(opts)
+		require.ErrorAs(t, err, new(*BudgetExceededError))
+		marked := map[string]string{}
+		for _, row := range out.(CostResult).Rows {
+			marked[row.Project+"/"+row.Model] = row.Budget
+		}
+		return marked
+	}
+
+	opts.GroupBy = "model"
+	out, err := RunCost(opts)
+	require.ErrorAs(t, err, new(*BudgetExceededError))
+	budget := out.(CostResult).Budget
+	require.Len(t, budget.Scopes, 2)
+	assert.Equal(t, "claude-sonnet-4-6", budget.Scopes[0].Name)
+	assert.InDelta(t, 0.6, budget.Scopes[0].Spent, 1e-9, "only today's sonnet messages count")
+	assert.True(t, budget.Scopes[0].Over)
+	assert.Equal(t, "claude-haiku-4-5", budget.Scopes[1].Name)
+	assert.InDelta(t, 0.1, budget.Scopes[1].Spent, 1e-9)
+	assert.False(t, budget.Scopes[1].Over)
+	assert.InDelta(t, 0.9/7, budget.RunRate, 1e-9, "the run rate counts the whole trailing week")
+
+	assert.Equal(t, map[string]string{"captain/claude-sonnet-4-6": "OVER"}, marks("model"))
+	assert.Equal(t, map[string]string{"captain/claude-sonnet-4-6": ""}, marks("project"), "a project row mixes models")
+
+	opts.BudgetBy = "project"
+	assert.Equal(t, map[string]string{"captain/claude-sonnet-4-6": "OVER"}, marks("session"))
+	for _, mark := range marks("day") {
+		assert.Empty(t, mark, "a day row is not a project")
+	}
+}
@@ -0,0 +1,152 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/flanksource/captain/pkg/bash"
+	"github.com/flanksource/captain/pkg/claude"
+)
+
+// PreToolUseOptions are the decisions of the pre-tool-use hook. The command
+// is wired with plain cobra flags rather than clicky, since hooks write their
+// own JSON to stdout.
+type PreToolUseOptions struct {
+	Unsafe     string // decision for commands or paths with safety violations (deny, ask)
+	Safe       string // decision for commands without violations (allow, ask, or none)
+	ParseError string // decision for bash commands that cannot be parsed (deny, ask)
+}
+
+// hookPathInput covers the file path fields of the Edit, MultiEdit, Write and NotebookEdit tools
+type hookPathInput struct {
+	FilePath     string `json:"file_path,omitempty"`
+	NotebookPath string `json:"notebook_path,omitempty"`
+}
+
+// ExitHookBlock is the status that makes Claude Code block the tool call and
+// show stderr to the model. Any other non-zero status lets the tool run.
+const ExitHookBlock = 2
+
+// RunPreToolUseHook reads a Claude Code PreToolUse payload from stdin and
+// writes the permission decision as hook JSON to stdout, returning the exit
+// status. Input that cannot be read or evaluated blocks the tool call rather
+// than letting it through unchecked.
+func RunPreToolUseHook(opts PreToolUseOptions, stdin io.Reader, stdout, stderr io.Writer) int {
+	output, err := PreToolUse(stdin, opts)
+	if err == nil {
+		err = json.NewEncoder(stdout).Encode(output)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "captain hook pre-tool-use: %v\n", err)
+		return ExitHookBlock
+	}
+	return 0
+}
+
+// PreToolUse evaluates the PreToolUse payload read from r against the scanner
+// config of the payload's working directory.
+func PreToolUse(r io.Reader, opts PreToolUseOptions) (bash.HookOutput, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return bash.HookOutput{}, fmt.Errorf("reading hook input: %w", err)
+	}
+
+	var input bash.HookInput
+	if err := json.Unmarshal(data, &input); err != nil {
+		return bash.HookOutput{}, fmt.Errorf("parsing hook input: %w", err)
+	}
+
+	if input.CWD == "" {
+		input.CWD, _ = os.Getwd()
+	}
+	config, err := bash.LoadConfig(input.CWD)
+	if err != nil {
+		return bash.HookOutput{}, err
+	}
+
+	return EvaluatePreToolUse(input, bash.NewScanner(input.CWD, config), bash.NewPathClassifier(input.CWD, config), opts)
+}
+
+// EvaluatePreToolUse runs Bash commands through the scanner and Edit/Write paths
+// through the path classifier, mapping the outcome to a permission decision.
+// Tools that are not inspected get no decision so Claude Code's own rules apply.
+func EvaluatePreToolUse(input bash.HookInput, scanner *bash.Scanner, classifier *bash.PathClassifier, opts PreToolUseOptions) (bash.HookOutput, error) {
+	output := bash.HookOutput{Continue: true}
+
+	var decision claude.PermissionDecision
+	var reason string
+
+	switch input.ToolName {
+	case "Bash":
+		var toolInput bash.BashToolInput
+		if err := json.Unmarshal(input.ToolInput, &toolInput); err != nil {
+			return output, fmt.Errorf("parsing Bash tool input: %w", err)
+		}
+		result := scanner.Scan(toolInput.Command)
+		switch {
+		case result.ParseError != "":
+			decision, reason = claude.PermissionDecision(opts.ParseError), result.Reason+": "+result.ParseError
+		case !result.Allowed:
+			decision, reason = claude.PermissionDecision(opts.Unsafe), formatViolations(result.Violations)
+		default:
+			decision, reason = claude.PermissionDecision(opts.Safe), "No safety violations detected"
+		}
+
+	case "Edit", "MultiEdit", "Write", "NotebookEdit":
+		var toolInput hookPathInput
+		if err := json.Unmarshal(input.ToolInput, &toolInput); err != nil {
+			return output, fmt.Errorf("parsing %s tool input: %w", input.ToolName, err)
+		}
+		path := toolInput.FilePath
+		if path == "" {
+			path = toolInput.NotebookPath
+		}
+		classification := classifier.ClassifyPath(path)
+		if classification.IsSafe {
+			decision, reason = claude.PermissionDecision(opts.Safe), classification.Reason
+		} else {
+			decision = claude.PermissionDecision(opts.Unsafe)
+			reason = fmt.Sprintf("%s to unsafe location: %s (%s)", input.ToolName, path, classification.Reason)
+		}
+
+	default:
+		return output, nil
+	}
+
+	if err := validateDecision(decision); err != nil {
+		return output, err
+	}
+	if decision == "" || decision == "none" {
+		return output, nil
+	}
+
+	output.HookSpecificOutput = &bash.HookSpecificOutput{
+		HookEventName:            string(claude.HookEventPreToolUse),
+		PermissionDecision:       string(decision),
+		PermissionDecisionReason: reason,
+	}
+	return output, nil
+}
+
+func validateDecision(decision claude.PermissionDecision) error {
+	switch decision {
+	case claude.PermissionAllow, claude.PermissionDeny, claude.PermissionAsk, "", "none":
+		return nil
+	}
+	return fmt.Errorf("invalid permission decision %q (expected allow, deny, ask or none)", decision)
+}
+
+func formatViolations(violations []bash.Violation) string {
+	parts := make([]string, 0, len(violations))
+	for _, v := range violations {
+		msg := v.Message
+		if v.Recommendation != "" {
+			msg += ". " + v.Recommendation
+		}
+		parts = append(parts, msg)
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/flanksource/captain/pkg/bash"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func evaluate(t *testing.T, payload string, opts PreToolUseOptions) bash.HookOutput {
+	t.Helper()
+	var input bash.HookInput
+	require.NoError(t, json.Unmarshal([]byte(payload), &input))
+	cwd := "/Users/test/project"
+	out, err := EvaluatePreToolUse(input, bash.NewScanner(cwd, nil), bash.NewPathClassifier(cwd, nil), opts)
+	require.NoError(t, err)
+	return out
+}
+
+var defaultHookOpts = PreToolUseOptions{Unsafe: "deny", Safe: "allow", ParseError: "ask"}
+
+func TestEvaluatePreToolUse_Bash(t *testing.T) {
+	tests := []struct {
+		name     string
+		command  string
+		decision string
+		reason   string
+	}{
+		{"safe command", "ls -la", "allow", "No safety violations"},
+		{"system write", "echo x > /etc/passwd", "deny", "File write to unsafe location"},
+		{"network", "curl https://example.com", "deny", "Network operations require review"},
+		{"parse error", "echo 'unterminated", "ask", "Failed to parse bash command"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, _ := json.Marshal(map[string]any{
+				"session_id":      "s1",
+				"hook_event_name": "PreToolUse",
+				"tool_name":       "Bash",
+				"tool_input":      map[string]string{"command": tt.command},
+			})
+			out := evaluate(t, string(payload), defaultHookOpts)
+			assert.True(t, out.Continue)
+			require.NotNil(t, out.HookSpecificOutput)
+			assert.Equal(t, "PreToolUse", out.HookSpecificOutput.HookEventName)
+			assert.Equal(t, tt.decision, out.HookSpecificOutput.PermissionDecision)
+			assert.Contains(t, out.HookSpecificOutput.PermissionDecisionReason, tt.reason)
+		})
+	}
+}
+
+func TestEvaluatePreToolUse_Paths(t *testing.T) {
+	out := evaluate(t, `{"tool_name":"Write","tool_input":{"file_path":"/etc/hosts","content":"x"}}`, defaultHookOpts)
+	require.NotNil(t, out.HookSpecificOutput)
+	assert.Equal(t, "deny", out.HookSpecificOutput.PermissionDecision)
+	assert.Contains(t, out.HookSpecificOutput.PermissionDecisionReason, "System directory")
+
+	out = evaluate(t, `{"tool_name":"Edit","tool_input":{"file_path":"/Users/test/project/main.go"}}`, defaultHookOpts)
+	require.NotNil(t, out.HookSpecificOutput)
+	assert.Equal(t, "allow", out.HookSpecificOutput.PermissionDecision)
+}
+
+func TestEvaluatePreToolUse_Passthrough(t *testing.T) {
+	out := evaluate(t, `{"tool_name":"Read","tool_input":{"file_path":"/etc/hosts"}}`, defaultHookOpts)
+	assert.True(t, out.Continue)
+	assert.Nil(t, out.HookSpecificOutput)
+
+	opts := defaultHookOpts
+	opts.Safe = "none"
+	opts.Unsafe = "ask"
+	out = evaluate(t, `{"tool_name":"Bash","tool_input":{"command":"ls"}}`, opts)
+	assert.Nil(t, out.HookSpecificOutput)
+
+	out = evaluate(t, `{"tool_name":"Bash","tool_input":{"command":"rm -rf /usr/local"}}`, opts)
+	require.NotNil(t, out.HookSpecificOutput)
+	assert.Equal(t, "ask", out.HookSpecificOutput.PermissionDecision)
+}
+
+func TestEvaluatePreToolUse_InvalidDecision(t *testing.T) {
+	var input bash.HookInput
+	require.NoError(t, json.Unmarshal([]byte(`{"tool_name":"Bash","tool_input":{"command":"ls"}}`), &input))
+	_, err := EvaluatePreToolUse(input, bash.NewScanner("/tmp", nil), bash.NewPathClassifier("/tmp", nil), PreToolUseOptions{Safe: "maybe"})
+	assert.Error(t, err)
+}
+
+func TestRunPreToolUseHook(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := RunPreToolUseHook(defaultHookOpts, strings.NewReader(`{"tool_name":"Bash","cwd":"/tmp","tool_input":{"command":"curl https://example.com"}}`), &stdout, &stderr)
+	assert.Equal(t, 0, code)
+	assert.Empty(t, stderr.String())
+	var out bash.HookOutput
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &out))
+	require.NotNil(t, out.HookSpecificOutput)
+	assert.Equal(t, "deny", out.HookSpecificOutput.PermissionDecision)
+
+	// errors block the tool call instead of failing open
+	for _, payload := range []string{
+		`{"tool_name":`,
+		`{"tool_name":"Bash","cwd":"/tmp","tool_input":"ls"}`,
+	} {
+		stdout.Reset()
+		stderr.Reset()
+		code = RunPreToolUseHook(defaultHookOpts, strings.NewReader(payload), &stdout, &stderr)
+		assert.Equal(t, ExitHookBlock, code, payload)
+		assert.Empty(t, stdout.String(), payload)
+		assert.Contains(t, stderr.String(), "parsing", payload)
+	}
+
+	stderr.Reset()
+	code = RunPreToolUseHook(PreToolUseOptions{Safe: "maybe"}, strings.NewReader(`{"tool_name":"Bash","cwd":"/tmp","tool_input":{"command":"ls"}}`), &stdout, &stderr)
+	assert.Equal(t, ExitHookBlock, code)
+	assert.Contains(t, stderr.String(), "invalid permission decision")
+}